@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// APIHandler returns a handler that delegates to the named collector of the current configuration,
+// which returns 404 unless the collector is enabled and serves HTTP.
+func (e *exporter) APIHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.mu.RLock()
+		collectors := e.collectors
+		e.mu.RUnlock()
+
+		h, ok := collectors.Collectors[name].(http.Handler)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Collector %q is not enabled", name), http.StatusNotFound)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
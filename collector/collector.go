@@ -0,0 +1,373 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Namespace defines the common namespace to be used by all metrics.
+const namespace = "postfix"
+
+const (
+	defaultEnabled  = true
+	defaultDisabled = false
+)
+
+var (
+	scrapeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scope", "collector_duration_seconds"),
+		"postfix_exporter: Duration of a collector scrape.",
+		[]string{"collector"},
+		nil,
+	)
+	scrapeSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scope", "collector_success"),
+		"postfix_exporter: Whether a collector succeeded.",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+// Collector is the interface a collector has to implement.
+// Update reads statistics from the source, and Describe and Collect expose the statistics of the last update.
+type Collector interface {
+	prometheus.Collector
+
+	// Update collects statistics from the source until ctx is done.
+	Update(ctx context.Context) error
+}
+
+// Instance is a Postfix instance to collect statistics from.
+type Instance struct {
+	// Name is added as the postfix_instance label unless it is empty.
+	Name      string
+	PostQueue *postfix.PostQueue
+}
+
+// Options are the dependencies shared by the collectors.
+type Options struct {
+	Instances []Instance
+	// Processors are applied to each message in the queue before aggregation.
+	// If nil, DefaultPipeline is used. Use an empty Pipeline to disable processing.
+	Processors Pipeline
+	// Config is the configuration of the collectors. If nil, config.DefaultConfig is used.
+	Config *config.Config
+	// Previous are the collectors replaced on reload, whose Reusable collectors are kept if possible.
+	Previous *PostfixCollector
+	// Now returns the current time of the collectors whose statistics decay over time. If nil, time.Now is used.
+	Now func() time.Time
+	// LogInput is whether a log input feeds the events to the log-driven collectors, which fail to update without it.
+	LogInput bool
+}
+
+// config returns the configuration, or the default configuration if none is given.
+func (o *Options) config() *config.Config {
+	if o.Config == nil {
+		return &config.DefaultConfig
+	}
+	return o.Config
+}
+
+// now returns the function of the current time, or time.Now if none is given.
+func (o *Options) now() func() time.Time {
+	if o.Now == nil {
+		return time.Now
+	}
+	return o.Now
+}
+
+// NewOptions returns the options built from the configuration.
+func NewOptions(cfg *config.Config) (*Options, error) {
+	instances := make([]Instance, len(cfg.Instances))
+	for i, instance := range cfg.Instances {
+		instances[i] = Instance{
+			Name:      instance.Name,
+			PostQueue: postfix.NewPostQueue(&postfix.PostQueueOpt{ShowqPath: instance.ShowqPath}),
+		}
+	}
+	pipeline, err := NewPipeline(cfg.Processors)
+	if err != nil {
+		return nil, err
+	}
+	return &Options{
+		Instances:  instances,
+		Processors: pipeline,
+		Config:     cfg,
+	}, nil
+}
+
+// Factory returns a new Collector.
+type Factory func(opts *Options, logger log.Logger) (Collector, error)
+
+var (
+	factories      = make(map[string]Factory)
+	collectorState = make(map[string]*bool)
+	// collectorFlagSet records the collectors enabled or disabled on the command line,
+	// which take precedence over the configuration file.
+	collectorFlagSet = make(map[string]bool)
+)
+
+func init() {
+	kingpin.CommandLine.PreAction(func(*kingpin.ParseContext) error {
+		collectorFlagSet = make(map[string]bool)
+		return nil
+	})
+}
+
+// registerCollector registers a collector and its --collector.<name> flag.
+func registerCollector(name string, isDefaultEnabled bool, factory Factory) {
+	var helpDefaultState string
+	if isDefaultEnabled {
+		helpDefaultState = "enabled"
+	} else {
+		helpDefaultState = "disabled"
+	}
+
+	flagName := fmt.Sprintf("collector.%s", name)
+	flagHelp := fmt.Sprintf("Enable the %s collector (default: %s).", name, helpDefaultState)
+	defaultValue := strconv.FormatBool(isDefaultEnabled)
+
+	flag := kingpin.Flag(flagName, flagHelp).Default(defaultValue).Action(func(*kingpin.ParseContext) error {
+		collectorFlagSet[name] = true
+		return nil
+	}).Bool()
+	collectorState[name] = flag
+
+	factories[name] = factory
+}
+
+// Names returns the names of all registered collectors.
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// result is the outcome of the last update of a collector.
+type result struct {
+	duration time.Duration
+	success  bool
+}
+
+// PostfixCollector implements the prometheus.Collector interface for the enabled collectors.
+type PostfixCollector struct {
+	Collectors map[string]Collector
+	logInput   bool
+	logger     log.Logger
+
+	mu       sync.Mutex
+	results  map[string]result
+	statuses map[string]*Status
+}
+
+// Update updates all enabled collectors concurrently.
+func (p *PostfixCollector) Update(ctx context.Context) {
+	p.UpdateCollectors(ctx, p.names())
+}
+
+// UpdateCollectors updates the named collectors concurrently.
+func (p *PostfixCollector) UpdateCollectors(ctx context.Context, names []string) {
+	wg := sync.WaitGroup{}
+	wg.Add(len(names))
+	for _, name := range names {
+		go func(name string) {
+			defer wg.Done()
+			p.UpdateCollector(ctx, name)
+		}(name)
+	}
+	wg.Wait()
+}
+
+// names returns the names of the enabled collectors.
+func (p *PostfixCollector) names() []string {
+	names := make([]string, 0, len(p.Collectors))
+	for name := range p.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Filter returns a collector that exposes only the named collectors.
+// It returns an error if any of the names is not an enabled collector.
+func (p *PostfixCollector) Filter(names []string) (*FilteredCollector, error) {
+	seen := make(map[string]bool)
+	var filtered []string
+	for _, name := range names {
+		if _, ok := p.Collectors[name]; !ok {
+			if _, ok := factories[name]; ok {
+				return nil, fmt.Errorf("collector `%s` is not enabled", name)
+			}
+			return nil, fmt.Errorf("unknown collector `%s`", name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		filtered = append(filtered, name)
+	}
+	return &FilteredCollector{collector: p, names: filtered}, nil
+}
+
+// UpdateCollector updates the named collector and records its duration and success.
+func (p *PostfixCollector) UpdateCollector(ctx context.Context, name string) error {
+	c, ok := p.Collectors[name]
+	if !ok {
+		return fmt.Errorf("collector `%s` is not enabled", name)
+	}
+
+	begin := time.Now()
+	var err error
+	if _, ok := c.(eventHandler); ok && !p.logInput {
+		err = errNoLogInput
+	} else {
+		err = c.Update(ctx)
+	}
+	duration := time.Since(begin)
+
+	if err != nil {
+		level.Error(p.logger).Log("msg", "collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+	} else {
+		level.Debug(p.logger).Log("msg", "collector succeeded", "name", name, "duration_seconds", duration.Seconds())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.results[name] = result{duration: duration, success: err == nil}
+	status, ok := p.statuses[name]
+	if !ok {
+		status = &Status{}
+		p.statuses[name] = status
+	}
+	status.record(begin, err)
+	if reporter, ok := c.(InstanceReporter); ok {
+		if status.Instances == nil {
+			status.Instances = make(map[string]*Status)
+		}
+		for instance, err := range reporter.InstanceErrors() {
+			s, ok := status.Instances[instance]
+			if !ok {
+				s = &Status{}
+				status.Instances[instance] = s
+			}
+			s.record(begin, err)
+		}
+	}
+	return err
+}
+
+// Describe implements the prometheus.Collector interface.
+func (p *PostfixCollector) Describe(ch chan<- *prometheus.Desc) {
+	p.describe(ch, p.names())
+}
+
+// Collect implements the prometheus.Collector interface.
+func (p *PostfixCollector) Collect(ch chan<- prometheus.Metric) {
+	p.collect(ch, p.names())
+}
+
+func (p *PostfixCollector) describe(ch chan<- *prometheus.Desc, names []string) {
+	ch <- scrapeDurationDesc
+	ch <- scrapeSuccessDesc
+	for _, name := range names {
+		p.Collectors[name].Describe(ch)
+	}
+}
+
+func (p *PostfixCollector) collect(ch chan<- prometheus.Metric, names []string) {
+	for _, name := range names {
+		p.Collectors[name].Collect(ch)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range names {
+		r, ok := p.results[name]
+		if !ok {
+			continue
+		}
+		success := 0.0
+		if r.success {
+			success = 1
+		}
+		ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, r.duration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	}
+}
+
+// FilteredCollector implements the prometheus.Collector interface for a subset of the enabled collectors.
+type FilteredCollector struct {
+	collector *PostfixCollector
+	names     []string
+}
+
+// Names returns the names of the collectors exposed by the filter.
+func (f *FilteredCollector) Names() []string {
+	return f.names
+}
+
+// Describe implements the prometheus.Collector interface.
+func (f *FilteredCollector) Describe(ch chan<- *prometheus.Desc) {
+	f.collector.describe(ch, f.names)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (f *FilteredCollector) Collect(ch chan<- prometheus.Metric) {
+	f.collector.collect(ch, f.names)
+}
+
+// Enabled returns whether the named collector is enabled by the flags or the configuration.
+// A flag given on the command line overrides the configuration.
+func Enabled(name string, cfg *config.Config) bool {
+	enabled, ok := collectorState[name]
+	if !ok {
+		return false
+	}
+	if !collectorFlagSet[name] && cfg != nil {
+		if c := cfg.Collectors.Collector(name); c != nil && c.Enabled != nil {
+			return *c.Enabled
+		}
+	}
+	return *enabled
+}
+
+// NewPostfixCollector creates a new PostfixCollector with the enabled collectors.
+func NewPostfixCollector(opts *Options, logger log.Logger) (*PostfixCollector, error) {
+	collectors := make(map[string]Collector)
+	for name := range factories {
+		if !Enabled(name, opts.config()) {
+			continue
+		}
+		if opts.Previous != nil {
+			if c, ok := opts.Previous.Collectors[name].(Reusable); ok && c.Reusable(opts) {
+				collectors[name] = c
+				continue
+			}
+		}
+		c, err := factories[name](opts, log.With(logger, "collector", name))
+		if err != nil {
+			return nil, err
+		}
+		collectors[name] = c
+	}
+	return &PostfixCollector{
+		Collectors: collectors,
+		logInput:   opts.LogInput,
+		logger:     logger,
+		results:    make(map[string]result),
+		statuses:   make(map[string]*Status),
+	}, nil
+}
@@ -0,0 +1,210 @@
+package collector_test
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix"
+	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"testing"
+	"time"
+)
+
+// newPostfixCollector returns a PostfixCollector with the collectors enabled by args.
+func newPostfixCollector(t *testing.T, showqPath string, args ...string) *collector.PostfixCollector {
+	if _, err := kingpin.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	queue := postfix.NewPostQueue(&postfix.PostQueueOpt{ShowqPath: showqPath})
+	opts := &collector.Options{Instances: []collector.Instance{{PostQueue: queue}}}
+	c, err := collector.NewPostfixCollector(opts, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// collectorSuccess returns the value of postfix_scope_collector_success for the named collector.
+func collectorSuccess(t *testing.T, c prometheus.Collector, name string) float64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "postfix_scope_collector_success" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "collector" && label.GetValue() == name {
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return -1
+}
+
+func TestNewPostfixCollector(t *testing.T) {
+	c := newPostfixCollector(t, "")
+	if _, ok := c.Collectors["queue"]; !ok {
+		t.Errorf("expected `queue` collector is enabled by default, but actual is `%v`", c.Collectors)
+	}
+}
+
+func TestNewPostfixCollectorDisabled(t *testing.T) {
+	c := newPostfixCollector(t, "", "--no-collector.queue")
+	if _, ok := c.Collectors["queue"]; ok {
+		t.Errorf("expected `queue` collector is disabled, but actual is `%v`", c.Collectors)
+	}
+}
+
+func TestNewPostfixCollectorDisabledByConfig(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load("collectors: {queue: {enabled: false}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := collector.NewOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := collector.NewPostfixCollector(opts, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Collectors["queue"]; ok {
+		t.Errorf("expected `queue` collector is disabled, but actual is `%v`", c.Collectors)
+	}
+}
+
+func TestPostfixCollector_Update(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	showqPath, _ := mock.Serve(ctx, mock.ShowqMessageGen(3))
+
+	c := newPostfixCollector(t, showqPath)
+	c.Update(ctx)
+	if v := collectorSuccess(t, c, "queue"); v != 1 {
+		t.Errorf("expected `1`, but actual is `%v`", v)
+	}
+}
+
+func TestPostfixCollector_UpdateFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	c := newPostfixCollector(t, "/nonexistent/showq")
+	c.Update(ctx)
+	if v := collectorSuccess(t, c, "queue"); v != 0 {
+		t.Errorf("expected `0`, but actual is `%v`", v)
+	}
+}
+
+func TestPostfixCollector_UpdateWithoutLogInput(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.delivery"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, logInput := range []bool{false, true} {
+		c, err := collector.NewPostfixCollector(&collector.Options{LogInput: logInput}, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.UpdateCollector(context.Background(), "delivery")
+		if (err != nil) == logInput {
+			t.Errorf("expected the error without the log input, but actual is `%v` with log input `%v`", err, logInput)
+		}
+		expected := 0.0
+		if logInput {
+			expected = 1
+		}
+		if v := collectorSuccess(t, c, "delivery"); v != expected {
+			t.Errorf("expected `%v`, but actual is `%v`", expected, v)
+		}
+	}
+}
+
+func TestPostfixCollector_UpdateInstances(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	showqPath1, _ := mock.Serve(ctx, mock.ShowqMessageGen(3))
+	showqPath2, _ := mock.Serve(ctx, mock.ShowqMessageGen(2))
+	cfg := &config.Config{}
+	*cfg = config.DefaultConfig
+	cfg.Instances = []config.InstanceConfig{
+		{Name: "inbound", ShowqPath: showqPath1},
+		{Name: "outbound", ShowqPath: showqPath2},
+	}
+	opts, err := collector.NewOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := collector.NewPostfixCollector(opts, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Update(ctx)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]uint64)
+	for _, family := range families {
+		if family.GetName() != "postfix_queue_size_bytes" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "postfix_instance" {
+					counts[label.GetValue()] = metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	if counts["inbound"] != 3 || counts["outbound"] != 2 {
+		t.Errorf("expected `map[inbound:3 outbound:2]`, but actual is `%v`", counts)
+	}
+}
+
+func TestPostfixCollector_Filter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	showqPath, _ := mock.Serve(ctx, mock.ShowqMessageGen(3))
+	c := newPostfixCollector(t, showqPath)
+	c.Update(ctx)
+
+	filtered, err := c.Filter([]string{"queue", "queue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.Names()) != 1 {
+		t.Errorf("expected `[queue]`, but actual is `%v`", filtered.Names())
+	}
+	if v := collectorSuccess(t, filtered, "queue"); v != 1 {
+		t.Errorf("expected `1`, but actual is `%v`", v)
+	}
+
+	if _, err := c.Filter([]string{"spool"}); err == nil || err.Error() != "unknown collector `spool`" {
+		t.Errorf("expected unknown collector error, but actual is `%v`", err)
+	}
+}
+
+func TestPostfixCollector_FilterDisabled(t *testing.T) {
+	c := newPostfixCollector(t, "", "--no-collector.queue")
+	if _, err := c.Filter([]string{"queue"}); err == nil || err.Error() != "collector `queue` is not enabled" {
+		t.Errorf("expected not enabled error, but actual is `%v`", err)
+	}
+}
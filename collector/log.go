@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"errors"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// otherLabelValue replaces the label values beyond the limit of a labelLimiter.
+const otherLabelValue = "other"
+
+// errNoLogInput is the error of the log-driven collectors without a log input, which can never count anything.
+var errNoLogInput = errors.New("no log input configured")
+
+// eventHandler is a log-driven collector, which counts the events of the log input.
+type eventHandler interface {
+	HandleEvent(e *maillog.Event)
+}
+
+// Reusable is a Collector that keeps its state across reloads of the configuration.
+// Log-driven collectors count events as they arrive, so that replacing them on every reload would reset the counters.
+type Reusable interface {
+	Collector
+
+	// Reusable returns whether the collector can be kept as is with the new options.
+	Reusable(opts *Options) bool
+}
+
+// labelLimiter bounds the distinct values of a label.
+// The first values up to the limit are kept, and the others are replaced with "other".
+type labelLimiter struct {
+	limit int
+
+	mu     sync.Mutex
+	values map[string]bool
+}
+
+// value returns v if it is one of the kept values, or "other".
+func (l *labelLimiter) value(v string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.values[v] {
+		return v
+	}
+	if len(l.values) >= l.limit {
+		return otherLabelValue
+	}
+	l.values[v] = true
+	return v
+}
+
+// newLabelLimiter returns new labelLimiter that keeps up to limit values.
+func newLabelLimiter(limit int) *labelLimiter {
+	return &labelLimiter{
+		limit:  limit,
+		values: make(map[string]bool),
+	}
+}
+
+// minDecayedScore is the score below which a decayingCounter forgets a key, after ten half-lives of a single event.
+const minDecayedScore = 1.0 / 1024
+
+// decayedScore is the score of a key of a decayingCounter at a time.
+type decayedScore struct {
+	Key   string
+	Score float64
+	// Total is the number of all events of the key while it is tracked.
+	Total    uint64
+	LastSeen time.Time
+}
+
+// decayingCounter counts the events of keys with scores that halve every half-life,
+// so that a score approximates the number of the recent events of the key.
+// Up to max keys are tracked, and the key with the lowest score is forgotten beyond the limit.
+type decayingCounter struct {
+	halfLife time.Duration
+	max      int
+
+	mu      sync.Mutex
+	entries map[string]*decayedScore
+}
+
+// decay returns the score at t of the score at from.
+func (d *decayingCounter) decay(score float64, from, t time.Time) float64 {
+	if !t.After(from) {
+		return score
+	}
+	return score * math.Exp2(-float64(t.Sub(from))/float64(d.halfLife))
+}
+
+// add counts an event of the key at t.
+func (d *decayingCounter) add(key string, t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[key]
+	if !ok {
+		if len(d.entries) >= d.max {
+			d.evict(t)
+		}
+		d.entries[key] = &decayedScore{Key: key, Score: 1, Total: 1, LastSeen: t}
+		return
+	}
+	if t.After(e.LastSeen) {
+		e.Score = d.decay(e.Score, e.LastSeen, t) + 1
+		e.LastSeen = t
+	} else {
+		e.Score += d.decay(1, t, e.LastSeen)
+	}
+	e.Total++
+}
+
+// evict forgets the key with the lowest score at t.
+func (d *decayingCounter) evict(t time.Time) {
+	var lowest *decayedScore
+	var lowestScore float64
+	for _, e := range d.entries {
+		score := d.decay(e.Score, e.LastSeen, t)
+		if lowest == nil || score < lowestScore {
+			lowest, lowestScore = e, score
+		}
+	}
+	if lowest != nil {
+		delete(d.entries, lowest.Key)
+	}
+}
+
+// top returns up to n keys in descending order of the scores at now.
+// Keys whose scores have decayed below minDecayedScore are forgotten.
+func (d *decayingCounter) top(n int, now time.Time) []decayedScore {
+	d.mu.Lock()
+	scores := make([]decayedScore, 0, len(d.entries))
+	for key, e := range d.entries {
+		s := *e
+		s.Score = d.decay(e.Score, e.LastSeen, now)
+		if s.Score < minDecayedScore {
+			delete(d.entries, key)
+			continue
+		}
+		scores = append(scores, s)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Key < scores[j].Key
+	})
+	if len(scores) > n {
+		scores = scores[:n]
+	}
+	return scores
+}
+
+// newDecayingCounter returns new decayingCounter whose scores halve every halfLife, and that tracks up to max keys.
+func newDecayingCounter(halfLife time.Duration, max int) *decayingCounter {
+	return &decayingCounter{
+		halfLife: halfLife,
+		max:      max,
+		entries:  make(map[string]*decayedScore),
+	}
+}
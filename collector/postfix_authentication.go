@@ -0,0 +1,233 @@
+package collector
+
+import (
+	"container/list"
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerCollector("authentication", defaultDisabled, NewPostfixAuthenticationCollector)
+}
+
+// authParsers parse the SPF, DKIM and DMARC results by the process name of the log.
+var authParsers = map[string]func(string) (*maillog.AuthResult, bool){
+	"policyd-spf": maillog.ParseSPF,
+	"opendkim":    maillog.ParseDKIM,
+	"opendmarc":   maillog.ParseDMARC,
+}
+
+// pendingAuth is the results of a queue ID without the domain, waiting for qmgr to know the sender domain.
+type pendingAuth struct {
+	queueID  string
+	results  []*maillog.AuthResult
+	received time.Time
+}
+
+// PostfixAuthenticationCollector counts the SPF results of policyd-spf, the DKIM results of opendkim
+// and the DMARC results of opendmarc in the log input, by the domain.
+// The results of a queue ID without the domain are counted by the sender domain when qmgr logs the message,
+// or without the domain when qmgr does not log it for the timeout by the time of the log.
+type PostfixAuthenticationCollector struct {
+	cfg     config.AuthenticationCollectorConfig
+	domains *labelLimiter
+	logger  log.Logger
+
+	mu sync.Mutex
+	// pending are the queue IDs waiting for qmgr, in the order of the time of the first result from the front.
+	pending      map[string]*list.Element
+	pendingOrder *list.List
+	// latest is the time of the newest event seen.
+	latest time.Time
+
+	// metrics
+	resultsCounter    *prometheus.CounterVec
+	policiesCounter   *prometheus.CounterVec
+	signaturesCounter *prometheus.CounterVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixAuthenticationCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the authentication result of the event, or the pending results of the queue ID of qmgr.
+func (c *PostfixAuthenticationCollector) HandleEvent(e *maillog.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e.Time.After(c.latest) {
+		c.latest = e.Time
+	}
+	c.expirePending()
+
+	if e.IsPostfix() {
+		if e.Process != "qmgr" || e.QueueID == "" {
+			return
+		}
+		active, ok := maillog.ParseActive(e.Payload)
+		if !ok {
+			return
+		}
+		elem, ok := c.pending[e.QueueID]
+		if !ok {
+			return
+		}
+		p := c.removePending(elem)
+		domain := ""
+		if i := strings.LastIndexByte(active.From, '@'); i >= 0 {
+			domain = strings.ToLower(active.From[i+1:])
+		}
+		for _, r := range p.results {
+			c.count(r, domain)
+		}
+		return
+	}
+
+	if e.Process == "opendkim" {
+		if domain, ok := maillog.ParseDKIMSignature(e.Payload); ok {
+			c.signaturesCounter.WithLabelValues(c.domains.value(domain)).Inc()
+			return
+		}
+	}
+	parse, ok := authParsers[e.Process]
+	if !ok {
+		return
+	}
+	r, ok := parse(e.Payload)
+	if !ok {
+		return
+	}
+	if r.Domain != "" || e.QueueID == "" {
+		c.count(r, r.Domain)
+		return
+	}
+
+	elem, ok := c.pending[e.QueueID]
+	if !ok {
+		if len(c.pending) >= c.cfg.MaxPending {
+			c.flushPending(c.pendingOrder.Front())
+		}
+		elem = c.addPending(&pendingAuth{queueID: e.QueueID, received: e.Time})
+	}
+	p := elem.Value.(*pendingAuth)
+	p.results = append(p.results, r)
+}
+
+// count counts the result for the domain.
+func (c *PostfixAuthenticationCollector) count(r *maillog.AuthResult, domain string) {
+	if domain != "" {
+		domain = c.domains.value(domain)
+	}
+	c.resultsCounter.WithLabelValues(r.Method, r.Result, domain).Inc()
+	if r.Policy != "" {
+		c.policiesCounter.WithLabelValues(r.Policy, domain).Inc()
+	}
+}
+
+// addPending adds the queue ID waiting for qmgr behind the ones received before it.
+// The lines are mostly in order, so that it is added to the back or near it.
+func (c *PostfixAuthenticationCollector) addPending(p *pendingAuth) *list.Element {
+	mark := c.pendingOrder.Back()
+	for mark != nil && mark.Value.(*pendingAuth).received.After(p.received) {
+		mark = mark.Prev()
+	}
+	var elem *list.Element
+	if mark == nil {
+		elem = c.pendingOrder.PushFront(p)
+	} else {
+		elem = c.pendingOrder.InsertAfter(p, mark)
+	}
+	c.pending[p.queueID] = elem
+	return elem
+}
+
+// removePending forgets the queue ID waiting for qmgr, and returns its results.
+func (c *PostfixAuthenticationCollector) removePending(elem *list.Element) *pendingAuth {
+	p := c.pendingOrder.Remove(elem).(*pendingAuth)
+	delete(c.pending, p.queueID)
+	return p
+}
+
+// flushPending counts the results of the queue ID waiting for qmgr without the domain.
+func (c *PostfixAuthenticationCollector) flushPending(elem *list.Element) {
+	for _, r := range c.removePending(elem).results {
+		c.count(r, "")
+	}
+}
+
+// expirePending flushes the queue IDs waiting for qmgr for the pending timeout before the newest event.
+func (c *PostfixAuthenticationCollector) expirePending() {
+	deadline := c.latest.Add(-time.Duration(c.cfg.PendingTimeout))
+	for elem := c.pendingOrder.Front(); elem != nil; elem = c.pendingOrder.Front() {
+		if !elem.Value.(*pendingAuth).received.Before(deadline) {
+			return
+		}
+		c.flushPending(elem)
+	}
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixAuthenticationCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.Authentication
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixAuthenticationCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.resultsCounter.Describe(ch)
+	c.policiesCounter.Describe(ch)
+	c.signaturesCounter.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixAuthenticationCollector) Collect(ch chan<- prometheus.Metric) {
+	c.resultsCounter.Collect(ch)
+	c.policiesCounter.Collect(ch)
+	c.signaturesCounter.Collect(ch)
+}
+
+// NewPostfixAuthenticationCollector returns new PostfixAuthenticationCollector.
+func NewPostfixAuthenticationCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.Authentication
+	return &PostfixAuthenticationCollector{
+		cfg:          cfg,
+		domains:      newLabelLimiter(cfg.MaxDomains),
+		logger:       logger,
+		pending:      make(map[string]*list.Element),
+		pendingOrder: list.New(),
+		resultsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "authentication",
+				Name:      "results_total",
+				Help:      "Total number of SPF, DKIM and DMARC results of inbound messages, by method, result and domain.",
+			},
+			[]string{"method", "result", "domain"}),
+		policiesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "authentication",
+				Name:      "dmarc_policies_total",
+				Help:      "Total number of DMARC policies of the domains applied to inbound messages, by policy and domain.",
+			},
+			[]string{"policy", "domain"}),
+		signaturesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "authentication",
+				Name:      "dkim_signatures_total",
+				Help:      "Total number of DKIM signatures added by opendkim, by signing domain.",
+			},
+			[]string{"domain"}),
+	}, nil
+}
@@ -0,0 +1,79 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostfixAuthenticationCollector_HandleEvent(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.Authentication.MaxDomains = 2
+	cfg.Collectors.Authentication.MaxPending = 1
+	c, err := collector.NewPostfixAuthenticationCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mx policyd-spf[1]: prepend Received-SPF: Pass (mailfrom) identity=mailfrom; client-ip=192.0.2.1; helo=mail.example.com; envelope-from=sender@example.com; receiver=<UNKNOWN>",
+		"Apr  1 12:00:00 mx policyd-spf[1]: prepend Received-SPF: Softfail (domain owner discourages use of this host) identity=mailfrom; client-ip=192.0.2.2; helo=mail.example.org; envelope-from=sender@example.org; receiver=<UNKNOWN>",
+		// The first queue ID is counted without the domain when the second one exceeds max_pending.
+		"Apr  1 12:00:01 mx opendkim[2]: 4F9D195432C: DKIM verification successful",
+		"Apr  1 12:00:02 mx opendkim[2]: 4F9D195432D: bad signature data",
+		"Apr  1 12:00:02 mx postfix/qmgr[3]: 4F9D195432D: from=<sender@Example.com>, size=1234, nrcpt=1 (queue active)",
+		"Apr  1 12:00:03 mx postfix/qmgr[3]: 4F9D195432C: from=<sender@example.com>, size=1234, nrcpt=1 (queue active)",
+		"Apr  1 12:00:02 mx opendmarc[4]: 4F9D195432D: example.com pass",
+		"Apr  1 12:00:04 mx opendmarc[4]: 4F9D195432E: example.net fail (policy=reject)",
+		"Apr  1 12:00:05 mx opendkim[2]: 4F9D195432F: DKIM-Signature field added (s=mail, d=example.com)",
+	)
+
+	expected := `
+# HELP postfix_authentication_dkim_signatures_total Total number of DKIM signatures added by opendkim, by signing domain.
+# TYPE postfix_authentication_dkim_signatures_total counter
+postfix_authentication_dkim_signatures_total{domain="example.com"} 1
+# HELP postfix_authentication_dmarc_policies_total Total number of DMARC policies of the domains applied to inbound messages, by policy and domain.
+# TYPE postfix_authentication_dmarc_policies_total counter
+postfix_authentication_dmarc_policies_total{domain="other",policy="reject"} 1
+# HELP postfix_authentication_results_total Total number of SPF, DKIM and DMARC results of inbound messages, by method, result and domain.
+# TYPE postfix_authentication_results_total counter
+postfix_authentication_results_total{domain="",method="dkim",result="pass"} 1
+postfix_authentication_results_total{domain="example.com",method="dkim",result="fail"} 1
+postfix_authentication_results_total{domain="example.com",method="dmarc",result="pass"} 1
+postfix_authentication_results_total{domain="example.com",method="spf",result="pass"} 1
+postfix_authentication_results_total{domain="example.org",method="spf",result="softfail"} 1
+postfix_authentication_results_total{domain="other",method="dmarc",result="fail"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostfixAuthenticationCollector_PendingTimeout(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.Authentication.PendingTimeout = model.Duration(time.Hour)
+	c, err := collector.NewPostfixAuthenticationCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		// The message rejected by the milter never reaches qmgr.
+		"Apr  1 12:00:00 mx opendkim[2]: 4F9D195432C: bad signature data",
+		"Apr  1 12:30:00 mx opendkim[2]: 4F9D195432D: DKIM verification successful",
+		"Apr  1 13:15:00 mx postfix/qmgr[3]: 4F9D195432D: from=<sender@example.com>, size=1234, nrcpt=1 (queue active)",
+	)
+
+	expected := `
+# HELP postfix_authentication_results_total Total number of SPF, DKIM and DMARC results of inbound messages, by method, result and domain.
+# TYPE postfix_authentication_results_total counter
+postfix_authentication_results_total{domain="",method="dkim",result="fail"} 1
+postfix_authentication_results_total{domain="example.com",method="dkim",result="pass"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "postfix_authentication_results_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"hash/fnv"
+	"reflect"
+	"regexp"
+)
+
+func init() {
+	registerCollector("checks", defaultDisabled, NewPostfixChecksCollector)
+}
+
+// checkRule names the rule of the actions whose matched line matches.
+type checkRule struct {
+	name  string
+	regex *regexp.Regexp
+}
+
+// PostfixChecksCollector counts the actions of header_checks, body_checks, mime_header_checks and nested_header_checks of cleanup
+// in the log input, by the rule.
+type PostfixChecksCollector struct {
+	cfg    config.ChecksCollectorConfig
+	rules  []checkRule
+	names  *labelLimiter
+	logger log.Logger
+
+	// metrics
+	actionsCounter *prometheus.CounterVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixChecksCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the action of the checks of the event.
+func (c *PostfixChecksCollector) HandleEvent(e *maillog.Event) {
+	if !e.IsPostfix() || e.Process != "cleanup" {
+		return
+	}
+	a, ok := maillog.ParseCheckAction(e.Payload)
+	if !ok {
+		return
+	}
+	c.actionsCounter.WithLabelValues(a.Action, a.Class, c.names.value(c.rule(a))).Inc()
+}
+
+// rule returns the name of the rule in the configuration that matches the line of the action, or the hash of the matched line.
+// Unlike the name, the hash is a label per distinct line, which differs by message for most rules (e.g. /^Subject:.*viagra/).
+func (c *PostfixChecksCollector) rule(a *maillog.CheckAction) string {
+	for _, rule := range c.rules {
+		if rule.regex.MatchString(a.Content) {
+			return rule.name
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(a.Content))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixChecksCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.Checks
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixChecksCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.actionsCounter.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixChecksCollector) Collect(ch chan<- prometheus.Metric) {
+	c.actionsCounter.Collect(ch)
+}
+
+// NewPostfixChecksCollector returns new PostfixChecksCollector.
+func NewPostfixChecksCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.Checks
+	var rules []checkRule
+	for _, rule := range cfg.Rules {
+		rules = append(rules, checkRule{name: rule.Name, regex: rule.Match.Regexp})
+	}
+
+	return &PostfixChecksCollector{
+		cfg:    cfg,
+		rules:  rules,
+		names:  newLabelLimiter(cfg.MaxRules),
+		logger: logger,
+		actionsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "cleanup",
+				Name:      "check_actions_total",
+				Help:      "Total number of actions of header_checks and body_checks of cleanup, by action, class (header, body, mime-header or nested-header) and rule.",
+			},
+			[]string{"action", "class", "rule"}),
+	}, nil
+}
@@ -0,0 +1,43 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPostfixChecksCollector_HandleEvent(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.Checks.Rules = []config.CheckRuleConfig{{Name: "viagra_subject", Match: &config.Regexp{Regexp: regexp.MustCompile(`^Subject:.*viagra`)}}}
+	cfg.Collectors.Checks.MaxRules = 3
+	c, err := collector.NewPostfixChecksCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mx postfix/cleanup[1]: 4F9D195432C: reject: header Subject: buy viagra now from unknown[192.0.2.1]; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>: 5.7.1 Spam",
+		// The named rule counts the different lines that it matches as one.
+		"Apr  1 12:00:00 mx postfix/cleanup[1]: 4F9D1954331: reject: header Subject: cheap viagra from unknown[192.0.2.4]; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>: 5.7.1 Spam",
+		"Apr  1 12:00:00 mx postfix/cleanup[1]: 4F9D195432D: reject: body Verify your account at http://phish.example from unknown[192.0.2.2]; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>: 5.7.1 Phishing",
+		// The lines without the named rule are labelled by each line, even with the same action and text.
+		"Apr  1 12:00:00 mx postfix/cleanup[1]: 4F9D195432E: reject: body Verify your password at http://phish.example from unknown[192.0.2.3]; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>: 5.7.1 Phishing",
+		"Apr  1 12:00:00 mx postfix/cleanup[1]: 4F9D195432F: hold: header X-Mailer: bulk from local; from=<sender@example.com> to=<user@example.com>",
+		"Apr  1 12:00:00 mx postfix/cleanup[1]: 4F9D1954330: message-id=<1@example.com>",
+	)
+
+	expected := `
+# HELP postfix_cleanup_check_actions_total Total number of actions of header_checks and body_checks of cleanup, by action, class (header, body, mime-header or nested-header) and rule.
+# TYPE postfix_cleanup_check_actions_total counter
+postfix_cleanup_check_actions_total{action="hold",class="header",rule="other"} 1
+postfix_cleanup_check_actions_total{action="reject",class="body",rule="176d33ef"} 1
+postfix_cleanup_check_actions_total{action="reject",class="body",rule="dfcaa8ab"} 1
+postfix_cleanup_check_actions_total{action="reject",class="header",rule="viagra_subject"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"reflect"
+)
+
+func init() {
+	registerCollector("content_filter", defaultDisabled, NewPostfixContentFilterCollector)
+}
+
+// contentFilterParsers parse the verdicts of the content filters by the process name of the log.
+var contentFilterParsers = map[string]func(string) (*maillog.FilterVerdict, bool){
+	"amavis":        maillog.ParseAmavis,
+	"amavisd":       maillog.ParseAmavis,
+	"rspamd":        maillog.ParseRspamd,
+	"spamd":         maillog.ParseSpamd,
+	"clamav-milter": maillog.ParseClamavMilter,
+}
+
+// PostfixContentFilterCollector counts the verdicts of the content filters (amavis, rspamd, SpamAssassin and clamav-milter),
+// and the actions and the timeouts of the milters of smtpd and cleanup, in the log input.
+type PostfixContentFilterCollector struct {
+	cfg    config.ContentFilterCollectorConfig
+	logger log.Logger
+
+	// metrics
+	verdictsCounter       *prometheus.CounterVec
+	scanHistogram         *prometheus.HistogramVec
+	milterActionsCounter  *prometheus.CounterVec
+	milterTimeoutsCounter *prometheus.CounterVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixContentFilterCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the verdict of the content filter, or the milter action or timeout of the event.
+func (c *PostfixContentFilterCollector) HandleEvent(e *maillog.Event) {
+	if !e.IsPostfix() {
+		parse, ok := contentFilterParsers[e.Process]
+		if !ok {
+			return
+		}
+		v, ok := parse(e.Payload)
+		if !ok {
+			return
+		}
+		c.verdictsCounter.WithLabelValues(v.Filter, v.Verdict, v.Action).Inc()
+		if v.ScanTime > 0 {
+			c.scanHistogram.WithLabelValues(v.Filter).Observe(v.ScanTime.Seconds())
+		}
+		return
+	}
+	if e.Process != "smtpd" && e.Process != "cleanup" {
+		return
+	}
+	if a, ok := maillog.ParseMilterAction(e.Payload); ok {
+		c.milterActionsCounter.WithLabelValues(e.Service, a.Action, a.Stage).Inc()
+		return
+	}
+	if w, ok := maillog.ParseMilterWarning(e.Payload); ok && w.Timeout() {
+		c.milterTimeoutsCounter.WithLabelValues(e.Service, w.Milter).Inc()
+	}
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixContentFilterCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.ContentFilter
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixContentFilterCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.verdictsCounter.Describe(ch)
+	c.scanHistogram.Describe(ch)
+	c.milterActionsCounter.Describe(ch)
+	c.milterTimeoutsCounter.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixContentFilterCollector) Collect(ch chan<- prometheus.Metric) {
+	c.verdictsCounter.Collect(ch)
+	c.scanHistogram.Collect(ch)
+	c.milterActionsCounter.Collect(ch)
+	c.milterTimeoutsCounter.Collect(ch)
+}
+
+// NewPostfixContentFilterCollector returns new PostfixContentFilterCollector.
+func NewPostfixContentFilterCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.ContentFilter
+	return &PostfixContentFilterCollector{
+		cfg:    cfg,
+		logger: logger,
+		verdictsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "content_filter",
+				Name:      "verdicts_total",
+				Help:      "Total number of messages scanned by the content filters, by filter, verdict (e.g. clean, spam or infected) and action (e.g. passed, blocked or reject).",
+			},
+			[]string{"filter", "verdict", "action"}),
+		scanHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "content_filter",
+				Name:      "scan_duration_seconds",
+				Help:      "Time that the content filters took to scan a message, by filter.",
+				Buckets:   cfg.ScanBuckets,
+			},
+			[]string{"filter"}),
+		milterActionsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "milter",
+				Name:      "actions_total",
+				Help:      "Total number of milter actions applied by smtpd and cleanup, by action (reject, discard, hold or redirect) and stage.",
+			},
+			[]string{"service", "action", "stage"}),
+		milterTimeoutsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "milter",
+				Name:      "timeouts_total",
+				Help:      "Total number of milters that did not respond in time, by milter.",
+			},
+			[]string{"service", "milter"}),
+	}, nil
+}
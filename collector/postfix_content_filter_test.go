@@ -0,0 +1,70 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+func TestPostfixContentFilterCollector_HandleEvent(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.ContentFilter.ScanBuckets = []float64{0.1, 1}
+	c, err := collector.NewPostfixContentFilterCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mx amavis[1]: (01234-05) Passed CLEAN {RelayedInbound}, [192.0.2.1]:12345 [192.0.2.1] <sender@example.com> -> <user@example.com>, Queue-ID: 4F9D195432C, size: 1234, queued_as: 5A0B1954330, 50 ms",
+		"Apr  1 12:00:00 mx amavis[1]: (01234-06) Blocked SPAM {DiscardedInbound,Quarantined}, [192.0.2.2]:12345 [192.0.2.2] <sender@example.com> -> <user@example.com>, Queue-ID: 4F9D195432D, 2500 ms",
+		"Apr  1 12:00:00 mx rspamd[2]: <8f1c2a>; task; rspamd_task_write_log: id: <1@example.com>, qid: <4F9D195432E>, ip: 192.0.2.3, (default: T (reject): [16.20/15.00] []), len: 1234, time: 500.000ms, dns req: 12",
+		"Apr  1 12:00:00 mx spamd[3]: spamd: result: . -1 - ALL_TRUSTED scantime=0.3,size=1234,user=amavis",
+		"Apr  1 12:00:00 mx clamav-milter[4]: Message 4F9D195432F from <sender@example.com> to <user@example.com> infected by Eicar-Test-Signature",
+		"Apr  1 12:00:00 mx postfix/cleanup[5]: 4F9D195432E: milter-reject: END-OF-MESSAGE from unknown[192.0.2.3]: 5.7.1 Spam message rejected; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+		"Apr  1 12:00:00 mx postfix/smtpd[6]: NOQUEUE: milter-reject: RCPT from unknown[192.0.2.4]: 451 4.7.1 Try again later; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+		"Apr  1 12:00:00 mx postfix/cleanup[5]: 4F9D1954330: milter-hold: END-OF-MESSAGE from unknown[192.0.2.5]: milter triggers HOLD action; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+		"Apr  1 12:00:00 mx postfix/smtpd[6]: warning: milter inet:127.0.0.1:11332: can't read SMFIC_BODYEOB reply packet header: Connection timed out",
+		"Apr  1 12:00:00 mx postfix/smtpd[6]: warning: milter unix:/run/opendkim/opendkim.sock: read error in initial handshake",
+		"Apr  1 12:00:00 mx postfix/smtpd[6]: NOQUEUE: reject: RCPT from unknown[192.0.2.6]: 554 5.7.1 <user@example.com>: Relay access denied; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+	)
+
+	expected := `
+# HELP postfix_content_filter_scan_duration_seconds Time that the content filters took to scan a message, by filter.
+# TYPE postfix_content_filter_scan_duration_seconds histogram
+postfix_content_filter_scan_duration_seconds_bucket{filter="amavis",le="0.1"} 1
+postfix_content_filter_scan_duration_seconds_bucket{filter="amavis",le="1"} 1
+postfix_content_filter_scan_duration_seconds_bucket{filter="amavis",le="+Inf"} 2
+postfix_content_filter_scan_duration_seconds_sum{filter="amavis"} 2.55
+postfix_content_filter_scan_duration_seconds_count{filter="amavis"} 2
+postfix_content_filter_scan_duration_seconds_bucket{filter="rspamd",le="0.1"} 0
+postfix_content_filter_scan_duration_seconds_bucket{filter="rspamd",le="1"} 1
+postfix_content_filter_scan_duration_seconds_bucket{filter="rspamd",le="+Inf"} 1
+postfix_content_filter_scan_duration_seconds_sum{filter="rspamd"} 0.5
+postfix_content_filter_scan_duration_seconds_count{filter="rspamd"} 1
+postfix_content_filter_scan_duration_seconds_bucket{filter="spamassassin",le="0.1"} 0
+postfix_content_filter_scan_duration_seconds_bucket{filter="spamassassin",le="1"} 1
+postfix_content_filter_scan_duration_seconds_bucket{filter="spamassassin",le="+Inf"} 1
+postfix_content_filter_scan_duration_seconds_sum{filter="spamassassin"} 0.3
+postfix_content_filter_scan_duration_seconds_count{filter="spamassassin"} 1
+# HELP postfix_content_filter_verdicts_total Total number of messages scanned by the content filters, by filter, verdict (e.g. clean, spam or infected) and action (e.g. passed, blocked or reject).
+# TYPE postfix_content_filter_verdicts_total counter
+postfix_content_filter_verdicts_total{action="",filter="clamav",verdict="infected"} 1
+postfix_content_filter_verdicts_total{action="",filter="spamassassin",verdict="clean"} 1
+postfix_content_filter_verdicts_total{action="blocked",filter="amavis",verdict="spam"} 1
+postfix_content_filter_verdicts_total{action="passed",filter="amavis",verdict="clean"} 1
+postfix_content_filter_verdicts_total{action="reject",filter="rspamd",verdict="spam"} 1
+# HELP postfix_milter_actions_total Total number of milter actions applied by smtpd and cleanup, by action (reject, discard, hold or redirect) and stage.
+# TYPE postfix_milter_actions_total counter
+postfix_milter_actions_total{action="hold",service="postfix/cleanup",stage="END-OF-MESSAGE"} 1
+postfix_milter_actions_total{action="reject",service="postfix/cleanup",stage="END-OF-MESSAGE"} 1
+postfix_milter_actions_total{action="reject",service="postfix/smtpd",stage="RCPT"} 1
+# HELP postfix_milter_timeouts_total Total number of milters that did not respond in time, by milter.
+# TYPE postfix_milter_timeouts_total counter
+postfix_milter_timeouts_total{milter="inet:127.0.0.1:11332",service="postfix/smtpd"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"reflect"
+)
+
+func init() {
+	registerCollector("delivery", defaultDisabled, NewPostfixDeliveryCollector)
+}
+
+// deliveryStages are the parts of delays=a/b/c/d in order.
+var deliveryStages = []string{"before_qmgr", "in_qmgr", "connection_setup", "transmission"}
+
+// PostfixDeliveryCollector counts the delivery status lines of the delivery agents (smtp, lmtp, local, virtual, pipe, ...)
+// in the log input.
+type PostfixDeliveryCollector struct {
+	cfg    config.DeliveryCollectorConfig
+	relays *labelLimiter
+	logger log.Logger
+
+	// metrics
+	statusCounter        *prometheus.CounterVec
+	delayHistogram       *prometheus.HistogramVec
+	stageDelaysHistogram *prometheus.HistogramVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixDeliveryCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the delivery status of the event.
+func (c *PostfixDeliveryCollector) HandleEvent(e *maillog.Event) {
+	if !e.IsPostfix() || e.QueueID == "" {
+		return
+	}
+	d, ok := maillog.ParseDelivery(e.Payload)
+	if !ok {
+		return
+	}
+	switch d.Status {
+	case "sent", "deferred", "bounced", "expired":
+	default:
+		return
+	}
+
+	relay := d.RelayHost()
+	if relay != "" {
+		relay = c.relays.value(relay)
+	}
+	c.statusCounter.WithLabelValues(e.Process, relay, d.Status, d.DSNClass()).Inc()
+
+	transport := e.Transport()
+	if d.Delay >= 0 {
+		c.delayHistogram.WithLabelValues(transport).Observe(d.Delay)
+	}
+	for i, delay := range d.Delays {
+		c.stageDelaysHistogram.WithLabelValues(transport, deliveryStages[i]).Observe(delay)
+	}
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixDeliveryCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.Delivery
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixDeliveryCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.statusCounter.Describe(ch)
+	c.delayHistogram.Describe(ch)
+	c.stageDelaysHistogram.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixDeliveryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.statusCounter.Collect(ch)
+	c.delayHistogram.Collect(ch)
+	c.stageDelaysHistogram.Collect(ch)
+}
+
+// NewPostfixDeliveryCollector returns new PostfixDeliveryCollector.
+func NewPostfixDeliveryCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.Delivery
+	return &PostfixDeliveryCollector{
+		cfg:    cfg,
+		relays: newLabelLimiter(cfg.MaxRelays),
+		logger: logger,
+		statusCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "delivery",
+				Name:      "status_total",
+				Help:      "Total number of delivery attempts by delivery agent, relay, status and DSN class.",
+			},
+			[]string{"agent", "relay", "status", "dsn_class"}),
+		delayHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "delivery",
+				Name:      "delay_seconds",
+				Help:      "Time from the arrival of the message to the delivery attempt, in seconds.",
+				Buckets:   cfg.DelayBuckets,
+			},
+			[]string{"transport"}),
+		stageDelaysHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "delivery",
+				Name:      "stage_delay_seconds",
+				Help:      "Time of the delivery attempt by stage of delays=a/b/c/d: before_qmgr, in_qmgr, connection_setup and transmission, in seconds.",
+				Buckets:   cfg.DelayBuckets,
+			},
+			[]string{"transport", "stage"}),
+	}, nil
+}
@@ -0,0 +1,117 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"strings"
+	"testing"
+)
+
+// eventHandler is a collector driven by the log input.
+type eventHandler interface {
+	collector.Collector
+	HandleEvent(e *maillog.Event)
+}
+
+// handleLines parses the lines and passes the events to the collector.
+func handleLines(t *testing.T, c collector.Collector, lines ...string) {
+	t.Helper()
+	h, ok := c.(eventHandler)
+	if !ok {
+		t.Fatalf("expected a handler of events, but actual is `%T`", c)
+	}
+	for _, line := range lines {
+		e, err := maillog.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.HandleEvent(e)
+	}
+}
+
+func TestPostfixDeliveryCollector_HandleEvent(t *testing.T) {
+	c, err := collector.NewPostfixDeliveryCollector(&collector.Options{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mail postfix/smtp[1]: 3F8C41A2B3: to=<user@example.com>, relay=mx.example.com[192.0.2.1]:25, delay=1.2, delays=0.1/0/0.5/0.6, dsn=2.0.0, status=sent (250 2.0.0 OK)",
+		"Apr  1 12:00:00 mail postfix/relay/smtp[1]: 3F8C41A2B4: to=<user@example.net>, relay=mx.example.net[192.0.2.2]:25, delay=30, delays=0/0/30/0, dsn=4.4.1, status=deferred (connect to mx.example.net[192.0.2.2]:25: Connection timed out)",
+		"Apr  1 12:00:00 mail postfix/local[1]: 3F8C41A2B5: to=<nobody@example.com>, relay=local, delay=0.01, delays=0/0/0/0.01, dsn=5.1.1, status=bounced (unknown user: \"nobody\")",
+		"Apr  1 12:00:00 mail postfix/qmgr[1]: 3F8C41A2B6: from=<sender@example.com>, status=expired, returned to sender",
+		"Apr  1 12:00:00 mail postfix/qmgr[1]: 3F8C41A2B6: from=<sender@example.com>, size=1234, nrcpt=1 (queue active)",
+	)
+
+	expected := `
+# HELP postfix_delivery_status_total Total number of delivery attempts by delivery agent, relay, status and DSN class.
+# TYPE postfix_delivery_status_total counter
+postfix_delivery_status_total{agent="local",dsn_class="5",relay="local",status="bounced"} 1
+postfix_delivery_status_total{agent="qmgr",dsn_class="",relay="",status="expired"} 1
+postfix_delivery_status_total{agent="smtp",dsn_class="2",relay="mx.example.com",status="sent"} 1
+postfix_delivery_status_total{agent="smtp",dsn_class="4",relay="mx.example.net",status="deferred"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "postfix_delivery_status_total"); err != nil {
+		t.Error(err)
+	}
+	// delay of smtp, relay and local, and 4 stages of each
+	if n := testutil.CollectAndCount(c); n != 4+3+3*4 {
+		t.Errorf("expected `%d`, but actual is `%d`", 4+3+3*4, n)
+	}
+}
+
+func TestPostfixDeliveryCollector_MaxRelays(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.Delivery.MaxRelays = 1
+	c, err := collector.NewPostfixDeliveryCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mail postfix/smtp[1]: 3F8C41A2B3: to=<a@example.com>, relay=mx.example.com[192.0.2.1]:25, dsn=2.0.0, status=sent (250 OK)",
+		"Apr  1 12:00:00 mail postfix/smtp[1]: 3F8C41A2B4: to=<b@example.net>, relay=mx.example.net[192.0.2.2]:25, dsn=2.0.0, status=sent (250 OK)",
+		"Apr  1 12:00:00 mail postfix/smtp[1]: 3F8C41A2B5: to=<c@example.com>, relay=mx.example.com[192.0.2.1]:25, dsn=2.0.0, status=sent (250 OK)",
+	)
+
+	expected := `
+# HELP postfix_delivery_status_total Total number of delivery attempts by delivery agent, relay, status and DSN class.
+# TYPE postfix_delivery_status_total counter
+postfix_delivery_status_total{agent="smtp",dsn_class="2",relay="mx.example.com",status="sent"} 2
+postfix_delivery_status_total{agent="smtp",dsn_class="2",relay="other",status="sent"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "postfix_delivery_status_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewPostfixCollector_Reusable(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.delivery"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig
+	previous, err := collector.NewPostfixCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := collector.NewPostfixCollector(&collector.Options{Config: &cfg, Previous: previous}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Collectors["delivery"] != previous.Collectors["delivery"] {
+		t.Error("expected the delivery collector is kept, but actual is replaced")
+	}
+
+	changed := config.DefaultConfig
+	changed.Collectors.Delivery.MaxRelays = 1
+	c, err = collector.NewPostfixCollector(&collector.Options{Config: &changed, Previous: previous}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Collectors["delivery"] == previous.Collectors["delivery"] {
+		t.Error("expected the delivery collector is replaced, but actual is kept")
+	}
+}
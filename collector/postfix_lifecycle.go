@@ -0,0 +1,384 @@
+package collector
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/k-kinzal/postfix-prometheus-exporter/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerCollector("lifecycle", defaultDisabled, NewPostfixLifecycleCollector)
+}
+
+// MessageEvent is an event in the timeline of a message.
+type MessageEvent struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	// Event is one of received, queued, active, delivery, expired, notification, removed and other.
+	Event string `json:"event"`
+	// Text is the log message with the addresses masked.
+	Text string `json:"text"`
+}
+
+// MessageLifecycle is a message assembled from the log lines of smtpd, pickup, cleanup, qmgr, the delivery agents and bounce
+// that share its queue ID.
+type MessageLifecycle struct {
+	QueueID   string `json:"queue_id"`
+	Client    string `json:"client,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	From      string `json:"from,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Nrcpt     int    `json:"nrcpt,omitempty"`
+	// Attempts is the number of times qmgr moved the message to the active queue to deliver it.
+	Attempts int `json:"attempts"`
+	// Status is the last delivery status while the message is in flight,
+	// and one of sent, bounced, expired and unknown after it is removed.
+	Status string `json:"status,omitempty"`
+	// BounceQueueID is the queue ID of the notification that bounce sent for the message,
+	// and BounceOf is the queue ID of the message that the notification is sent for.
+	BounceQueueID string         `json:"bounce_queue_id,omitempty"`
+	BounceOf      string         `json:"bounce_of,omitempty"`
+	FirstSeen     time.Time      `json:"first_seen"`
+	Removed       *time.Time     `json:"removed,omitempty"`
+	Events        []MessageEvent `json:"events"`
+	// DroppedEvents is the number of the events after the limit of the timeline.
+	DroppedEvents int `json:"dropped_events,omitempty"`
+}
+
+// lifecycleEntry is a message in flight.
+type lifecycleEntry struct {
+	message *MessageLifecycle
+	// received is true if the message is seen from its arrival, so that its latency is known.
+	received bool
+	sent     bool
+	bounced  bool
+	expired  bool
+	lastSeen time.Time
+}
+
+// status returns the final status of the message.
+func (e *lifecycleEntry) status() string {
+	switch {
+	case e.expired:
+		return "expired"
+	case e.bounced:
+		return "bounced"
+	case e.sent:
+		return "sent"
+	default:
+		return "unknown"
+	}
+}
+
+// PostfixLifecycleCollector correlates the log lines of each queue ID in the log input into the lifecycle of the message,
+// and observes the end-to-end latency and the delivery attempts of the removed messages.
+// The messages in flight are bounded, and the orphans whose lines are lost are evicted by the time of the log.
+type PostfixLifecycleCollector struct {
+	cfg    config.LifecycleCollectorConfig
+	mask   func(string) string
+	logger log.Logger
+
+	mu sync.Mutex
+	// inflight are the messages in flight by queue ID, in the order of the time of the last event from the front.
+	inflight      map[string]*list.Element
+	inflightOrder *list.List
+	// completed are the removed messages by queue ID, in the order of the removal from the front.
+	completed      map[string]*MessageLifecycle
+	completedOrder *list.List
+	// latest is the time of the newest event seen.
+	latest time.Time
+
+	// metrics
+	latencyHistogram  *prometheus.HistogramVec
+	attemptsHistogram *prometheus.HistogramVec
+	evictionsCounter  *prometheus.CounterVec
+	trackedGauge      prometheus.Gauge
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixLifecycleCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent adds the event to the lifecycle of its queue ID.
+func (c *PostfixLifecycleCollector) HandleEvent(e *maillog.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e.Time.After(c.latest) {
+		c.latest = e.Time
+	}
+	if !e.IsPostfix() || e.QueueID == "" {
+		return
+	}
+	c.evictOrphans()
+	entry := c.entry(e.QueueID, e.Time)
+	m := entry.message
+	kind := "other"
+	switch {
+	case e.Process == "smtpd":
+		if client, ok := maillog.ParseClient(e.Payload); ok {
+			kind = "received"
+			m.Client = client.Client
+			entry.received = true
+		}
+	case e.Process == "pickup":
+		if strings.HasPrefix(e.Payload, "uid=") {
+			kind = "received"
+			entry.received = true
+		}
+	case e.Process == "cleanup":
+		if id, ok := maillog.ParseMessageID(e.Payload); ok {
+			kind = "queued"
+			m.MessageID = c.mask(id)
+			entry.received = entry.received || len(m.Events) == 0
+		}
+	case e.Process == "qmgr" && e.Payload == "removed":
+		kind = "removed"
+	case e.Process == "qmgr" && strings.HasSuffix(e.Payload, " (queue active)"):
+		if active, ok := maillog.ParseActive(e.Payload); ok {
+			kind = "active"
+			m.From = c.mask(active.From)
+			m.Size = active.Size
+			m.Nrcpt = active.Nrcpt
+			m.Attempts++
+		}
+	}
+	if kind == "other" {
+		if id, ok := maillog.ParseNotification(e.Payload); ok {
+			kind = "notification"
+			m.BounceQueueID = id
+			c.entry(id, e.Time).message.BounceOf = e.QueueID
+		} else if d, ok := maillog.ParseDelivery(e.Payload); ok {
+			kind = "delivery"
+			switch d.Status {
+			case "sent":
+				entry.sent = true
+			case "bounced":
+				entry.bounced = true
+			case "expired":
+				kind = "expired"
+				entry.expired = true
+			}
+			m.Status = d.Status
+		}
+	}
+
+	if len(m.Events) < c.cfg.MaxEvents {
+		m.Events = append(m.Events, MessageEvent{Time: e.Time, Service: e.Service, Event: kind, Text: c.mask(e.Payload)})
+	} else {
+		m.DroppedEvents++
+	}
+	if kind == "removed" {
+		c.complete(entry, e.Time)
+	}
+}
+
+// entry returns the message in flight of the queue ID updated at t, or a new one.
+// The message seen least recently is evicted if there are too many messages in flight.
+func (c *PostfixLifecycleCollector) entry(queueID string, t time.Time) *lifecycleEntry {
+	if elem, ok := c.inflight[queueID]; ok {
+		entry := elem.Value.(*lifecycleEntry)
+		if t.After(entry.lastSeen) {
+			entry.lastSeen = t
+			c.place(elem)
+		}
+		return entry
+	}
+	if len(c.inflight) >= c.cfg.MaxMessages {
+		c.evict(c.inflightOrder.Front(), "capacity")
+	}
+	entry := &lifecycleEntry{
+		message:  &MessageLifecycle{QueueID: queueID, FirstSeen: t, Events: []MessageEvent{}},
+		lastSeen: t,
+	}
+	elem := c.inflightOrder.PushBack(entry)
+	c.place(elem)
+	c.inflight[queueID] = elem
+	c.trackedGauge.Set(float64(len(c.inflight)))
+	return entry
+}
+
+// place moves the message in flight behind the messages seen before it, to keep the order by the time of the last event.
+// The lines are mostly in order, so that it is moved to the back or near it.
+func (c *PostfixLifecycleCollector) place(elem *list.Element) {
+	lastSeen := elem.Value.(*lifecycleEntry).lastSeen
+	mark := c.inflightOrder.Back()
+	for mark != nil && (mark == elem || mark.Value.(*lifecycleEntry).lastSeen.After(lastSeen)) {
+		mark = mark.Prev()
+	}
+	if mark == nil {
+		c.inflightOrder.MoveToFront(elem)
+	} else {
+		c.inflightOrder.MoveAfter(elem, mark)
+	}
+}
+
+// evict forgets the message in flight for the reason.
+func (c *PostfixLifecycleCollector) evict(elem *list.Element, reason string) {
+	entry := c.inflightOrder.Remove(elem).(*lifecycleEntry)
+	delete(c.inflight, entry.message.QueueID)
+	c.evictionsCounter.WithLabelValues(reason).Inc()
+	c.trackedGauge.Set(float64(len(c.inflight)))
+}
+
+// evictOrphans evicts the messages in flight without events for the orphan timeout before the newest event.
+func (c *PostfixLifecycleCollector) evictOrphans() {
+	deadline := c.latest.Add(-time.Duration(c.cfg.OrphanTimeout))
+	for elem := c.inflightOrder.Front(); elem != nil; elem = c.inflightOrder.Front() {
+		if !elem.Value.(*lifecycleEntry).lastSeen.Before(deadline) {
+			return
+		}
+		c.evict(elem, "orphan")
+	}
+}
+
+// complete observes the removed message, and keeps it for the API.
+func (c *PostfixLifecycleCollector) complete(entry *lifecycleEntry, t time.Time) {
+	m := entry.message
+	c.inflightOrder.Remove(c.inflight[m.QueueID])
+	delete(c.inflight, m.QueueID)
+	c.trackedGauge.Set(float64(len(c.inflight)))
+
+	m.Removed = &t
+	m.Status = entry.status()
+	if entry.received {
+		c.latencyHistogram.WithLabelValues(m.Status).Observe(t.Sub(m.FirstSeen).Seconds())
+		c.attemptsHistogram.WithLabelValues(m.Status).Observe(float64(m.Attempts))
+	}
+
+	if c.cfg.MaxCompleted == 0 {
+		return
+	}
+	if len(c.completed) >= c.cfg.MaxCompleted {
+		oldest := c.completedOrder.Remove(c.completedOrder.Front()).(*MessageLifecycle)
+		delete(c.completed, oldest.QueueID)
+	}
+	c.completed[m.QueueID] = m
+	c.completedOrder.PushBack(m)
+}
+
+// Message returns the lifecycle of the queue ID in JSON, or false if the queue ID is unknown.
+func (c *PostfixLifecycleCollector) Message(queueID string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var m *MessageLifecycle
+	if elem, ok := c.inflight[queueID]; ok {
+		m = elem.Value.(*lifecycleEntry).message
+	} else if m, ok = c.completed[queueID]; !ok {
+		return nil, false
+	}
+	b, _ := json.Marshal(m)
+	return b, true
+}
+
+// ServeHTTP returns the lifecycle of the queue ID at the end of the path (e.g. /api/messages/3F8C41A2B3) in JSON.
+func (c *PostfixLifecycleCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	queueID := path.Base(r.URL.Path)
+	b, ok := c.Message(queueID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Message %q is not found", queueID), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixLifecycleCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.Lifecycle
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixLifecycleCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.latencyHistogram.Describe(ch)
+	c.attemptsHistogram.Describe(ch)
+	c.evictionsCounter.Describe(ch)
+	c.trackedGauge.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixLifecycleCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	c.evictOrphans()
+	c.mu.Unlock()
+
+	c.latencyHistogram.Collect(ch)
+	c.attemptsHistogram.Collect(ch)
+	c.evictionsCounter.Collect(ch)
+	c.trackedGauge.Collect(ch)
+}
+
+// NewPostfixLifecycleCollector returns new PostfixLifecycleCollector.
+func NewPostfixLifecycleCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.Lifecycle
+	var mask func(string) string
+	switch cfg.Mask.Policy {
+	case "local_part":
+		mask = util.EmailMask
+	case "full":
+		mask = util.EmailRedact
+	case "none":
+		mask = func(s string) string { return s }
+	default:
+		return nil, fmt.Errorf("collectors.lifecycle.mask.policy: unknown policy `%s`", cfg.Mask.Policy)
+	}
+
+	return &PostfixLifecycleCollector{
+		cfg:            cfg,
+		mask:           mask,
+		logger:         logger,
+		inflight:       make(map[string]*list.Element),
+		inflightOrder:  list.New(),
+		completed:      make(map[string]*MessageLifecycle),
+		completedOrder: list.New(),
+		latencyHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "message",
+				Name:      "latency_seconds",
+				Help:      "Time from the arrival to the removal of the messages, in seconds, by final status.",
+				Buckets:   cfg.LatencyBuckets,
+			},
+			[]string{"status"}),
+		attemptsHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "message",
+				Name:      "delivery_attempts",
+				Help:      "Number of times qmgr moved the messages to the active queue until the removal, by final status.",
+				Buckets:   cfg.AttemptsBuckets,
+			},
+			[]string{"status"}),
+		evictionsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "message",
+				Name:      "lifecycle_evictions_total",
+				Help:      "Total number of the messages in flight evicted before the removal, by reason: orphan without events for the timeout, or capacity.",
+			},
+			[]string{"reason"}),
+		trackedGauge: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "message",
+				Name:      "lifecycles_tracked",
+				Help:      "Number of the messages in flight tracked by the lifecycle collector.",
+			}),
+	}, nil
+}
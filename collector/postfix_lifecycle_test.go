@@ -0,0 +1,181 @@
+package collector_test
+
+import (
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newLifecycleCollector(t *testing.T, maxMessages int) collector.Collector {
+	t.Helper()
+	cfg := config.DefaultConfig
+	cfg.Collectors.Lifecycle.MaxMessages = maxMessages
+	cfg.Collectors.Lifecycle.OrphanTimeout = model.Duration(time.Hour)
+	cfg.Collectors.Lifecycle.LatencyBuckets = []float64{1, 60, 3600}
+	cfg.Collectors.Lifecycle.AttemptsBuckets = []float64{1, 2}
+	// The wall clock is far after the log, which must not evict the messages in flight.
+	now := func() time.Time { return time.Date(2030, 4, 1, 12, 0, 0, 0, time.UTC) }
+	c, err := collector.NewPostfixLifecycleCollector(&collector.Options{Config: &cfg, Now: now}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+var lifecycleLines = []string{
+	"2020-04-01T10:00:00Z mail postfix/smtpd[1]: 1D2E3F4A5B: client=unknown[192.0.2.9]",
+	"2020-04-01T12:00:00Z mail postfix/smtpd[1]: 3F8C41A2B1: client=unknown[192.0.2.1]",
+	"2020-04-01T12:00:00Z mail postfix/cleanup[2]: 3F8C41A2B1: message-id=<a@example.com>",
+	"2020-04-01T12:00:01Z mail postfix/qmgr[3]: 3F8C41A2B1: from=<alice@example.com>, size=1234, nrcpt=1 (queue active)",
+	"2020-04-01T12:00:02Z mail postfix/smtp[4]: 3F8C41A2B1: to=<bob@example.net>, relay=mx.example.net[192.0.2.2]:25, delay=2, delays=0/1/1/0, dsn=4.2.0, status=deferred (host mx.example.net[192.0.2.2] said: 450 4.2.0 <bob@example.net>: Recipient address rejected: Greylisted)",
+	"2020-04-01T12:00:03Z mail postfix/qmgr[3]: 6A7B8C9D0E: from=<carol@example.com>, size=100, nrcpt=1 (queue active)",
+	"2020-04-01T12:00:04Z mail postfix/smtp[4]: 6A7B8C9D0E: to=<dave@example.net>, relay=mx.example.net[192.0.2.2]:25, delay=9, delays=8/0/1/0, dsn=2.0.0, status=sent (250 2.0.0 OK)",
+	"2020-04-01T12:00:04Z mail postfix/qmgr[3]: 6A7B8C9D0E: removed",
+	"2020-04-01T12:30:00Z mail postfix/qmgr[3]: 3F8C41A2B1: from=<alice@example.com>, size=1234, nrcpt=1 (queue active)",
+	"2020-04-01T12:30:02Z mail postfix/smtp[4]: 3F8C41A2B1: to=<bob@example.net>, relay=mx.example.net[192.0.2.2]:25, delay=1802, delays=1800/0/1/1, dsn=5.1.1, status=bounced (host mx.example.net[192.0.2.2] said: 550 5.1.1 <bob@example.net>: User unknown)",
+	"2020-04-01T12:30:02Z mail postfix/cleanup[2]: 4B2C3D4E5F: message-id=<20200401123002.4B2C3D4E5F@mail.example.com>",
+	"2020-04-01T12:30:02Z mail postfix/bounce[5]: 3F8C41A2B1: sender non-delivery notification: 4B2C3D4E5F",
+	"2020-04-01T12:30:02Z mail postfix/qmgr[3]: 3F8C41A2B1: removed",
+	"2020-04-01T12:30:02Z mail postfix/qmgr[3]: 4B2C3D4E5F: from=<>, size=3000, nrcpt=1 (queue active)",
+	"2020-04-01T12:30:03Z mail postfix/local[6]: 4B2C3D4E5F: to=<alice@example.com>, relay=local, delay=1, delays=0/0/0/1, dsn=2.0.0, status=sent (delivered to mailbox)",
+	"2020-04-01T12:30:03Z mail postfix/qmgr[3]: 4B2C3D4E5F: removed",
+	"2020-04-01T12:35:00Z mail postfix/pickup[7]: 7E8F9A0B1C: uid=1000 from=<erin>",
+}
+
+func TestPostfixLifecycleCollector_HandleEvent(t *testing.T) {
+	c := newLifecycleCollector(t, 10)
+	handleLines(t, c, lifecycleLines...)
+
+	expected := `
+# HELP postfix_message_delivery_attempts Number of times qmgr moved the messages to the active queue until the removal, by final status.
+# TYPE postfix_message_delivery_attempts histogram
+postfix_message_delivery_attempts_bucket{status="bounced",le="1"} 0
+postfix_message_delivery_attempts_bucket{status="bounced",le="2"} 1
+postfix_message_delivery_attempts_bucket{status="bounced",le="+Inf"} 1
+postfix_message_delivery_attempts_sum{status="bounced"} 2
+postfix_message_delivery_attempts_count{status="bounced"} 1
+postfix_message_delivery_attempts_bucket{status="sent",le="1"} 1
+postfix_message_delivery_attempts_bucket{status="sent",le="2"} 1
+postfix_message_delivery_attempts_bucket{status="sent",le="+Inf"} 1
+postfix_message_delivery_attempts_sum{status="sent"} 1
+postfix_message_delivery_attempts_count{status="sent"} 1
+# HELP postfix_message_latency_seconds Time from the arrival to the removal of the messages, in seconds, by final status.
+# TYPE postfix_message_latency_seconds histogram
+postfix_message_latency_seconds_bucket{status="bounced",le="1"} 0
+postfix_message_latency_seconds_bucket{status="bounced",le="60"} 0
+postfix_message_latency_seconds_bucket{status="bounced",le="3600"} 1
+postfix_message_latency_seconds_bucket{status="bounced",le="+Inf"} 1
+postfix_message_latency_seconds_sum{status="bounced"} 1802
+postfix_message_latency_seconds_count{status="bounced"} 1
+postfix_message_latency_seconds_bucket{status="sent",le="1"} 1
+postfix_message_latency_seconds_bucket{status="sent",le="60"} 1
+postfix_message_latency_seconds_bucket{status="sent",le="3600"} 1
+postfix_message_latency_seconds_bucket{status="sent",le="+Inf"} 1
+postfix_message_latency_seconds_sum{status="sent"} 1
+postfix_message_latency_seconds_count{status="sent"} 1
+# HELP postfix_message_lifecycle_evictions_total Total number of the messages in flight evicted before the removal, by reason: orphan without events for the timeout, or capacity.
+# TYPE postfix_message_lifecycle_evictions_total counter
+postfix_message_lifecycle_evictions_total{reason="orphan"} 1
+# HELP postfix_message_lifecycles_tracked Number of the messages in flight tracked by the lifecycle collector.
+# TYPE postfix_message_lifecycles_tracked gauge
+postfix_message_lifecycles_tracked 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostfixLifecycleCollector_Capacity(t *testing.T) {
+	c := newLifecycleCollector(t, 2)
+	handleLines(t, c, lifecycleLines[1:5]...)
+	handleLines(t, c,
+		"2020-04-01T12:00:05Z mail postfix/smtpd[1]: 5A6B7C8D9E: client=unknown[192.0.2.3]",
+		"2020-04-01T12:00:06Z mail postfix/smtpd[1]: 9E8D7C6B5A: client=unknown[192.0.2.4]",
+	)
+
+	expected := `
+# HELP postfix_message_lifecycle_evictions_total Total number of the messages in flight evicted before the removal, by reason: orphan without events for the timeout, or capacity.
+# TYPE postfix_message_lifecycle_evictions_total counter
+postfix_message_lifecycle_evictions_total{reason="capacity"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "postfix_message_lifecycle_evictions_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostfixLifecycleCollector_OrphanOutOfOrder(t *testing.T) {
+	c := newLifecycleCollector(t, 10)
+	handleLines(t, c,
+		"2020-04-01T12:00:00Z mail postfix/smtpd[1]: 3F8C41A2B1: client=unknown[192.0.2.1]",
+		// The line of another source that arrives late is older than the message before it.
+		"2020-04-01T10:00:00Z mail postfix/smtpd[1]: 1D2E3F4A5B: client=unknown[192.0.2.9]",
+		"2020-04-01T12:30:00Z mail postfix/smtpd[1]: 5A6B7C8D9E: client=unknown[192.0.2.3]",
+	)
+
+	expected := `
+# HELP postfix_message_lifecycle_evictions_total Total number of the messages in flight evicted before the removal, by reason: orphan without events for the timeout, or capacity.
+# TYPE postfix_message_lifecycle_evictions_total counter
+postfix_message_lifecycle_evictions_total{reason="orphan"} 1
+# HELP postfix_message_lifecycles_tracked Number of the messages in flight tracked by the lifecycle collector.
+# TYPE postfix_message_lifecycles_tracked gauge
+postfix_message_lifecycles_tracked 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "postfix_message_lifecycle_evictions_total", "postfix_message_lifecycles_tracked"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostfixLifecycleCollector_ServeHTTP(t *testing.T) {
+	c := newLifecycleCollector(t, 10)
+	handleLines(t, c, lifecycleLines...)
+	h := c.(*collector.PostfixLifecycleCollector)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/messages/3F8C41A2B1", nil))
+	if w.Code != 200 {
+		t.Fatalf("expected `200`, but actual is `%d`", w.Code)
+	}
+	var m collector.MessageLifecycle
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Status != "bounced" || m.Attempts != 2 || m.BounceQueueID != "4B2C3D4E5F" || m.From != "***@example.com" || m.Removed == nil {
+		t.Errorf("expected the bounced message from `***@example.com`, but actual is `%+v`", m)
+	}
+	var events []string
+	for _, e := range m.Events {
+		events = append(events, e.Event)
+	}
+	expectedEvents := []string{"received", "queued", "active", "delivery", "active", "delivery", "notification", "removed"}
+	if !reflect.DeepEqual(events, expectedEvents) {
+		t.Errorf("expected `%v`, but actual is `%v`", expectedEvents, events)
+	}
+	if strings.Contains(w.Body.String(), "bob@") || strings.Contains(w.Body.String(), "alice@") {
+		t.Errorf("expected the addresses are masked, but actual is `%s`", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/messages/4B2C3D4E5F", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.BounceOf != "3F8C41A2B1" || m.Status != "sent" {
+		t.Errorf("expected the sent notification of `3F8C41A2B1`, but actual is `%+v`", m)
+	}
+
+	for _, queueID := range []string{"1D2E3F4A5B", "FFFFFFFFFF"} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/api/messages/"+queueID, nil))
+		if w.Code != 404 {
+			t.Errorf("expected `404`, but actual is `%d`", w.Code)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"reflect"
+	"strings"
+)
+
+func init() {
+	registerCollector("postscreen", defaultDisabled, NewPostfixPostscreenCollector)
+}
+
+// PostfixPostscreenCollector counts the events of postscreen, and the DNS blocklist hits of dnsblog, in the log input.
+type PostfixPostscreenCollector struct {
+	cfg    config.PostscreenCollectorConfig
+	logger log.Logger
+
+	// metrics
+	eventsCounter    *prometheus.CounterVec
+	rankHistogram    prometheus.Histogram
+	dnsblHitsCounter *prometheus.CounterVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixPostscreenCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the postscreen event or the DNS blocklist hit of the event.
+func (c *PostfixPostscreenCollector) HandleEvent(e *maillog.Event) {
+	if !e.IsPostfix() {
+		return
+	}
+	switch e.Process {
+	case "postscreen":
+		p, ok := maillog.ParsePostscreen(e.Payload)
+		if !ok {
+			return
+		}
+		// e.g. NON-SMTP COMMAND is non_smtp_command.
+		event := strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(p.Event))
+		c.eventsCounter.WithLabelValues(event).Inc()
+		if p.Event == "DNSBL" {
+			c.rankHistogram.Observe(float64(p.Rank))
+		}
+	case "dnsblog":
+		if hit, ok := maillog.ParseDNSBLHit(e.Payload); ok {
+			c.dnsblHitsCounter.WithLabelValues(hit.Site).Inc()
+		}
+	}
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixPostscreenCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.Postscreen
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixPostscreenCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.eventsCounter.Describe(ch)
+	c.rankHistogram.Describe(ch)
+	c.dnsblHitsCounter.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixPostscreenCollector) Collect(ch chan<- prometheus.Metric) {
+	c.eventsCounter.Collect(ch)
+	c.rankHistogram.Collect(ch)
+	c.dnsblHitsCounter.Collect(ch)
+}
+
+// NewPostfixPostscreenCollector returns new PostfixPostscreenCollector.
+func NewPostfixPostscreenCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.Postscreen
+	return &PostfixPostscreenCollector{
+		cfg:    cfg,
+		logger: logger,
+		eventsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "postscreen",
+				Name:      "events_total",
+				Help:      "Total number of events of postscreen, by event (e.g. connect, pass_new, pass_old, whitelisted, blacklisted, dnsbl, pregreet, hangup).",
+			},
+			[]string{"event"}),
+		rankHistogram: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "postscreen",
+				Name:      "dnsbl_rank",
+				Help:      "Combined score of the DNS blocklists of the clients that postscreen logged with DNSBL rank.",
+				Buckets:   cfg.RankBuckets,
+			}),
+		dnsblHitsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "postscreen",
+				Name:      "dnsbl_hits_total",
+				Help:      "Total number of clients listed by the DNS blocklists, by site of postscreen_dnsbl_sites.",
+			},
+			[]string{"site"}),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+func TestPostfixPostscreenCollector_HandleEvent(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.Postscreen.RankBuckets = []float64{1, 3, 5}
+	c, err := collector.NewPostfixPostscreenCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: CONNECT from [192.0.2.1]:12345 to [198.51.100.1]:25",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: PASS NEW [192.0.2.1]:12345",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: CONNECT from [192.0.2.2]:12345 to [198.51.100.1]:25",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: PASS OLD [192.0.2.2]:12345",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: CONNECT from [192.0.2.3]:12345 to [198.51.100.1]:25",
+		"Apr  1 12:00:00 mx postfix/dnsblog[2]: addr 192.0.2.3 listed by domain zen.spamhaus.org as 127.0.0.2",
+		"Apr  1 12:00:00 mx postfix/dnsblog[2]: addr 192.0.2.3 listed by domain bl.spamcop.net as 127.0.0.2",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: PREGREET 11 after 0.19 from [192.0.2.3]:12345: EHLO client\\r\\n",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: DNSBL rank 4 for [192.0.2.3]:12345",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: NOQUEUE: reject: RCPT from [192.0.2.3]:12345: 550 5.7.1 Service unavailable; client [192.0.2.3] blocked using zen.spamhaus.org; from=<sender@example.com>, to=<user@example.com>, proto=ESMTP, helo=<client>",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: DISCONNECT [192.0.2.3]:12345",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: CONNECT from [192.0.2.4]:12345 to [198.51.100.1]:25",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: NON-SMTP COMMAND from [192.0.2.4]:12345 after CONNECT: GET / HTTP/1.1",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: WHITELISTED [192.0.2.5]:12345",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: BLACKLISTED [192.0.2.6]:12345",
+		// Postfix 3.6 and later
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: ALLOWLISTED [192.0.2.10]:12345",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: DENYLISTED [192.0.2.11]:12345",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: HANGUP after 0.7 from [192.0.2.7]:12345 in tests after SMTP handshake",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: COMMAND PIPELINING from [192.0.2.8]:12345 after EHLO: QUIT\\r\\n",
+		"Apr  1 12:00:00 mx postfix/postscreen[1]: BARE NEWLINE from [192.0.2.9]:12345 after DATA",
+	)
+
+	expected := `
+# HELP postfix_postscreen_dnsbl_hits_total Total number of clients listed by the DNS blocklists, by site of postscreen_dnsbl_sites.
+# TYPE postfix_postscreen_dnsbl_hits_total counter
+postfix_postscreen_dnsbl_hits_total{site="bl.spamcop.net"} 1
+postfix_postscreen_dnsbl_hits_total{site="zen.spamhaus.org"} 1
+# HELP postfix_postscreen_dnsbl_rank Combined score of the DNS blocklists of the clients that postscreen logged with DNSBL rank.
+# TYPE postfix_postscreen_dnsbl_rank histogram
+postfix_postscreen_dnsbl_rank_bucket{le="1"} 0
+postfix_postscreen_dnsbl_rank_bucket{le="3"} 0
+postfix_postscreen_dnsbl_rank_bucket{le="5"} 1
+postfix_postscreen_dnsbl_rank_bucket{le="+Inf"} 1
+postfix_postscreen_dnsbl_rank_sum 4
+postfix_postscreen_dnsbl_rank_count 1
+# HELP postfix_postscreen_events_total Total number of events of postscreen, by event (e.g. connect, pass_new, pass_old, whitelisted, blacklisted, dnsbl, pregreet, hangup).
+# TYPE postfix_postscreen_events_total counter
+postfix_postscreen_events_total{event="bare_newline"} 1
+postfix_postscreen_events_total{event="blacklisted"} 2
+postfix_postscreen_events_total{event="command_pipelining"} 1
+postfix_postscreen_events_total{event="connect"} 4
+postfix_postscreen_events_total{event="disconnect"} 1
+postfix_postscreen_events_total{event="dnsbl"} 1
+postfix_postscreen_events_total{event="hangup"} 1
+postfix_postscreen_events_total{event="non_smtp_command"} 1
+postfix_postscreen_events_total{event="pass_new"} 1
+postfix_postscreen_events_total{event="pass_old"} 1
+postfix_postscreen_events_total{event="pregreet"} 1
+postfix_postscreen_events_total{event="whitelisted"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,169 +1,110 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	"github.com/jasonlvhit/gocron"
-	"github.com/k-kinzal/postfix-prometheus-exporter/postfix"
 	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/showq"
 	"github.com/k-kinzal/postfix-prometheus-exporter/util"
 	"github.com/prometheus/client_golang/prometheus"
-	"io/ioutil"
-	golog "log"
+	"github.com/prometheus/common/model"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Simple lock implementation to lock gocron jobs.
-type locker struct {
-	mutexs map[string]sync.Mutex
+func init() {
+	registerCollector("queue", defaultEnabled, NewPostfixQueueCollector)
 }
 
-// Lock is locking job.
-func (l *locker) Lock(key string) (bool, error) {
-	m, ok := l.mutexs[key]
-	if !ok {
-		m = sync.Mutex{}
-	}
-	m.Lock()
-	l.mutexs[key] = m
-	return true, nil
-}
-
-// Lock is unlocking job.
-func (l *locker) Unlock(key string) error {
-	m, ok := l.mutexs[key]
-	if !ok {
-		return nil
-	}
-	m.Unlock()
-	return nil
-}
+// PostfixQueueCollector to collect statistics of postfix queue in Prometheus format
+type PostfixQueueCollector struct {
+	instances  []Instance
+	pipeline   Pipeline
+	labelNames []string
+	logger     log.Logger
+	mu         sync.Mutex
 
-// PostfixQueueCollectScheduler to collect statistics for Postfix queue.
-type PostfixQueueCollectScheduler struct {
-	collector *PostfixQueueCollector
-}
+	// instanceErrors is the error of each instance in the last update.
+	instanceErrors map[string]error
 
-// Collector returns the Collector of prometheus.
-func (s *PostfixQueueCollectScheduler) Collector() prometheus.Collector {
-	return s.collector
+	// metrics
+	sizeBytesHistogram  *prometheus.HistogramVec
+	ageSecondsHistogram *prometheus.HistogramVec
 }
 
-// Collect collects queue statistics from the postqueue.
-func (s *PostfixQueueCollectScheduler) Collect() {
-	level.Debug(s.collector.logger).Log("msg", "Start collecting")
+// Update collects queue statistics from the postqueue.
+func (c *PostfixQueueCollector) Update(ctx context.Context) error {
+	level.Debug(c.logger).Log("msg", "Start collecting")
 	now := time.Now()
 
-	s.collector.mu.Lock()
-	defer s.collector.mu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	s.collector.sizeBytesHistogram.Reset()
-	s.collector.ageSecondsHistogram.Reset()
-	s.collector.scrapeSuccessGauge.Reset()
-	s.collector.scrapeDurationGauge.Reset()
+	c.sizeBytesHistogram.Reset()
+	c.ageSecondsHistogram.Reset()
 
 	cnt := 0
 	mu := sync.Mutex{}
-	err := s.collector.postqueue.EachProduce(func(message *showq.Message) {
-		for i := 0; i < len(message.Recipients); i++ {
-			message.Recipients[i].Address = util.EmailMask(message.Recipients[i].Address)
-		}
-		b, _ := json.Marshal(message)
-		level.Debug(s.collector.logger).Log("msg", "Collected items", "item", b)
-
-		mu.Lock()
-		defer mu.Unlock()
-
-		s.collector.sizeBytesHistogram.WithLabelValues(message.QueueName).Observe(float64(message.MessageSize))
-		s.collector.ageSecondsHistogram.WithLabelValues(message.QueueName).Observe(now.Sub(time.Time(message.ArrivalTime)).Seconds())
-		cnt++
-	})
-
-	if err != nil {
+	var errs []string
+	c.instanceErrors = make(map[string]error, len(c.instances))
+	for _, instance := range c.instances {
+		err := instance.PostQueue.EachProduceContext(ctx, func(message *showq.Message) {
+			m := NewMessage(message)
+			if instance.Name != "" {
+				m.Labels["postfix_instance"] = instance.Name
+			}
+			if !c.pipeline.Process(m) {
+				return
+			}
+			b, _ := json.Marshal(m)
+			level.Debug(c.logger).Log("msg", "Collected items", "item", b)
+
+			labelValues := make([]string, len(c.labelNames))
+			labelValues[0] = m.QueueName
+			for i := 1; i < len(c.labelNames); i++ {
+				labelValues[i] = m.Labels[c.labelNames[i]]
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			c.sizeBytesHistogram.WithLabelValues(labelValues...).Observe(float64(m.MessageSize))
+			c.ageSecondsHistogram.WithLabelValues(labelValues...).Observe(now.Sub(time.Time(m.ArrivalTime)).Seconds())
+			cnt++
+		})
+		c.instanceErrors[instanceName(instance)] = err
 		if e, ok := err.(*showq.ParseError); ok {
-			level.Error(s.collector.logger).Log("err", err, "line", util.EmailMask(e.Line()))
-		} else {
-			level.Error(s.collector.logger).Log("err", err)
+			level.Error(c.logger).Log("msg", "Failed to parse showq", "instance", instance.Name, "line", util.EmailMask(e.Line()))
+		}
+		if err != nil {
+			if instance.Name != "" {
+				err = fmt.Errorf("instance %s: %v", instance.Name, err)
+			}
+			errs = append(errs, err.Error())
 		}
-		s.collector.scrapeSuccessGauge.WithLabelValues("postfix_queue").Set(0)
-	} else {
-		s.collector.scrapeSuccessGauge.WithLabelValues("postfix_queue").Set(1)
 	}
-	s.collector.scrapeDurationGauge.WithLabelValues("postfix_queue").Set(time.Now().Sub(now).Seconds())
-
-	_, nextTime := gocron.NextRun()
-	level.Debug(s.collector.logger).Log("msg", "Finish collecting", "length", cnt, "duration", time.Now().Sub(now).Seconds(), "next", nextTime)
-}
-
-// Start starts to collect statistics of postfix queue.
-// Because collection starts after interval_seconds, if you want to collect immediately, please call Collect after start.
-func (s *PostfixQueueCollectScheduler) Start(intervalSeconds uint64) chan bool {
-	level.Debug(s.collector.logger).Log("msg", "Starting postfix queue collector", "interval", intervalSeconds)
-	golog.SetOutput(ioutil.Discard) // disable gocron log
-	gocron.SetLocker(&locker{make(map[string]sync.Mutex)})
-	gocron.Every(intervalSeconds).Seconds().Lock().Do(s.Collect)
-	return gocron.Start()
-}
 
-// NewPostfixQueueCollectScheduler returns new PostfixQueueCollectScheduler.
-func NewPostfixQueueCollectScheduler(q *postfix.PostQueue, logger log.Logger) *PostfixQueueCollectScheduler {
-	return &PostfixQueueCollectScheduler{
-		collector: &PostfixQueueCollector{
-			postqueue: q,
-			logger:    logger,
-			mu:        sync.Mutex{},
-			sizeBytesHistogram: prometheus.NewHistogramVec(
-				prometheus.HistogramOpts{
-					Namespace: "postfix",
-					Subsystem: "queue",
-					Name:      "size_bytes",
-					Help:      "Total message size in the queue.",
-					Buckets:   []float64{1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9},
-				},
-				[]string{"queue_name"}),
-			ageSecondsHistogram: prometheus.NewHistogramVec(
-				prometheus.HistogramOpts{
-					Namespace: "postfix",
-					Subsystem: "queue",
-					Name:      "age_seconds",
-					Help:      "Age of messages in the queue, in seconds.",
-					Buckets:   []float64{1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8},
-				},
-				[]string{"queue_name"}),
-
-			scrapeDurationGauge: prometheus.NewGaugeVec(
-				prometheus.GaugeOpts{
-					Namespace: "postfix",
-					Subsystem: "scope",
-					Name:      "collector_duration_seconds",
-					Help:      "postfix_exporter: Duration of a collector scrape.",
-				},
-				[]string{"collector"}),
-			scrapeSuccessGauge: prometheus.NewGaugeVec(
-				prometheus.GaugeOpts{
-					Namespace: "postfix",
-					Subsystem: "scope",
-					Name:      "collector_success",
-					Help:      "postfix_exporter: Whether a collector succeeded.",
-				},
-				[]string{"collector"}),
-		},
+	level.Debug(c.logger).Log("msg", "Finish collecting", "length", cnt, "duration", time.Now().Sub(now).Seconds())
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
 	}
+	return nil
 }
 
-// PostfixQueueCollector to collect statistics of postfix queue in Prometheus format
-type PostfixQueueCollector struct {
-	postqueue *postfix.PostQueue
-	logger    log.Logger
-	mu        sync.Mutex
+// InstanceErrors implements the InstanceReporter interface.
+func (c *PostfixQueueCollector) InstanceErrors() map[string]error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// metrics
-	sizeBytesHistogram  *prometheus.HistogramVec
-	ageSecondsHistogram *prometheus.HistogramVec
-	scrapeDurationGauge *prometheus.GaugeVec
-	scrapeSuccessGauge  *prometheus.GaugeVec
+	errs := make(map[string]error, len(c.instanceErrors))
+	for name, err := range c.instanceErrors {
+		errs[name] = err
+	}
+	return errs
 }
 
 // Describe implements the prometheus.Collector interface.
@@ -173,8 +114,6 @@ func (c *PostfixQueueCollector) Describe(ch chan<- *prometheus.Desc) {
 
 	c.ageSecondsHistogram.Describe(ch)
 	c.sizeBytesHistogram.Describe(ch)
-	c.scrapeDurationGauge.Describe(ch)
-	c.scrapeSuccessGauge.Describe(ch)
 }
 
 // Collect implements the prometheus.Collector interface.
@@ -184,6 +123,53 @@ func (c *PostfixQueueCollector) Collect(ch chan<- prometheus.Metric) {
 
 	c.ageSecondsHistogram.Collect(ch)
 	c.sizeBytesHistogram.Collect(ch)
-	c.scrapeDurationGauge.Collect(ch)
-	c.scrapeSuccessGauge.Collect(ch)
+}
+
+// NewPostfixQueueCollector returns new PostfixQueueCollector.
+// The processors in the options are applied to each message, and their labels are added to the metrics.
+func NewPostfixQueueCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.Queue
+	pipeline := opts.Processors
+	if pipeline == nil {
+		pipeline = DefaultPipeline()
+	}
+	labelNames := []string{"queue_name"}
+	for _, instance := range opts.Instances {
+		if instance.Name != "" {
+			labelNames = append(labelNames, "postfix_instance")
+			break
+		}
+	}
+	for _, name := range pipeline.LabelNames() {
+		if !model.LabelName(name).IsValid() || name == "queue_name" || name == "postfix_instance" {
+			return nil, fmt.Errorf("invalid label name `%s` added by message processors", name)
+		}
+		labelNames = append(labelNames, name)
+	}
+
+	return &PostfixQueueCollector{
+		instances:  opts.Instances,
+		pipeline:   pipeline,
+		labelNames: labelNames,
+		logger:     logger,
+		mu:         sync.Mutex{},
+		sizeBytesHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "queue",
+				Name:      "size_bytes",
+				Help:      "Total message size in the queue.",
+				Buckets:   cfg.SizeBuckets,
+			},
+			labelNames),
+		ageSecondsHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "queue",
+				Name:      "age_seconds",
+				Help:      "Age of messages in the queue, in seconds.",
+				Buckets:   cfg.AgeBuckets,
+			},
+			labelNames),
+	}, nil
 }
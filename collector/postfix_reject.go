@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"reflect"
+	"regexp"
+)
+
+func init() {
+	registerCollector("reject", defaultDisabled, NewPostfixRejectCollector)
+}
+
+// restrictionRule names the restriction of the rejects whose reply text matches.
+type restrictionRule struct {
+	name  string
+	regex *regexp.Regexp
+}
+
+// builtinRestrictions name the restrictions by the reply texts of Postfix, in the order to match.
+var builtinRestrictions = []restrictionRule{
+	{"reject_unauth_destination", regexp.MustCompile(`Relay access denied`)},
+	{"reject_unauth_pipelining", regexp.MustCompile(`Improper use of SMTP command pipelining`)},
+	{"reject_unknown_reverse_client_hostname", regexp.MustCompile(`Client host rejected: cannot find your reverse hostname`)},
+	{"reject_unknown_client_hostname", regexp.MustCompile(`Client host rejected: cannot find your hostname`)},
+	{"reject_non_fqdn_helo_hostname", regexp.MustCompile(`Helo command rejected: need fully-qualified hostname`)},
+	{"reject_invalid_helo_hostname", regexp.MustCompile(`Helo command rejected: Invalid name`)},
+	{"reject_unknown_helo_hostname", regexp.MustCompile(`Helo command rejected: Host not found`)},
+	{"reject_non_fqdn_sender", regexp.MustCompile(`Sender address rejected: need fully-qualified address`)},
+	{"reject_unknown_sender_domain", regexp.MustCompile(`Sender address rejected: Domain not found`)},
+	{"reject_unverified_sender", regexp.MustCompile(`Sender address rejected: undeliverable address`)},
+	{"reject_sender_login_mismatch", regexp.MustCompile(`Sender address rejected: not (owned by user|logged in)`)},
+	{"reject_non_fqdn_recipient", regexp.MustCompile(`Recipient address rejected: need fully-qualified address`)},
+	{"reject_unknown_recipient_domain", regexp.MustCompile(`Recipient address rejected: Domain not found`)},
+	{"reject_unverified_recipient", regexp.MustCompile(`Recipient address rejected: undeliverable address`)},
+	{"reject_unlisted_recipient", regexp.MustCompile(`Recipient address rejected: User unknown`)},
+	{"reject_multi_recipient_bounce", regexp.MustCompile(`Multi-recipient bounce`)},
+	{"check_client_access", regexp.MustCompile(`Client host rejected: Access denied`)},
+	{"check_helo_access", regexp.MustCompile(`Helo command rejected: Access denied`)},
+	{"check_sender_access", regexp.MustCompile(`Sender address rejected: Access denied`)},
+	{"check_recipient_access", regexp.MustCompile(`Recipient address rejected: Access denied`)},
+	{"message_size_limit", regexp.MustCompile(`Message size exceeds fixed limit`)},
+	{"queue_minfree", regexp.MustCompile(`Insufficient system storage`)},
+}
+
+// blocklistRegex matches the reply text of the DNS blocklist restrictions (e.g. `Client host [192.0.2.1] blocked using zen.spamhaus.org`).
+var blocklistRegex = regexp.MustCompile(`(Unverified Client host|Client host|Helo command|Sender address|Recipient address) \[([^\]]*)\] blocked using `)
+
+// blocklistRestrictions are the restrictions by the subject of blocklistRegex.
+var blocklistRestrictions = map[string]string{
+	"Unverified Client host": "reject_rhsbl_reverse_client",
+	"Helo command":           "reject_rhsbl_helo",
+	"Sender address":         "reject_rhsbl_sender",
+	"Recipient address":      "reject_rhsbl_recipient",
+}
+
+// PostfixRejectCollector counts the rejected SMTP commands of smtpd, and the warnings of warn_if_reject, in the log input.
+type PostfixRejectCollector struct {
+	cfg    config.RejectCollectorConfig
+	rules  []restrictionRule
+	logger log.Logger
+
+	// metrics
+	rejectsCounter  *prometheus.CounterVec
+	warningsCounter *prometheus.CounterVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixRejectCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the reject of the event.
+func (c *PostfixRejectCollector) HandleEvent(e *maillog.Event) {
+	if !e.IsPostfix() || e.Process != "smtpd" {
+		return
+	}
+	r, ok := maillog.ParseReject(e.Payload)
+	if !ok {
+		return
+	}
+
+	counter := c.rejectsCounter
+	if r.Warning {
+		counter = c.warningsCounter
+	}
+	counter.WithLabelValues(r.Stage, r.Code, r.EnhancedStatus, c.restriction(r), r.RBL()).Inc()
+}
+
+// restriction returns the name of the restriction that rejected, or other if it is unknown.
+func (c *PostfixRejectCollector) restriction(r *maillog.Reject) string {
+	for _, rule := range c.rules {
+		if rule.regex.MatchString(r.Text) {
+			return rule.name
+		}
+	}
+	if match := blocklistRegex.FindStringSubmatch(r.Text); match != nil {
+		if name, ok := blocklistRestrictions[match[1]]; ok {
+			return name
+		}
+		if net.ParseIP(match[2]) != nil {
+			return "reject_rbl_client"
+		}
+		return "reject_rhsbl_client"
+	}
+	return otherLabelValue
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixRejectCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.Reject
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixRejectCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.rejectsCounter.Describe(ch)
+	c.warningsCounter.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixRejectCollector) Collect(ch chan<- prometheus.Metric) {
+	c.rejectsCounter.Collect(ch)
+	c.warningsCounter.Collect(ch)
+}
+
+// NewPostfixRejectCollector returns new PostfixRejectCollector.
+// The restrictions in the configuration are matched before the built-in ones.
+func NewPostfixRejectCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.Reject
+	var rules []restrictionRule
+	for _, restriction := range cfg.Restrictions {
+		rules = append(rules, restrictionRule{name: restriction.Name, regex: restriction.Match.Regexp})
+	}
+	rules = append(rules, builtinRestrictions...)
+
+	labelNames := []string{"stage", "code", "enhanced_status", "restriction", "rbl"}
+	return &PostfixRejectCollector{
+		cfg:    cfg,
+		rules:  rules,
+		logger: logger,
+		rejectsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "smtpd",
+				Name:      "rejects_total",
+				Help:      "Total number of SMTP commands rejected by smtpd, by stage, reply code, enhanced status, restriction and DNS blocklist.",
+			},
+			labelNames),
+		warningsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "smtpd",
+				Name:      "reject_warnings_total",
+				Help:      "Total number of SMTP commands that would be rejected by smtpd without warn_if_reject, by stage, reply code, enhanced status, restriction and DNS blocklist.",
+			},
+			labelNames),
+	}, nil
+}
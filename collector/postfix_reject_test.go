@@ -0,0 +1,47 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPostfixRejectCollector_HandleEvent(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.Reject.Restrictions = []config.RestrictionConfig{{Name: "postgrey", Match: &config.Regexp{Regexp: regexp.MustCompile("Greylisted")}}}
+	c, err := collector.NewPostfixRejectCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: NOQUEUE: reject: RCPT from unknown[192.0.2.1]: 554 5.7.1 <user@example.net>: Relay access denied; from=<sender@example.com> to=<user@example.net> proto=ESMTP helo=<client>",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: NOQUEUE: reject: RCPT from unknown[192.0.2.2]: 554 5.7.1 Service unavailable; Client host [192.0.2.2] blocked using zen.spamhaus.org; https://www.spamhaus.org/query/ip/192.0.2.2; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: NOQUEUE: reject: RCPT from unknown[192.0.2.3]: 554 5.7.1 Service unavailable; Sender address [sender@example.org] blocked using dbl.spamhaus.org; from=<sender@example.org> to=<user@example.com> proto=ESMTP helo=<client>",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: 3F8C41A2B3: reject: RCPT from unknown[192.0.2.4]: 450 4.2.0 <user@example.com>: Recipient address rejected: Greylisted, see http://postgrey.schweikert.ch/; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+		"Apr  1 12:00:00 mail postfix/submission/smtpd[1]: NOQUEUE: reject: EHLO from unknown[192.0.2.5]: 504 5.5.2 <client>: Helo command rejected: need fully-qualified hostname; proto=SMTP helo=<client>",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: NOQUEUE: reject_warning: CONNECT from unknown[192.0.2.6]: 450 4.7.1 Client host rejected: cannot find your hostname, [192.0.2.6]; proto=SMTP",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: NOQUEUE: reject: MAIL from unknown[192.0.2.7]: 553 5.7.1 <sender@example.com>: Sender address rejected: custom text; from=<sender@example.com> proto=ESMTP helo=<client>",
+		"Apr  1 12:00:00 mail postfix/postscreen[1]: NOQUEUE: reject: RCPT from [192.0.2.8]:10025: 550 5.7.1 Service unavailable; client [192.0.2.8] blocked using zen.spamhaus.org; from=<sender@example.com>, to=<user@example.com>, proto=ESMTP, helo=<client>",
+	)
+
+	expected := `
+# HELP postfix_smtpd_reject_warnings_total Total number of SMTP commands that would be rejected by smtpd without warn_if_reject, by stage, reply code, enhanced status, restriction and DNS blocklist.
+# TYPE postfix_smtpd_reject_warnings_total counter
+postfix_smtpd_reject_warnings_total{code="450",enhanced_status="4.7.1",rbl="",restriction="reject_unknown_client_hostname",stage="CONNECT"} 1
+# HELP postfix_smtpd_rejects_total Total number of SMTP commands rejected by smtpd, by stage, reply code, enhanced status, restriction and DNS blocklist.
+# TYPE postfix_smtpd_rejects_total counter
+postfix_smtpd_rejects_total{code="450",enhanced_status="4.2.0",rbl="",restriction="postgrey",stage="RCPT"} 1
+postfix_smtpd_rejects_total{code="504",enhanced_status="5.5.2",rbl="",restriction="reject_non_fqdn_helo_hostname",stage="EHLO"} 1
+postfix_smtpd_rejects_total{code="553",enhanced_status="5.7.1",rbl="",restriction="other",stage="MAIL"} 1
+postfix_smtpd_rejects_total{code="554",enhanced_status="5.7.1",rbl="",restriction="reject_unauth_destination",stage="RCPT"} 1
+postfix_smtpd_rejects_total{code="554",enhanced_status="5.7.1",rbl="dbl.spamhaus.org",restriction="reject_rhsbl_sender",stage="RCPT"} 1
+postfix_smtpd_rejects_total{code="554",enhanced_status="5.7.1",rbl="zen.spamhaus.org",restriction="reject_rbl_client",stage="RCPT"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+func init() {
+	registerCollector("sasl", defaultDisabled, NewPostfixSASLCollector)
+}
+
+var (
+	saslOffenderAddressDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sasl", "offender_address_failures"),
+		"Decayed number of SASL authentication failures of the top offending client addresses, which halves every window.",
+		[]string{"address"},
+		nil,
+	)
+	saslOffenderNetworkDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sasl", "offender_network_failures"),
+		"Decayed number of SASL authentication failures of the top offending client networks (/24 for IPv4, /64 for IPv6), which halves every window.",
+		[]string{"network"},
+		nil,
+	)
+)
+
+// SASLOffender is an offending client address or network of the SASL authentication failures.
+type SASLOffender struct {
+	Address string `json:"address,omitempty"`
+	Network string `json:"network,omitempty"`
+	// Failures is the number of failures that halves every window.
+	Failures float64 `json:"failures"`
+	// TotalFailures is the number of all failures while the offender is tracked.
+	TotalFailures uint64    `json:"total_failures"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// SASLOffenders are the top offenders of the SASL authentication failures, in descending order of the failures.
+type SASLOffenders struct {
+	Window    string         `json:"window"`
+	Addresses []SASLOffender `json:"addresses"`
+	Networks  []SASLOffender `json:"networks"`
+}
+
+// PostfixSASLCollector counts the SASL authentication failures of smtpd in the log input,
+// and tracks the top offending client addresses and networks over a decaying window.
+type PostfixSASLCollector struct {
+	cfg    config.SASLCollectorConfig
+	now    func() time.Time
+	logger log.Logger
+
+	addresses *decayingCounter
+	networks  *decayingCounter
+
+	// metrics
+	failuresCounter *prometheus.CounterVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixSASLCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the SASL authentication failure of the event.
+func (c *PostfixSASLCollector) HandleEvent(e *maillog.Event) {
+	if !e.IsPostfix() || e.Process != "smtpd" {
+		return
+	}
+	f, ok := maillog.ParseSASLFailure(e.Payload)
+	if !ok {
+		return
+	}
+	c.failuresCounter.WithLabelValues(e.Service, f.Mechanism).Inc()
+
+	ip := net.ParseIP(f.Address)
+	if ip == nil {
+		return
+	}
+	c.addresses.add(ip.String(), e.Time)
+	c.networks.add(networkOf(ip), e.Time)
+}
+
+// networkOf returns the /24 network of an IPv4 address, or the /64 network of an IPv6 address (e.g. 192.0.2.0/24).
+func networkOf(ip net.IP) string {
+	mask := net.CIDRMask(64, 128)
+	if v4 := ip.To4(); v4 != nil {
+		ip, mask = v4, net.CIDRMask(24, 32)
+	}
+	n := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	return n.String()
+}
+
+// Offenders returns the top offending addresses and networks at the current time.
+func (c *PostfixSASLCollector) Offenders() *SASLOffenders {
+	now := c.now()
+	offenders := &SASLOffenders{
+		Window:    c.cfg.Window.String(),
+		Addresses: []SASLOffender{},
+		Networks:  []SASLOffender{},
+	}
+	for _, s := range c.addresses.top(c.cfg.TopN, now) {
+		offenders.Addresses = append(offenders.Addresses, SASLOffender{Address: s.Key, Failures: s.Score, TotalFailures: s.Total, LastSeen: s.LastSeen})
+	}
+	for _, s := range c.networks.top(c.cfg.TopN, now) {
+		offenders.Networks = append(offenders.Networks, SASLOffender{Network: s.Key, Failures: s.Score, TotalFailures: s.Total, LastSeen: s.LastSeen})
+	}
+	return offenders
+}
+
+// ServeHTTP returns the top offenders in JSON, for the automation to block them.
+func (c *PostfixSASLCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Offenders())
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixSASLCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.SASL
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixSASLCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.failuresCounter.Describe(ch)
+	ch <- saslOffenderAddressDesc
+	ch <- saslOffenderNetworkDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixSASLCollector) Collect(ch chan<- prometheus.Metric) {
+	c.failuresCounter.Collect(ch)
+	offenders := c.Offenders()
+	for _, o := range offenders.Addresses {
+		ch <- prometheus.MustNewConstMetric(saslOffenderAddressDesc, prometheus.GaugeValue, o.Failures, o.Address)
+	}
+	for _, o := range offenders.Networks {
+		ch <- prometheus.MustNewConstMetric(saslOffenderNetworkDesc, prometheus.GaugeValue, o.Failures, o.Network)
+	}
+}
+
+// NewPostfixSASLCollector returns new PostfixSASLCollector.
+func NewPostfixSASLCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.SASL
+	return &PostfixSASLCollector{
+		cfg:       cfg,
+		now:       opts.now(),
+		logger:    logger,
+		addresses: newDecayingCounter(time.Duration(cfg.Window), cfg.MaxTracked),
+		networks:  newDecayingCounter(time.Duration(cfg.Window), cfg.MaxTracked),
+		failuresCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "sasl",
+				Name:      "auth_failures_total",
+				Help:      "Total number of SASL authentication failures of smtpd, by service and mechanism.",
+			},
+			[]string{"service", "mechanism"}),
+	}, nil
+}
@@ -0,0 +1,104 @@
+package collector_test
+
+import (
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSASLCollector(t *testing.T, maxTracked int) collector.Collector {
+	t.Helper()
+	cfg := config.DefaultConfig
+	cfg.Collectors.SASL.Window = model.Duration(time.Hour)
+	cfg.Collectors.SASL.TopN = 2
+	cfg.Collectors.SASL.MaxTracked = maxTracked
+	now := func() time.Time { return time.Date(2020, 4, 1, 13, 0, 0, 0, time.UTC) }
+	c, err := collector.NewPostfixSASLCollector(&collector.Options{Config: &cfg, Now: now}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPostfixSASLCollector_HandleEvent(t *testing.T) {
+	c := newSASLCollector(t, 10)
+	handleLines(t, c,
+		"2020-04-01T11:00:00Z mail postfix/submission/smtpd[1]: warning: unknown[192.0.2.1]: SASL LOGIN authentication failed: UGFzc3dvcmQ6",
+		"2020-04-01T12:00:00Z mail postfix/submission/smtpd[1]: warning: unknown[192.0.2.1]: SASL LOGIN authentication failed: UGFzc3dvcmQ6",
+		"2020-04-01T12:00:00Z mail postfix/submission/smtpd[1]: warning: unknown[192.0.2.2]: SASL PLAIN authentication failed: authentication failure, sasl_username=user@example.com",
+		"2020-04-01T13:00:00Z mail postfix/smtpd[1]: warning: client.example.net[2001:db8::1]: SASL PLAIN authentication failed: authentication failure",
+		"2020-04-01T13:00:00Z mail postfix/smtpd[1]: warning: hostname client.example.com does not resolve to address 192.0.2.3",
+	)
+
+	expected := `
+# HELP postfix_sasl_auth_failures_total Total number of SASL authentication failures of smtpd, by service and mechanism.
+# TYPE postfix_sasl_auth_failures_total counter
+postfix_sasl_auth_failures_total{mechanism="LOGIN",service="postfix/submission/smtpd"} 2
+postfix_sasl_auth_failures_total{mechanism="PLAIN",service="postfix/smtpd"} 1
+postfix_sasl_auth_failures_total{mechanism="PLAIN",service="postfix/submission/smtpd"} 1
+# HELP postfix_sasl_offender_address_failures Decayed number of SASL authentication failures of the top offending client addresses, which halves every window.
+# TYPE postfix_sasl_offender_address_failures gauge
+postfix_sasl_offender_address_failures{address="192.0.2.1"} 0.75
+postfix_sasl_offender_address_failures{address="2001:db8::1"} 1
+# HELP postfix_sasl_offender_network_failures Decayed number of SASL authentication failures of the top offending client networks (/24 for IPv4, /64 for IPv6), which halves every window.
+# TYPE postfix_sasl_offender_network_failures gauge
+postfix_sasl_offender_network_failures{network="192.0.2.0/24"} 1.25
+postfix_sasl_offender_network_failures{network="2001:db8::/64"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostfixSASLCollector_Evict(t *testing.T) {
+	c := newSASLCollector(t, 2)
+	handleLines(t, c,
+		"2020-04-01T12:00:00Z mail postfix/smtpd[1]: warning: unknown[192.0.2.1]: SASL LOGIN authentication failed: UGFzc3dvcmQ6",
+		"2020-04-01T12:00:00Z mail postfix/smtpd[1]: warning: unknown[192.0.2.1]: SASL LOGIN authentication failed: UGFzc3dvcmQ6",
+		"2020-04-01T12:00:00Z mail postfix/smtpd[1]: warning: unknown[198.51.100.1]: SASL LOGIN authentication failed: UGFzc3dvcmQ6",
+		"2020-04-01T12:00:00Z mail postfix/smtpd[1]: warning: unknown[203.0.113.1]: SASL LOGIN authentication failed: UGFzc3dvcmQ6",
+	)
+
+	offenders := c.(*collector.PostfixSASLCollector).Offenders()
+	var addresses []string
+	for _, o := range offenders.Addresses {
+		addresses = append(addresses, o.Address)
+	}
+	expected := []string{"192.0.2.1", "203.0.113.1"}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("expected `%v`, but actual is `%v`", expected, addresses)
+	}
+}
+
+func TestPostfixSASLCollector_ServeHTTP(t *testing.T) {
+	c := newSASLCollector(t, 10)
+	handleLines(t, c,
+		"2020-04-01T12:00:00Z mail postfix/smtpd[1]: warning: unknown[192.0.2.1]: SASL LOGIN authentication failed: UGFzc3dvcmQ6",
+	)
+
+	w := httptest.NewRecorder()
+	c.(*collector.PostfixSASLCollector).ServeHTTP(w, httptest.NewRequest("GET", "/api/sasl/offenders", nil))
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected `application/json`, but actual is `%s`", w.Header().Get("Content-Type"))
+	}
+	var offenders collector.SASLOffenders
+	if err := json.Unmarshal(w.Body.Bytes(), &offenders); err != nil {
+		t.Fatal(err)
+	}
+	expected := collector.SASLOffenders{
+		Window:    "1h",
+		Addresses: []collector.SASLOffender{{Address: "192.0.2.1", Failures: 0.5, TotalFailures: 1, LastSeen: time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)}},
+		Networks:  []collector.SASLOffender{{Network: "192.0.2.0/24", Failures: 0.5, TotalFailures: 1, LastSeen: time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)}},
+	}
+	if !reflect.DeepEqual(offenders, expected) {
+		t.Errorf("expected `%+v`, but actual is `%+v`", expected, offenders)
+	}
+}
@@ -0,0 +1,302 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/k-kinzal/postfix-prometheus-exporter/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerCollector("sasl_users", defaultDisabled, NewPostfixSASLUsersCollector)
+}
+
+var (
+	saslUserMessagesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sasl_user", "messages"),
+		"Number of messages submitted by the top SASL users in the sliding window, by sasl_username.",
+		[]string{"sasl_username"},
+		nil,
+	)
+	saslUserRecipientsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sasl_user", "recipients"),
+		"Number of recipients of the messages submitted by the top SASL users in the sliding window, by sasl_username.",
+		[]string{"sasl_username"},
+		nil,
+	)
+	saslUserRateAnomalyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sasl_user", "rate_anomaly"),
+		"Ratio of the recipients in the sliding window to the learned recipients per window of the most anomalous SASL users, by sasl_username.",
+		[]string{"sasl_username"},
+		nil,
+	)
+)
+
+// saslUser is the sliding window and the learned baseline of a SASL user.
+// The window is a ring of buckets, and head is the index of the latest bucket since the epoch.
+type saslUser struct {
+	name       string
+	messages   []float64
+	recipients []float64
+	head       int64
+	// baseline is the learned number of recipients per window, the moving average of the completed buckets.
+	// learned is true once a bucket is completed, so that the user has the baseline.
+	baseline float64
+	learned  bool
+	lastSeen time.Time
+}
+
+// saslUserScore is the statistics of a SASL user at a time.
+// The anomaly is valid only if learned is true.
+type saslUserScore struct {
+	name       string
+	messages   float64
+	recipients float64
+	anomaly    float64
+	learned    bool
+}
+
+// pendingMessage is a message of a SASL user waiting for qmgr.
+type pendingMessage struct {
+	user     string
+	received time.Time
+}
+
+// PostfixSASLUsersCollector correlates the messages submitted by SASL users with qmgr by queue ID in the log input,
+// and exposes the top users by the messages and the recipients in a sliding window,
+// and the anomaly of the recipients against the baseline learned for each user.
+// The window slides by the time of the log, so that the statistics do not depend on the delay of the log input.
+type PostfixSASLUsersCollector struct {
+	cfg    config.SASLUsersCollectorConfig
+	mask   func(string) string
+	logger log.Logger
+
+	// width is the width of a bucket, and alpha is the weight of a completed bucket in the baseline.
+	width time.Duration
+	alpha float64
+
+	mu      sync.Mutex
+	users   map[string]*saslUser
+	pending map[string]pendingMessage
+	// latest is the time of the newest event seen.
+	latest time.Time
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixSASLUsersCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent remembers the SASL user of the queue ID of smtpd, and counts the message of qmgr for the user.
+func (c *PostfixSASLUsersCollector) HandleEvent(e *maillog.Event) {
+	c.mu.Lock()
+	if e.Time.After(c.latest) {
+		c.latest = e.Time
+	}
+	c.mu.Unlock()
+
+	if !e.IsPostfix() || e.QueueID == "" {
+		return
+	}
+	switch e.Process {
+	case "smtpd":
+		client, ok := maillog.ParseClient(e.Payload)
+		if !ok || client.SASLUsername == "" {
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if _, ok := c.pending[e.QueueID]; !ok && len(c.pending) >= c.cfg.MaxPending {
+			c.evictPending()
+		}
+		c.pending[e.QueueID] = pendingMessage{user: c.mask(client.SASLUsername), received: e.Time}
+	case "qmgr":
+		active, ok := maillog.ParseActive(e.Payload)
+		if !ok {
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// qmgr logs a deferred message again when it retries, so that only the first one is counted.
+		p, ok := c.pending[e.QueueID]
+		if !ok {
+			return
+		}
+		delete(c.pending, e.QueueID)
+		c.add(p.user, e.Time, float64(active.Nrcpt))
+	}
+}
+
+// evictPending forgets the oldest queue ID waiting for qmgr.
+func (c *PostfixSASLUsersCollector) evictPending() {
+	var oldest string
+	var received time.Time
+	for queueID, p := range c.pending {
+		if oldest == "" || p.received.Before(received) {
+			oldest, received = queueID, p.received
+		}
+	}
+	delete(c.pending, oldest)
+}
+
+// add counts a message with the recipients of the user at t.
+func (c *PostfixSASLUsersCollector) add(name string, t time.Time, recipients float64) {
+	idx := t.UnixNano() / int64(c.width)
+	u, ok := c.users[name]
+	if !ok {
+		if len(c.users) >= c.cfg.MaxUsers {
+			c.evictUser()
+		}
+		u = &saslUser{
+			name:       name,
+			messages:   make([]float64, c.cfg.Buckets),
+			recipients: make([]float64, c.cfg.Buckets),
+			head:       idx,
+		}
+		c.users[name] = u
+	}
+	c.advance(u, idx)
+	if u.head-idx >= int64(c.cfg.Buckets) {
+		return
+	}
+	u.messages[idx%int64(c.cfg.Buckets)]++
+	u.recipients[idx%int64(c.cfg.Buckets)] += recipients
+	if t.After(u.lastSeen) {
+		u.lastSeen = t
+	}
+}
+
+// evictUser forgets the user seen least recently.
+func (c *PostfixSASLUsersCollector) evictUser() {
+	var oldest *saslUser
+	for _, u := range c.users {
+		if oldest == nil || u.lastSeen.Before(oldest.lastSeen) {
+			oldest = u
+		}
+	}
+	delete(c.users, oldest.name)
+}
+
+// advance slides the window of the user so that the latest bucket is idx.
+// The head bucket and the empty buckets after it are completed, and learned into the baseline.
+func (c *PostfixSASLUsersCollector) advance(u *saslUser, idx int64) {
+	if idx <= u.head {
+		return
+	}
+	n := int64(c.cfg.Buckets)
+	u.baseline += c.alpha * (u.recipients[u.head%n]*float64(n) - u.baseline)
+	u.baseline *= math.Pow(1-c.alpha, float64(idx-u.head-1))
+	u.learned = true
+	for i := u.head + 1; i <= idx && i <= u.head+n; i++ {
+		u.messages[i%n] = 0
+		u.recipients[i%n] = 0
+	}
+	u.head = idx
+}
+
+// scores returns the statistics of all users at the time of the newest event.
+func (c *PostfixSASLUsersCollector) scores() []saslUserScore {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx := c.latest.UnixNano() / int64(c.width)
+	scores := make([]saslUserScore, 0, len(c.users))
+	for _, u := range c.users {
+		c.advance(u, idx)
+		s := saslUserScore{name: u.name, learned: u.learned}
+		for i := range u.messages {
+			s.messages += u.messages[i]
+			s.recipients += u.recipients[i]
+		}
+		s.anomaly = s.recipients / math.Max(u.baseline, 1)
+		scores = append(scores, s)
+	}
+	return scores
+}
+
+// topSASLUsers returns up to n users in descending order of the value.
+func topSASLUsers(scores []saslUserScore, n int, value func(s saslUserScore) float64) []saslUserScore {
+	sorted := make([]saslUserScore, len(scores))
+	copy(sorted, scores)
+	sort.Slice(sorted, func(i, j int) bool {
+		if value(sorted[i]) != value(sorted[j]) {
+			return value(sorted[i]) > value(sorted[j])
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixSASLUsersCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.SASLUsers
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixSASLUsersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- saslUserMessagesDesc
+	ch <- saslUserRecipientsDesc
+	ch <- saslUserRateAnomalyDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+// The messages and the recipients are exposed for the top users by the recipients,
+// and the anomaly for the top users by the anomaly among the users that have the baseline.
+func (c *PostfixSASLUsersCollector) Collect(ch chan<- prometheus.Metric) {
+	scores := c.scores()
+	for _, s := range topSASLUsers(scores, c.cfg.TopN, func(s saslUserScore) float64 { return s.recipients }) {
+		ch <- prometheus.MustNewConstMetric(saslUserMessagesDesc, prometheus.GaugeValue, s.messages, s.name)
+		ch <- prometheus.MustNewConstMetric(saslUserRecipientsDesc, prometheus.GaugeValue, s.recipients, s.name)
+	}
+	learned := make([]saslUserScore, 0, len(scores))
+	for _, s := range scores {
+		if s.learned {
+			learned = append(learned, s)
+		}
+	}
+	for _, s := range topSASLUsers(learned, c.cfg.TopN, func(s saslUserScore) float64 { return s.anomaly }) {
+		ch <- prometheus.MustNewConstMetric(saslUserRateAnomalyDesc, prometheus.GaugeValue, s.anomaly, s.name)
+	}
+}
+
+// NewPostfixSASLUsersCollector returns new PostfixSASLUsersCollector.
+func NewPostfixSASLUsersCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.SASLUsers
+	var mask func(string) string
+	switch cfg.Mask.Policy {
+	case "hash":
+		mask = util.Pseudonym
+	case "local_part":
+		mask = util.EmailMask
+	case "full":
+		mask = util.EmailRedact
+	case "none":
+		mask = func(s string) string { return s }
+	default:
+		return nil, fmt.Errorf("collectors.sasl_users.mask.policy: unknown policy `%s`", cfg.Mask.Policy)
+	}
+
+	width := time.Duration(cfg.Window) / time.Duration(cfg.Buckets)
+	return &PostfixSASLUsersCollector{
+		cfg:     cfg,
+		mask:    mask,
+		logger:  logger,
+		width:   width,
+		alpha:   1 - math.Exp2(-float64(width)/float64(cfg.BaselineHalfLife)),
+		users:   make(map[string]*saslUser),
+		pending: make(map[string]pendingMessage),
+	}, nil
+}
@@ -0,0 +1,129 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSASLUsersCollector(t *testing.T, maxPending int, mask string) collector.Collector {
+	t.Helper()
+	cfg := config.DefaultConfig
+	cfg.Collectors.SASLUsers.Window = model.Duration(time.Hour)
+	cfg.Collectors.SASLUsers.Buckets = 2
+	cfg.Collectors.SASLUsers.BaselineHalfLife = model.Duration(30 * time.Minute)
+	cfg.Collectors.SASLUsers.TopN = 2
+	cfg.Collectors.SASLUsers.MaxPending = maxPending
+	cfg.Collectors.SASLUsers.Mask.Policy = mask
+	// The wall clock is far after the log, which must not slide the window.
+	now := func() time.Time { return time.Date(2030, 4, 1, 12, 0, 0, 0, time.UTC) }
+	c, err := collector.NewPostfixSASLUsersCollector(&collector.Options{Config: &cfg, Now: now}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPostfixSASLUsersCollector_HandleEvent(t *testing.T) {
+	c := newSASLUsersCollector(t, 10, "none")
+	handleLines(t, c,
+		"2020-04-01T11:00:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B1: client=unknown[192.0.2.1], sasl_method=PLAIN, sasl_username=alice@example.com",
+		"2020-04-01T11:00:00Z mail postfix/qmgr[1]: 3F8C41A2B1: from=<alice@example.com>, size=1234, nrcpt=8 (queue active)",
+		"2020-04-01T12:30:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B2: client=unknown[192.0.2.1], sasl_method=PLAIN, sasl_username=alice@example.com",
+		"2020-04-01T12:30:00Z mail postfix/qmgr[1]: 3F8C41A2B2: from=<alice@example.com>, size=1234, nrcpt=5 (queue active)",
+		"2020-04-01T12:40:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B3: client=unknown[192.0.2.1], sasl_method=PLAIN, sasl_username=alice@example.com",
+		"2020-04-01T12:40:00Z mail postfix/qmgr[1]: 3F8C41A2B3: from=<alice@example.com>, size=1234, nrcpt=1 (queue active)",
+		"2020-04-01T12:44:00Z mail postfix/qmgr[1]: 3F8C41A2B3: from=<alice@example.com>, size=1234, nrcpt=1 (queue active)",
+		// The anomaly of bob is not exposed until a step of the window is learned into the baseline.
+		"2020-04-01T12:40:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B4: client=unknown[198.51.100.1], sasl_method=LOGIN, sasl_username=bob@example.com",
+		"2020-04-01T12:40:00Z mail postfix/qmgr[1]: 3F8C41A2B4: from=<bob@example.com>, size=1234, nrcpt=10 (queue active)",
+		"2020-04-01T12:40:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B5: client=unknown[203.0.113.1], sasl_method=LOGIN, sasl_username=eve@example.com",
+		"2020-04-01T12:40:00Z mail postfix/qmgr[1]: 3F8C41A2B5: from=<eve@example.com>, size=1234, nrcpt=1 (queue active)",
+		"2020-04-01T12:40:00Z mail postfix/smtpd[1]: 3F8C41A2B6: client=client.example.com[192.0.2.2]",
+		"2020-04-01T12:40:00Z mail postfix/qmgr[1]: 3F8C41A2B6: from=<sender@example.com>, size=1234, nrcpt=50 (queue active)",
+	)
+
+	expected := `
+# HELP postfix_sasl_user_messages Number of messages submitted by the top SASL users in the sliding window, by sasl_username.
+# TYPE postfix_sasl_user_messages gauge
+postfix_sasl_user_messages{sasl_username="alice@example.com"} 2
+postfix_sasl_user_messages{sasl_username="bob@example.com"} 1
+# HELP postfix_sasl_user_rate_anomaly Ratio of the recipients in the sliding window to the learned recipients per window of the most anomalous SASL users, by sasl_username.
+# TYPE postfix_sasl_user_rate_anomaly gauge
+postfix_sasl_user_rate_anomaly{sasl_username="alice@example.com"} 3
+# HELP postfix_sasl_user_recipients Number of recipients of the messages submitted by the top SASL users in the sliding window, by sasl_username.
+# TYPE postfix_sasl_user_recipients gauge
+postfix_sasl_user_recipients{sasl_username="alice@example.com"} 6
+postfix_sasl_user_recipients{sasl_username="bob@example.com"} 10
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostfixSASLUsersCollector_EvictPending(t *testing.T) {
+	c := newSASLUsersCollector(t, 1, "none")
+	handleLines(t, c,
+		"2020-04-01T12:40:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B1: client=unknown[192.0.2.1], sasl_method=PLAIN, sasl_username=alice@example.com",
+		"2020-04-01T12:40:01Z mail postfix/submission/smtpd[1]: 3F8C41A2B2: client=unknown[198.51.100.1], sasl_method=PLAIN, sasl_username=bob@example.com",
+		"2020-04-01T12:40:02Z mail postfix/qmgr[1]: 3F8C41A2B1: from=<alice@example.com>, size=1234, nrcpt=1 (queue active)",
+		"2020-04-01T12:40:02Z mail postfix/qmgr[1]: 3F8C41A2B2: from=<bob@example.com>, size=1234, nrcpt=1 (queue active)",
+	)
+
+	expected := `
+# HELP postfix_sasl_user_messages Number of messages submitted by the top SASL users in the sliding window, by sasl_username.
+# TYPE postfix_sasl_user_messages gauge
+postfix_sasl_user_messages{sasl_username="bob@example.com"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "postfix_sasl_user_messages"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPostfixSASLUsersCollector_HandleEventMask(t *testing.T) {
+	lines := []string{
+		"2020-04-01T12:40:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B1: client=unknown[192.0.2.1], sasl_method=PLAIN, sasl_username=alice@example.com",
+		"2020-04-01T12:40:00Z mail postfix/qmgr[1]: 3F8C41A2B1: from=<alice@example.com>, size=1234, nrcpt=1 (queue active)",
+		"2020-04-01T12:40:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B2: client=unknown[198.51.100.1], sasl_method=LOGIN, sasl_username=bob@example.com",
+		"2020-04-01T12:40:00Z mail postfix/qmgr[1]: 3F8C41A2B2: from=<bob@example.com>, size=1234, nrcpt=2 (queue active)",
+		"2020-04-01T12:40:00Z mail postfix/submission/smtpd[1]: 3F8C41A2B3: client=unknown[203.0.113.1], sasl_method=LOGIN, sasl_username=carol",
+		"2020-04-01T12:40:00Z mail postfix/qmgr[1]: 3F8C41A2B3: from=<carol@example.net>, size=1234, nrcpt=1 (queue active)",
+	}
+	cases := []struct {
+		policy   string
+		expected string
+	}{
+		{
+			// The users are kept apart by their pseudonyms.
+			"hash",
+			`
+# HELP postfix_sasl_user_messages Number of messages submitted by the top SASL users in the sliding window, by sasl_username.
+# TYPE postfix_sasl_user_messages gauge
+postfix_sasl_user_messages{sasl_username="4c26d9074c27"} 1
+postfix_sasl_user_messages{sasl_username="5ff860bf1190"} 1
+`,
+		},
+		{
+			// The users of a domain are counted together.
+			"local_part",
+			`
+# HELP postfix_sasl_user_messages Number of messages submitted by the top SASL users in the sliding window, by sasl_username.
+# TYPE postfix_sasl_user_messages gauge
+postfix_sasl_user_messages{sasl_username="***@example.com"} 2
+postfix_sasl_user_messages{sasl_username="carol"} 1
+`,
+		},
+	}
+	for _, tc := range cases {
+		c := newSASLUsersCollector(t, 10, tc.policy)
+		handleLines(t, c, lines...)
+		if err := testutil.CollectAndCompare(c, strings.NewReader(tc.expected), "postfix_sasl_user_messages"); err != nil {
+			t.Errorf("%s: %v", tc.policy, err)
+		}
+	}
+}
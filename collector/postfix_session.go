@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"reflect"
+	"strings"
+)
+
+func init() {
+	registerCollector("session", defaultDisabled, NewPostfixSessionCollector)
+}
+
+// PostfixSessionCollector collects the statistics of the SMTP sessions of smtpd from the disconnect lines in the log input,
+// by the service name (e.g. postfix/smtpd or postfix/submission/smtpd).
+type PostfixSessionCollector struct {
+	cfg    config.SessionCollectorConfig
+	logger log.Logger
+
+	// metrics
+	attemptsCounter   *prometheus.CounterVec
+	successesCounter  *prometheus.CounterVec
+	commandsHistogram *prometheus.HistogramVec
+	errorsCounter     *prometheus.CounterVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixSessionCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the commands of the disconnect, or the error of the session that ended abnormally.
+func (c *PostfixSessionCollector) HandleEvent(e *maillog.Event) {
+	if !e.IsPostfix() || e.Process != "smtpd" {
+		return
+	}
+	if d, ok := maillog.ParseDisconnect(e.Payload); ok {
+		for _, cmd := range d.Commands {
+			c.attemptsCounter.WithLabelValues(e.Service, cmd.Name).Add(float64(cmd.Total))
+			c.successesCounter.WithLabelValues(e.Service, cmd.Name).Add(float64(cmd.Success))
+		}
+		// Postfix before 3.0 logs no statistics of the commands.
+		if d.Total != nil {
+			c.commandsHistogram.WithLabelValues(e.Service).Observe(float64(d.Total.Total))
+		}
+		return
+	}
+	if err, stage, ok := maillog.ParseSessionError(e.Payload); ok {
+		c.errorsCounter.WithLabelValues(e.Service, strings.Replace(err, " ", "_", -1), stage).Inc()
+	}
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixSessionCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.Session
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixSessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.attemptsCounter.Describe(ch)
+	c.successesCounter.Describe(ch)
+	c.commandsHistogram.Describe(ch)
+	c.errorsCounter.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixSessionCollector) Collect(ch chan<- prometheus.Metric) {
+	c.attemptsCounter.Collect(ch)
+	c.successesCounter.Collect(ch)
+	c.commandsHistogram.Collect(ch)
+	c.errorsCounter.Collect(ch)
+}
+
+// NewPostfixSessionCollector returns new PostfixSessionCollector.
+func NewPostfixSessionCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.Session
+	return &PostfixSessionCollector{
+		cfg:    cfg,
+		logger: logger,
+		attemptsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "smtpd",
+				Name:      "command_attempts_total",
+				Help:      "Total number of SMTP commands attempted in the sessions of smtpd, by service and command.",
+			},
+			[]string{"service", "command"}),
+		successesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "smtpd",
+				Name:      "command_successes_total",
+				Help:      "Total number of SMTP commands succeeded in the sessions of smtpd, by service and command.",
+			},
+			[]string{"service", "command"}),
+		commandsHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "smtpd",
+				Name:      "session_commands",
+				Help:      "Number of SMTP commands attempted in a session of smtpd, by service.",
+				Buckets:   cfg.CommandsBuckets,
+			},
+			[]string{"service"}),
+		errorsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "smtpd",
+				Name:      "session_errors_total",
+				Help:      "Total number of sessions of smtpd that ended by lost_connection, timeout or too_many_errors, by service, error and SMTP stage.",
+			},
+			[]string{"service", "error", "stage"}),
+	}, nil
+}
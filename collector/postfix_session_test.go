@@ -0,0 +1,75 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+func TestPostfixSessionCollector_HandleEvent(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.Session.CommandsBuckets = []float64{3, 10}
+	c, err := collector.NewPostfixSessionCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: disconnect from unknown[192.0.2.1] ehlo=1 mail=1 rcpt=0/1 data=0/1 quit=1 commands=3/5",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: disconnect from unknown[192.0.2.2] ehlo=1 quit=1 commands=2",
+		"Apr  1 12:00:00 mail postfix/submission/smtpd[1]: disconnect from unknown[192.0.2.3] ehlo=2 starttls=1 auth=0/3 commands=3/6",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: lost connection after DATA (0 bytes) from unknown[192.0.2.4]",
+		"Apr  1 12:00:00 mail postfix/submission/smtpd[1]: too many errors after AUTH from unknown[192.0.2.3]",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: timeout after CONNECT from unknown[192.0.2.5]",
+		"Apr  1 12:00:00 mail postfix/postscreen[1]: DISCONNECT [192.0.2.6]:10025",
+		"Apr  1 12:00:00 mail postfix/smtp[1]: disconnect from mx.example.com[192.0.2.7] commands=1",
+		// The session without commands (e.g. a port scan) is observed, and the disconnect without the statistics is not.
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: disconnect from unknown[192.0.2.9] commands=0/0",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: disconnect from unknown[192.0.2.8]",
+	)
+
+	expected := `
+# HELP postfix_smtpd_command_attempts_total Total number of SMTP commands attempted in the sessions of smtpd, by service and command.
+# TYPE postfix_smtpd_command_attempts_total counter
+postfix_smtpd_command_attempts_total{command="auth",service="postfix/submission/smtpd"} 3
+postfix_smtpd_command_attempts_total{command="data",service="postfix/smtpd"} 1
+postfix_smtpd_command_attempts_total{command="ehlo",service="postfix/smtpd"} 2
+postfix_smtpd_command_attempts_total{command="ehlo",service="postfix/submission/smtpd"} 2
+postfix_smtpd_command_attempts_total{command="mail",service="postfix/smtpd"} 1
+postfix_smtpd_command_attempts_total{command="quit",service="postfix/smtpd"} 2
+postfix_smtpd_command_attempts_total{command="rcpt",service="postfix/smtpd"} 1
+postfix_smtpd_command_attempts_total{command="starttls",service="postfix/submission/smtpd"} 1
+# HELP postfix_smtpd_command_successes_total Total number of SMTP commands succeeded in the sessions of smtpd, by service and command.
+# TYPE postfix_smtpd_command_successes_total counter
+postfix_smtpd_command_successes_total{command="auth",service="postfix/submission/smtpd"} 0
+postfix_smtpd_command_successes_total{command="data",service="postfix/smtpd"} 0
+postfix_smtpd_command_successes_total{command="ehlo",service="postfix/smtpd"} 2
+postfix_smtpd_command_successes_total{command="ehlo",service="postfix/submission/smtpd"} 2
+postfix_smtpd_command_successes_total{command="mail",service="postfix/smtpd"} 1
+postfix_smtpd_command_successes_total{command="quit",service="postfix/smtpd"} 2
+postfix_smtpd_command_successes_total{command="rcpt",service="postfix/smtpd"} 0
+postfix_smtpd_command_successes_total{command="starttls",service="postfix/submission/smtpd"} 1
+# HELP postfix_smtpd_session_commands Number of SMTP commands attempted in a session of smtpd, by service.
+# TYPE postfix_smtpd_session_commands histogram
+postfix_smtpd_session_commands_bucket{service="postfix/smtpd",le="3"} 2
+postfix_smtpd_session_commands_bucket{service="postfix/smtpd",le="10"} 3
+postfix_smtpd_session_commands_bucket{service="postfix/smtpd",le="+Inf"} 3
+postfix_smtpd_session_commands_sum{service="postfix/smtpd"} 7
+postfix_smtpd_session_commands_count{service="postfix/smtpd"} 3
+postfix_smtpd_session_commands_bucket{service="postfix/submission/smtpd",le="3"} 0
+postfix_smtpd_session_commands_bucket{service="postfix/submission/smtpd",le="10"} 1
+postfix_smtpd_session_commands_bucket{service="postfix/submission/smtpd",le="+Inf"} 1
+postfix_smtpd_session_commands_sum{service="postfix/submission/smtpd"} 6
+postfix_smtpd_session_commands_count{service="postfix/submission/smtpd"} 1
+# HELP postfix_smtpd_session_errors_total Total number of sessions of smtpd that ended by lost_connection, timeout or too_many_errors, by service, error and SMTP stage.
+# TYPE postfix_smtpd_session_errors_total counter
+postfix_smtpd_session_errors_total{error="lost_connection",service="postfix/smtpd",stage="DATA"} 1
+postfix_smtpd_session_errors_total{error="timeout",service="postfix/smtpd",stage="CONNECT"} 1
+postfix_smtpd_session_errors_total{error="too_many_errors",service="postfix/submission/smtpd",stage="AUTH"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus"
+	"reflect"
+	"strings"
+)
+
+func init() {
+	registerCollector("tls", defaultDisabled, NewPostfixTLSCollector)
+}
+
+// tlsRequiredText is the response of the deferrals of the destinations that require TLS but do not offer STARTTLS.
+const tlsRequiredText = "TLS is required, but was not offered"
+
+// PostfixTLSCollector counts the TLS connections, the failed TLS handshakes of the SMTP client and server,
+// and the deferrals of the destinations that do not offer the required TLS, in the log input.
+type PostfixTLSCollector struct {
+	cfg          config.TLSCollectorConfig
+	destinations *labelLimiter
+	logger       log.Logger
+
+	// metrics
+	connectionsCounter *prometheus.CounterVec
+	failuresCounter    *prometheus.CounterVec
+	deferralsCounter   *prometheus.CounterVec
+}
+
+// Update implements the Collector interface.
+// The statistics are updated by the events of the log input, so that there is nothing to read.
+func (c *PostfixTLSCollector) Update(ctx context.Context) error {
+	return nil
+}
+
+// HandleEvent counts the TLS connection, the failed TLS handshake or the deferral of the event.
+func (c *PostfixTLSCollector) HandleEvent(e *maillog.Event) {
+	if !e.IsPostfix() {
+		return
+	}
+	if conn, ok := maillog.ParseTLSConnection(e.Payload); ok {
+		direction, destination := c.peer(conn.Outbound, conn.PeerHost())
+		c.connectionsCounter.WithLabelValues(direction, destination, conn.Protocol, conn.Cipher, strings.ToLower(conn.Trust)).Inc()
+		return
+	}
+	if f, ok := maillog.ParseTLSFailure(e.Payload); ok {
+		c.failuresCounter.WithLabelValues(c.peer(f.Outbound, f.PeerHost())).Inc()
+		return
+	}
+	if e.QueueID == "" {
+		return
+	}
+	if d, ok := maillog.ParseDelivery(e.Payload); ok && d.Status == "deferred" && strings.HasPrefix(d.Response, tlsRequiredText) {
+		c.deferralsCounter.WithLabelValues(c.destinations.value(d.RelayHost())).Inc()
+	}
+}
+
+// peer returns the direction and the destination label of a peer.
+// The destination of the connections from clients is empty, because the clients are not bounded.
+func (c *PostfixTLSCollector) peer(outbound bool, host string) (string, string) {
+	if !outbound {
+		return "inbound", ""
+	}
+	return "outbound", c.destinations.value(host)
+}
+
+// Reusable implements the Reusable interface.
+func (c *PostfixTLSCollector) Reusable(opts *Options) bool {
+	cfg := opts.config().Collectors.TLS
+	cfg.CollectorConfig = c.cfg.CollectorConfig
+	return reflect.DeepEqual(cfg, c.cfg)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *PostfixTLSCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.connectionsCounter.Describe(ch)
+	c.failuresCounter.Describe(ch)
+	c.deferralsCounter.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *PostfixTLSCollector) Collect(ch chan<- prometheus.Metric) {
+	c.connectionsCounter.Collect(ch)
+	c.failuresCounter.Collect(ch)
+	c.deferralsCounter.Collect(ch)
+}
+
+// NewPostfixTLSCollector returns new PostfixTLSCollector.
+func NewPostfixTLSCollector(opts *Options, logger log.Logger) (Collector, error) {
+	cfg := opts.config().Collectors.TLS
+	return &PostfixTLSCollector{
+		cfg:          cfg,
+		destinations: newLabelLimiter(cfg.MaxDestinations),
+		logger:       logger,
+		connectionsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "tls",
+				Name:      "connections_total",
+				Help:      "Total number of established TLS connections, by direction, destination, protocol version, cipher and trust level.",
+			},
+			[]string{"direction", "destination", "protocol", "cipher", "trust"}),
+		failuresCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "tls",
+				Name:      "handshake_failures_total",
+				Help:      "Total number of failed TLS handshakes, by direction and destination.",
+			},
+			[]string{"direction", "destination"}),
+		deferralsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "tls",
+				Name:      "required_deferrals_total",
+				Help:      "Total number of deliveries deferred because TLS is required but was not offered, by destination.",
+			},
+			[]string{"destination"}),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package collector_test
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+func TestPostfixTLSCollector_HandleEvent(t *testing.T) {
+	cfg := config.DefaultConfig
+	cfg.Collectors.TLS.MaxDestinations = 2
+	c, err := collector.NewPostfixTLSCollector(&collector.Options{Config: &cfg}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleLines(t, c,
+		"Apr  1 12:00:00 mail postfix/smtp[1]: Verified TLS connection established to mx.example.com[192.0.2.1]:25: TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits) key-exchange X25519 server-signature RSA-PSS (2048 bits) server-digest SHA256",
+		"Apr  1 12:00:00 mail postfix/smtp[1]: Untrusted TLS connection established to mx.example.net[192.0.2.2]:25: TLSv1.2 with cipher ECDHE-RSA-AES256-GCM-SHA384 (256/256 bits)",
+		"Apr  1 12:00:00 mail postfix/smtp[1]: Trusted TLS connection established to mx.example.org[192.0.2.3]:25: TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits)",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: Anonymous TLS connection established from unknown[192.0.2.4]: TLSv1.3 with cipher TLS_AES_128_GCM_SHA256 (128/128 bits)",
+		"Apr  1 12:00:00 mail postfix/submission/smtpd[1]: Anonymous TLS connection established from client.example.com[192.0.2.5]: TLSv1.3 with cipher TLS_AES_128_GCM_SHA256 (128/128 bits)",
+		"Apr  1 12:00:00 mail postfix/smtpd[1]: SSL_accept error from unknown[192.0.2.6]: lost connection",
+		"Apr  1 12:00:00 mail postfix/smtp[1]: SSL_connect error to mx.example.com[192.0.2.1]:25: -1",
+		"Apr  1 12:00:00 mail postfix/smtp[1]: 3F8C41A2B3: to=<user@example.com>, relay=mx.example.com[192.0.2.1]:25, delay=1.2, delays=0.1/0/1.1/0, dsn=4.7.4, status=deferred (TLS is required, but was not offered by host mx.example.com[192.0.2.1])",
+		"Apr  1 12:00:00 mail postfix/smtp[1]: 3F8C41A2B4: to=<user@example.com>, relay=mx.example.com[192.0.2.1]:25, delay=1.2, delays=0.1/0/1.1/0, dsn=4.4.1, status=deferred (connect to mx.example.com[192.0.2.1]:25: Connection timed out)",
+	)
+
+	expected := `
+# HELP postfix_tls_connections_total Total number of established TLS connections, by direction, destination, protocol version, cipher and trust level.
+# TYPE postfix_tls_connections_total counter
+postfix_tls_connections_total{cipher="ECDHE-RSA-AES256-GCM-SHA384",destination="mx.example.net",direction="outbound",protocol="TLSv1.2",trust="untrusted"} 1
+postfix_tls_connections_total{cipher="TLS_AES_128_GCM_SHA256",destination="",direction="inbound",protocol="TLSv1.3",trust="anonymous"} 2
+postfix_tls_connections_total{cipher="TLS_AES_256_GCM_SHA384",destination="mx.example.com",direction="outbound",protocol="TLSv1.3",trust="verified"} 1
+postfix_tls_connections_total{cipher="TLS_AES_256_GCM_SHA384",destination="other",direction="outbound",protocol="TLSv1.3",trust="trusted"} 1
+# HELP postfix_tls_handshake_failures_total Total number of failed TLS handshakes, by direction and destination.
+# TYPE postfix_tls_handshake_failures_total counter
+postfix_tls_handshake_failures_total{destination="",direction="inbound"} 1
+postfix_tls_handshake_failures_total{destination="mx.example.com",direction="outbound"} 1
+# HELP postfix_tls_required_deferrals_total Total number of deliveries deferred because TLS is required but was not offered, by destination.
+# TYPE postfix_tls_required_deferrals_total counter
+postfix_tls_required_deferrals_total{destination="mx.example.com"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
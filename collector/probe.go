@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Probe collects statistics of the queue from the showq target once, and registers them to registry.
+// It returns whether the collection succeeded.
+func Probe(ctx context.Context, target string, module *config.ModuleConfig, cfg *config.Config, registry *prometheus.Registry, logger log.Logger) bool {
+	opt, err := postfix.ParseShowqURL(target)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid target", "err", err)
+		return false
+	}
+	processors := module.Processors
+	if processors == nil {
+		processors = cfg.Processors
+	}
+	pipeline, err := NewPipeline(processors)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid processors", "err", err)
+		return false
+	}
+
+	opts := &Options{
+		Instances:  []Instance{{PostQueue: postfix.NewPostQueue(opt)}},
+		Processors: pipeline,
+		Config:     cfg,
+	}
+	c, err := NewPostfixQueueCollector(opts, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Couldn't create collector", "err", err)
+		return false
+	}
+	registry.MustRegister(c)
+	if err := c.Update(ctx); err != nil {
+		level.Error(logger).Log("msg", "Probe failed", "err", err)
+		return false
+	}
+	return true
+}
+
+// ProbeHandler returns a handler of GET /probe?target=<showq-url>&module=<name>.
+// The response has only the metrics of the target, with probe_success and probe_duration_seconds.
+// The probe is bounded by the timeout of the module and the X-Prometheus-Scrape-Timeout-Seconds header minus offset.
+// getConfig returns the current configuration, so that modules are reloaded.
+func ProbeHandler(getConfig func() *config.Config, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := getConfig()
+		params := r.URL.Query()
+
+		target := params.Get("target")
+		if target == "" {
+			http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+			return
+		}
+		moduleName := params.Get("module")
+		if moduleName == "" {
+			moduleName = "default"
+		}
+		module, ok := cfg.Modules[moduleName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+			return
+		}
+
+		timeout := time.Duration(module.Timeout)
+		if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+			seconds, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				http.Error(w, "Failed to parse timeout from Prometheus header: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			scrapeTimeout := time.Duration(seconds*float64(time.Second)) - time.Duration(cfg.Global.ScrapeTimeoutOffset)
+			if scrapeTimeout <= 0 {
+				scrapeTimeout = time.Duration(seconds * float64(time.Second))
+			}
+			if timeout == 0 || scrapeTimeout < timeout {
+				timeout = scrapeTimeout
+			}
+		}
+		ctx := r.Context()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		probeSuccessGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_success",
+			Help: "Displays whether or not the probe was a success.",
+		})
+		probeDurationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_duration_seconds",
+			Help: "Returns how long the probe took to complete in seconds.",
+		})
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(probeSuccessGauge, probeDurationGauge)
+
+		l := log.With(logger, "module", moduleName, "target", target)
+		begin := time.Now()
+		success := Probe(ctx, target, &module, cfg, registry, l)
+		duration := time.Since(begin)
+		probeDurationGauge.Set(duration.Seconds())
+		if success {
+			probeSuccessGauge.Set(1)
+			level.Debug(l).Log("msg", "Probe succeeded", "duration_seconds", duration.Seconds())
+		} else {
+			level.Debug(l).Log("msg", "Probe failed", "duration_seconds", duration.Seconds())
+		}
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
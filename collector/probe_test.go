@@ -0,0 +1,80 @@
+package collector_test
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func probe(t *testing.T, cfg *config.Config, params url.Values) *httptest.ResponseRecorder {
+	handler := collector.ProbeHandler(func() *config.Config { return cfg }, log.NewNopLogger())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/probe?"+params.Encode(), nil))
+	return w
+}
+
+func TestProbeHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	addr, _ := mock.ServeTCP(ctx, mock.ShowqMessageGen(3))
+	cfg, err := config.Load(`
+modules:
+  domains:
+    timeout: 5s
+    processors:
+      - domain: {label: sender_domain, source: sender}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := probe(t, cfg, url.Values{"target": {"tcp://" + addr}, "module": {"domains"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected `%d`, but actual is `%d`", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{
+		"probe_success 1",
+		"probe_duration_seconds ",
+		`postfix_queue_size_bytes_count{queue_name="deferred",sender_domain="example.com"} 3`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected `%s` in the response, but actual is `%s`", expected, body)
+		}
+	}
+	if strings.Contains(body, "postfix_scope_collector_success") {
+		t.Errorf("expected only the metrics of the target, but actual is `%s`", body)
+	}
+}
+
+func TestProbeHandlerFailure(t *testing.T) {
+	w := probe(t, &config.DefaultConfig, url.Values{"target": {"unix:///nonexistent/showq"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected `%d`, but actual is `%d`", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "probe_success 0") {
+		t.Errorf("expected `probe_success 0`, but actual is `%s`", w.Body.String())
+	}
+}
+
+func TestProbeHandlerBadRequest(t *testing.T) {
+	cases := []url.Values{
+		{},
+		{"target": {"/var/spool/postfix/public/showq"}, "module": {"unknown"}},
+	}
+	for _, params := range cases {
+		w := probe(t, &config.DefaultConfig, params)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected `%d`, but actual is `%d`", params.Encode(), http.StatusBadRequest, w.Code)
+		}
+	}
+}
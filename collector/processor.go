@@ -0,0 +1,353 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/showq"
+	"github.com/k-kinzal/postfix-prometheus-exporter/util"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Message is a message in the queue passed through the message processors.
+// Labels are added by the processors and exposed as metric labels.
+type Message struct {
+	*showq.Message
+	Labels map[string]string
+}
+
+// NewMessage returns new Message without labels.
+func NewMessage(m *showq.Message) *Message {
+	return &Message{
+		Message: m,
+		Labels:  make(map[string]string),
+	}
+}
+
+// MessageProcessor processes each message in the queue before aggregation.
+// Process returns false to drop the message from the statistics.
+type MessageProcessor interface {
+	Process(m *Message) bool
+}
+
+// Labeler is a MessageProcessor that adds labels to messages.
+// LabelNames returns the names of labels that Process may add.
+type Labeler interface {
+	MessageProcessor
+	LabelNames() []string
+}
+
+// Pipeline applies the message processors in order.
+type Pipeline []MessageProcessor
+
+// Process applies the message processors in order, and stops at the first processor that drops the message.
+func (p Pipeline) Process(m *Message) bool {
+	for _, processor := range p {
+		if !processor.Process(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// LabelNames returns the names of labels added by the processors, in order and without duplicates.
+func (p Pipeline) LabelNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, processor := range p {
+		labeler, ok := processor.(Labeler)
+		if !ok {
+			continue
+		}
+		for _, name := range labeler.LabelNames() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// DefaultPipeline returns the pipeline used when no processors are configured.
+func DefaultPipeline() Pipeline {
+	return Pipeline{NewMaskProcessor(util.EmailMask)}
+}
+
+// NewPipeline returns the pipeline built from the configuration of the processors.
+// If cfgs is nil, DefaultPipeline is returned.
+func NewPipeline(cfgs []config.ProcessorConfig) (Pipeline, error) {
+	if cfgs == nil {
+		return DefaultPipeline(), nil
+	}
+	pipeline := Pipeline{}
+	for i, cfg := range cfgs {
+		switch {
+		case cfg.Mask != nil:
+			switch cfg.Mask.Policy {
+			case "local_part":
+				pipeline = append(pipeline, NewMaskProcessor(util.EmailMask))
+			case "full":
+				pipeline = append(pipeline, NewMaskProcessor(util.EmailRedact))
+			case "none":
+			default:
+				return nil, fmt.Errorf("processors[%d].mask.policy: unknown policy `%s`", i, cfg.Mask.Policy)
+			}
+		case cfg.Include != nil:
+			pipeline = append(pipeline, NewIncludeProcessor(newFilter(cfg.Include)))
+		case cfg.Exclude != nil:
+			pipeline = append(pipeline, NewExcludeProcessor(newFilter(cfg.Exclude)))
+		case cfg.Domain != nil:
+			pipeline = append(pipeline, NewDomainProcessor(cfg.Domain.Label, cfg.Domain.Source, cfg.Domain.Groups, cfg.Domain.Default))
+		case cfg.Label != nil:
+			rules := make([]LabelRule, len(cfg.Label.Rules))
+			for j, rule := range cfg.Label.Rules {
+				rules[j] = LabelRule{Source: rule.Source, Regex: rule.Regex.Regexp, Value: rule.Value}
+			}
+			pipeline = append(pipeline, NewLabelProcessor(cfg.Label.Name, rules, cfg.Label.Default))
+		default:
+			return nil, fmt.Errorf("processors[%d]: no processor is set", i)
+		}
+	}
+	return pipeline, nil
+}
+
+// MaskProcessor masks the sender and recipient addresses.
+type MaskProcessor struct {
+	mask func(string) string
+}
+
+// Process implements the MessageProcessor interface.
+func (p *MaskProcessor) Process(m *Message) bool {
+	m.Sender = p.mask(m.Sender)
+	for i := 0; i < len(m.Recipients); i++ {
+		m.Recipients[i].Address = p.mask(m.Recipients[i].Address)
+		if m.Recipients[i].DelayReason != nil {
+			reason := p.mask(*m.Recipients[i].DelayReason)
+			m.Recipients[i].DelayReason = &reason
+		}
+	}
+	return true
+}
+
+// NewMaskProcessor returns new MaskProcessor that masks addresses by mask.
+func NewMaskProcessor(mask func(string) string) *MaskProcessor {
+	return &MaskProcessor{mask: mask}
+}
+
+// Filter matches messages in the queue.
+// A message matches when it satisfies all specified conditions.
+type Filter struct {
+	// QueueNames matches any of the queue names (e.g. active, deferred, hold).
+	QueueNames []string
+	// Sender matches the sender address.
+	Sender *regexp.Regexp
+	// Recipient matches any of the recipient addresses.
+	Recipient *regexp.Regexp
+	// OlderThan matches messages that arrived more than the duration ago.
+	OlderThan time.Duration
+	// YoungerThan matches messages that arrived less than the duration ago.
+	YoungerThan time.Duration
+}
+
+// Match returns whether the message matches the filter.
+func (f *Filter) Match(m *Message) bool {
+	if len(f.QueueNames) > 0 {
+		found := false
+		for _, name := range f.QueueNames {
+			if m.QueueName == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Sender != nil && !f.Sender.MatchString(m.Sender) {
+		return false
+	}
+	if f.Recipient != nil {
+		found := false
+		for _, recipient := range m.Recipients {
+			if f.Recipient.MatchString(recipient.Address) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	age := time.Since(time.Time(m.ArrivalTime))
+	if f.OlderThan > 0 && age <= f.OlderThan {
+		return false
+	}
+	if f.YoungerThan > 0 && age >= f.YoungerThan {
+		return false
+	}
+	return true
+}
+
+// newFilter returns the filter built from the configuration.
+func newFilter(cfg *config.FilterConfig) Filter {
+	f := Filter{
+		QueueNames:  cfg.QueueNames,
+		OlderThan:   time.Duration(cfg.OlderThan),
+		YoungerThan: time.Duration(cfg.YoungerThan),
+	}
+	if cfg.Sender != nil {
+		f.Sender = cfg.Sender.Regexp
+	}
+	if cfg.Recipient != nil {
+		f.Recipient = cfg.Recipient.Regexp
+	}
+	return f
+}
+
+// FilterProcessor keeps or drops messages that match the filter.
+type FilterProcessor struct {
+	filter  Filter
+	exclude bool
+}
+
+// Process implements the MessageProcessor interface.
+func (p *FilterProcessor) Process(m *Message) bool {
+	return p.filter.Match(m) != p.exclude
+}
+
+// NewIncludeProcessor returns new FilterProcessor that keeps only messages matching the filter.
+func NewIncludeProcessor(f Filter) *FilterProcessor {
+	return &FilterProcessor{filter: f, exclude: false}
+}
+
+// NewExcludeProcessor returns new FilterProcessor that drops messages matching the filter.
+func NewExcludeProcessor(f Filter) *FilterProcessor {
+	return &FilterProcessor{filter: f, exclude: true}
+}
+
+// DomainProcessor extracts the domain of the sender or the first recipient into a label.
+// When groups are given, the domain is replaced by its group name, and domains in no group become the default value,
+// so that the number of label values stays bounded.
+type DomainProcessor struct {
+	label        string
+	useRecipient bool
+	groups       map[string]string
+	defaultValue string
+}
+
+// Process implements the MessageProcessor interface.
+func (p *DomainProcessor) Process(m *Message) bool {
+	var address string
+	if p.useRecipient {
+		if len(m.Recipients) > 0 {
+			address = m.Recipients[0].Address
+		}
+	} else {
+		address = m.Sender
+	}
+
+	domain := ""
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		domain = strings.ToLower(address[i+1:])
+	}
+	if p.groups == nil {
+		m.Labels[p.label] = domain
+		return true
+	}
+	if group, ok := p.groups[domain]; ok {
+		m.Labels[p.label] = group
+	} else {
+		m.Labels[p.label] = p.defaultValue
+	}
+	return true
+}
+
+// LabelNames implements the Labeler interface.
+func (p *DomainProcessor) LabelNames() []string {
+	return []string{p.label}
+}
+
+// NewDomainProcessor returns new DomainProcessor.
+// source is either "sender" or "recipient", and groups maps a group name to its domains.
+func NewDomainProcessor(label string, source string, groups map[string][]string, defaultValue string) *DomainProcessor {
+	var g map[string]string
+	if groups != nil {
+		g = make(map[string]string)
+		for group, domains := range groups {
+			for _, domain := range domains {
+				g[strings.ToLower(domain)] = group
+			}
+		}
+	}
+	return &DomainProcessor{
+		label:        label,
+		useRecipient: source == "recipient",
+		groups:       g,
+		defaultValue: defaultValue,
+	}
+}
+
+// LabelRule sets the value of a label when the source matches the regular expression.
+type LabelRule struct {
+	// Source is one of queue_name, sender, recipient, or the name of a label added by a previous processor.
+	Source string
+	Regex  *regexp.Regexp
+	Value  string
+}
+
+// LabelProcessor enriches messages with a label by the first matching rule.
+type LabelProcessor struct {
+	label        string
+	rules        []LabelRule
+	defaultValue string
+}
+
+// source returns the values of the message to match against.
+func (p *LabelProcessor) source(m *Message, name string) []string {
+	switch name {
+	case "queue_name":
+		return []string{m.QueueName}
+	case "sender":
+		return []string{m.Sender}
+	case "recipient":
+		values := make([]string, len(m.Recipients))
+		for i, recipient := range m.Recipients {
+			values[i] = recipient.Address
+		}
+		return values
+	default:
+		return []string{m.Labels[name]}
+	}
+}
+
+// Process implements the MessageProcessor interface.
+func (p *LabelProcessor) Process(m *Message) bool {
+	for _, rule := range p.rules {
+		for _, value := range p.source(m, rule.Source) {
+			if match := rule.Regex.FindStringSubmatchIndex(value); match != nil {
+				m.Labels[p.label] = string(rule.Regex.ExpandString(nil, rule.Value, value, match))
+				return true
+			}
+		}
+	}
+	m.Labels[p.label] = p.defaultValue
+	return true
+}
+
+// LabelNames implements the Labeler interface.
+func (p *LabelProcessor) LabelNames() []string {
+	return []string{p.label}
+}
+
+// NewLabelProcessor returns new LabelProcessor.
+// Rule values may refer to capture groups of the regular expression (e.g. $1).
+func NewLabelProcessor(label string, rules []LabelRule, defaultValue string) *LabelProcessor {
+	return &LabelProcessor{
+		label:        label,
+		rules:        rules,
+		defaultValue: defaultValue,
+	}
+}
@@ -0,0 +1,153 @@
+package collector_test
+
+import (
+	"fmt"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/showq"
+	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
+	"github.com/k-kinzal/postfix-prometheus-exporter/util"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func newMessage() *collector.Message {
+	m := mock.ShowqMessageGen(1)()[0]
+	return collector.NewMessage(&m)
+}
+
+func ExamplePipeline() {
+	pipeline := collector.Pipeline{
+		collector.NewExcludeProcessor(collector.Filter{QueueNames: []string{"hold"}}),
+		collector.NewMaskProcessor(util.EmailMask),
+		collector.NewDomainProcessor("sender_domain", "sender", nil, ""),
+	}
+
+	m := newMessage()
+	if pipeline.Process(m) {
+		fmt.Println(m.Sender, m.Labels)
+	}
+	// Output: ***@example.com map[sender_domain:example.com]
+}
+
+func TestPipeline_ProcessDropped(t *testing.T) {
+	pipeline := collector.Pipeline{
+		collector.NewIncludeProcessor(collector.Filter{QueueNames: []string{"active"}}),
+		collector.NewMaskProcessor(util.EmailMask),
+	}
+	m := newMessage()
+	if pipeline.Process(m) {
+		t.Errorf("expected the message is dropped, but actual is kept")
+	}
+	if m.Sender != "foo@example.com" {
+		t.Errorf("expected processors after the drop are not applied, but actual is `%s`", m.Sender)
+	}
+}
+
+func TestPipeline_LabelNames(t *testing.T) {
+	pipeline := collector.Pipeline{
+		collector.NewMaskProcessor(util.EmailMask),
+		collector.NewDomainProcessor("domain", "sender", nil, ""),
+		collector.NewLabelProcessor("tenant", nil, ""),
+		collector.NewDomainProcessor("domain", "recipient", nil, ""),
+	}
+	expected := []string{"domain", "tenant"}
+	if names := pipeline.LabelNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected `%v`, but actual is `%v`", expected, names)
+	}
+}
+
+func TestMaskProcessor_Process(t *testing.T) {
+	reason := "host mx.example.jp said: 550 bar@example.jp unknown"
+	m := newMessage()
+	m.Recipients[0].DelayReason = &reason
+	collector.NewMaskProcessor(util.EmailMask).Process(m)
+	if m.Sender != "***@example.com" {
+		t.Errorf("expected `***@example.com`, but actual is `%s`", m.Sender)
+	}
+	if m.Recipients[0].Address != "***@example.jp" {
+		t.Errorf("expected `***@example.jp`, but actual is `%s`", m.Recipients[0].Address)
+	}
+	if *m.Recipients[0].DelayReason != "host mx.example.jp said: 550 ***@example.jp unknown" {
+		t.Errorf("expected the delay reason is masked, but actual is `%s`", *m.Recipients[0].DelayReason)
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	cases := []struct {
+		filter   collector.Filter
+		expected bool
+	}{
+		{collector.Filter{}, true},
+		{collector.Filter{QueueNames: []string{"active", "deferred"}}, true},
+		{collector.Filter{QueueNames: []string{"hold"}}, false},
+		{collector.Filter{Sender: regexp.MustCompile(`@example\.com$`)}, true},
+		{collector.Filter{Sender: regexp.MustCompile(`@example\.jp$`)}, false},
+		{collector.Filter{Recipient: regexp.MustCompile(`@example\.jp$`)}, true},
+		{collector.Filter{Recipient: regexp.MustCompile(`@example\.com$`)}, false},
+		{collector.Filter{OlderThan: time.Hour}, true},
+		{collector.Filter{YoungerThan: time.Hour}, false},
+		{collector.Filter{QueueNames: []string{"deferred"}, Sender: regexp.MustCompile(`^bar@`)}, false},
+	}
+	for i, c := range cases {
+		if actual := c.filter.Match(newMessage()); actual != c.expected {
+			t.Errorf("case %d: expected `%v`, but actual is `%v`", i, c.expected, actual)
+		}
+	}
+}
+
+func TestFilterProcessor_Process(t *testing.T) {
+	f := collector.Filter{QueueNames: []string{"deferred"}}
+	if !collector.NewIncludeProcessor(f).Process(newMessage()) {
+		t.Errorf("expected the include processor keeps the message")
+	}
+	if collector.NewExcludeProcessor(f).Process(newMessage()) {
+		t.Errorf("expected the exclude processor drops the message")
+	}
+}
+
+func TestDomainProcessor_ProcessGroups(t *testing.T) {
+	groups := map[string][]string{"japan": {"Example.JP"}}
+	cases := []struct {
+		source   string
+		expected string
+	}{
+		{"sender", "other"},
+		{"recipient", "japan"},
+	}
+	for _, c := range cases {
+		m := newMessage()
+		collector.NewDomainProcessor("domain", c.source, groups, "other").Process(m)
+		if m.Labels["domain"] != c.expected {
+			t.Errorf("expected `%s`, but actual is `%s`", c.expected, m.Labels["domain"])
+		}
+	}
+}
+
+func TestDomainProcessor_ProcessNoRecipients(t *testing.T) {
+	m := collector.NewMessage(&showq.Message{Sender: "foo@example.com"})
+	collector.NewDomainProcessor("domain", "recipient", nil, "").Process(m)
+	if v, ok := m.Labels["domain"]; !ok || v != "" {
+		t.Errorf("expected an empty label, but actual is `%v`", m.Labels)
+	}
+}
+
+func TestLabelProcessor_Process(t *testing.T) {
+	p := collector.NewLabelProcessor("tenant", []collector.LabelRule{
+		{Source: "queue_name", Regex: regexp.MustCompile(`^hold$`), Value: "quarantine"},
+		{Source: "recipient", Regex: regexp.MustCompile(`@([a-z]+)\.jp$`), Value: "jp-$1"},
+	}, "unknown")
+	m := newMessage()
+	p.Process(m)
+	if m.Labels["tenant"] != "jp-example" {
+		t.Errorf("expected `jp-example`, but actual is `%s`", m.Labels["tenant"])
+	}
+
+	m = newMessage()
+	m.Recipients[0].Address = "bar@example.com"
+	p.Process(m)
+	if m.Labels["tenant"] != "unknown" {
+		t.Errorf("expected `unknown`, but actual is `%s`", m.Labels["tenant"])
+	}
+}
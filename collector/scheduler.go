@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jasonlvhit/gocron"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"io/ioutil"
+	golog "log"
+	"sync"
+	"time"
+)
+
+// Scheduler to update the collectors in the background.
+// Each collector is updated on its own interval, and an update is skipped while the previous one is running.
+type Scheduler struct {
+	collector *PostfixCollector
+	cfg       *config.Config
+	scheduler *gocron.Scheduler
+	stopped   chan bool
+	logger    log.Logger
+
+	// ctx is canceled to interrupt running updates.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	running  map[string]bool
+	stopping bool
+}
+
+// interval returns the interval of the named collector in seconds.
+func (s *Scheduler) interval(name string) uint64 {
+	return uint64(s.cfg.CollectorInterval(name) / time.Second)
+}
+
+// Update updates all enabled collectors.
+func (s *Scheduler) Update() {
+	level.Debug(s.logger).Log("msg", "Start updating collectors")
+	wg := sync.WaitGroup{}
+	for name := range s.collector.Collectors {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			s.UpdateCollector(name)
+		}(name)
+	}
+	wg.Wait()
+	level.Debug(s.logger).Log("msg", "Finish updating collectors")
+}
+
+// UpdateCollector updates the named collector unless its previous update is still running.
+func (s *Scheduler) UpdateCollector(name string) {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return
+	}
+	if s.running[name] {
+		s.mu.Unlock()
+		level.Warn(s.logger).Log("msg", "Skip updating collector because the previous update is still running", "collector", name)
+		return
+	}
+	s.running[name] = true
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.running[name] = false
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	s.collector.UpdateCollector(s.ctx, name)
+}
+
+// Start starts to update the collectors on their intervals.
+// Because updates start after the interval, if you want to update immediately, please call Update after start.
+func (s *Scheduler) Start() chan bool {
+	golog.SetOutput(ioutil.Discard) // disable gocron log
+	for name := range s.collector.Collectors {
+		interval := s.interval(name)
+		level.Debug(s.logger).Log("msg", "Scheduling collector", "collector", name, "interval", interval)
+		s.scheduler.Every(interval).Seconds().Do(func(name string) {
+			go s.UpdateCollector(name)
+		}, name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = s.scheduler.Start()
+	return s.stopped
+}
+
+// stopScheduling stops scheduling updates and rejects new ones.
+func (s *Scheduler) stopScheduling() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopping = true
+	if s.stopped == nil {
+		return
+	}
+	s.stopped <- true
+	s.stopped = nil
+}
+
+// Stop stops scheduling updates and interrupts the running updates.
+func (s *Scheduler) Stop() {
+	s.stopScheduling()
+	s.cancel()
+}
+
+// Shutdown stops scheduling updates and waits for the running updates to finish.
+// When ctx is done before they finish, they are interrupted and ctx.Err() is returned.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.stopScheduling()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// NewScheduler returns new Scheduler.
+// If cfg is nil, config.DefaultConfig is used.
+func NewScheduler(c *PostfixCollector, cfg *config.Config, logger log.Logger) *Scheduler {
+	if cfg == nil {
+		cfg = &config.DefaultConfig
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		collector: c,
+		cfg:       cfg,
+		scheduler: gocron.NewScheduler(),
+		logger:    logger,
+		ctx:       ctx,
+		cancel:    cancel,
+		running:   make(map[string]bool),
+	}
+}
@@ -0,0 +1,65 @@
+package collector_test
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
+	"io/ioutil"
+	"net"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Shutdown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	showqPath, _ := mock.Serve(ctx, mock.ShowqMessageGen(3))
+
+	scheduler := collector.NewScheduler(newPostfixCollector(t, showqPath), nil, log.NewNopLogger())
+	scheduler.Start()
+	scheduler.Update()
+	if err := scheduler.Shutdown(ctx); err != nil {
+		t.Errorf("expected `<nil>`, but actual is `%v`", err)
+	}
+}
+
+func TestScheduler_ShutdownInterruptsUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// showq that accepts a connection and never answers
+	dir, _ := ioutil.TempDir("", "")
+	showqPath := path.Join(dir, "showq")
+	listen, err := net.Listen("unix", showqPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listen.Close()
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := newPostfixCollector(t, showqPath)
+	scheduler := collector.NewScheduler(c, nil, log.NewNopLogger())
+	scheduler.Start()
+	go scheduler.Update()
+	time.Sleep(50 * time.Millisecond)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shutdownCancel()
+	if err := scheduler.Shutdown(shutdownCtx); err != context.DeadlineExceeded {
+		t.Errorf("expected `%v`, but actual is `%v`", context.DeadlineExceeded, err)
+	}
+	if v := collectorSuccess(t, c, "queue"); v != 0 {
+		t.Errorf("expected the interrupted update failed, but actual is `%v`", v)
+	}
+}
@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OnScrapeCollector updates the collectors when Prometheus scrapes.
+// Concurrent scrapes share one in-flight update, and the result of each collector is reused until the TTL expires.
+type OnScrapeCollector struct {
+	collector *PostfixCollector
+	ttl       time.Duration
+	offset    time.Duration
+	logger    log.Logger
+
+	mu          sync.Mutex
+	flights     map[string]*flight
+	collectedAt map[string]time.Time
+}
+
+// flight is an in-flight update of a collector shared by concurrent scrapes.
+// It runs on a context detached from the requests, which is cancelled only when all joined scrapes gave up waiting,
+// so that a scrape that disconnects or times out early does not fail the others.
+type flight struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	waiters int
+}
+
+func newFlight() *flight {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &flight{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Collect updates the named collectors, or all enabled collectors if no names are given,
+// except the collectors whose last update is younger than the TTL.
+// Each collector has its own flight, so that scrapes of overlapping collectors never update a collector concurrently.
+func (c *OnScrapeCollector) Collect(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		names = c.collector.names()
+	}
+
+	joined := make(map[string]*flight)
+	c.mu.Lock()
+	for _, name := range names {
+		collectedAt, ok := c.collectedAt[name]
+		if ok && time.Since(collectedAt) < c.ttl {
+			level.Debug(c.logger).Log("msg", "Use cached statistics", "collector", name, "collected_at", collectedAt)
+			continue
+		}
+		if _, ok := joined[name]; ok {
+			continue
+		}
+		f, ok := c.flights[name]
+		if !ok {
+			f = newFlight()
+			c.flights[name] = f
+			go c.update(name, f)
+		}
+		f.waiters++
+		joined[name] = f
+	}
+	c.mu.Unlock()
+
+	for name, f := range joined {
+		select {
+		case <-f.done:
+			delete(joined, name)
+		case <-ctx.Done():
+			c.leave(joined)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// leave gives up waiting for the flights.
+// A flight that nobody waits for is cancelled, so that a later scrape starts a new flight.
+func (c *OnScrapeCollector) leave(flights map[string]*flight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, f := range flights {
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if c.flights[name] == f {
+				delete(c.flights, name)
+			}
+		}
+	}
+}
+
+// update updates the collector of the flight, and ends the flight.
+// The statistics are cached only if the update was not cancelled, since they may be partial otherwise.
+func (c *OnScrapeCollector) update(name string, f *flight) {
+	c.collector.UpdateCollector(f.ctx, name)
+
+	c.mu.Lock()
+	if f.ctx.Err() == nil {
+		c.collectedAt[name] = time.Now()
+	}
+	if c.flights[name] == f {
+		delete(c.flights, name)
+	}
+	c.mu.Unlock()
+	f.cancel()
+	close(f.done)
+}
+
+// Handler returns a handler that collects statistics of the named collectors, or all if no names are given, before serving h.
+// The collection is bounded by the X-Prometheus-Scrape-Timeout-Seconds header minus the offset.
+func (c *OnScrapeCollector) Handler(h http.Handler, names ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+			seconds, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				http.Error(w, "Failed to parse timeout from Prometheus header: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			timeout := time.Duration(seconds*float64(time.Second)) - c.offset
+			if timeout <= 0 {
+				timeout = time.Duration(seconds * float64(time.Second))
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		if err := c.Collect(ctx, names...); err != nil {
+			level.Warn(c.logger).Log("msg", "Failed to update collectors on scrape", "err", err)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// NewOnScrapeCollector returns new OnScrapeCollector.
+func NewOnScrapeCollector(c *PostfixCollector, ttl time.Duration, offset time.Duration, logger log.Logger) *OnScrapeCollector {
+	return &OnScrapeCollector{
+		collector:   c,
+		ttl:         ttl,
+		offset:      offset,
+		logger:      logger,
+		flights:     make(map[string]*flight),
+		collectedAt: make(map[string]time.Time),
+	}
+}
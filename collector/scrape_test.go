@@ -0,0 +1,178 @@
+package collector_test
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnScrapeCollector_CollectCached(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	showqPath, _ := mock.Serve(serverCtx, mock.ShowqMessageGen(3))
+
+	pc := newPostfixCollector(t, showqPath)
+	c := collector.NewOnScrapeCollector(pc, time.Minute, 0, log.NewNopLogger())
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stopServer()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := collectorSuccess(t, pc, "queue"); v != 1 {
+		t.Errorf("expected cached result `1`, but actual is `%v`", v)
+	}
+}
+
+func TestOnScrapeCollector_CollectExpired(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	serverCtx, stopServer := context.WithCancel(ctx)
+	showqPath, _ := mock.Serve(serverCtx, mock.ShowqMessageGen(3))
+
+	pc := newPostfixCollector(t, showqPath)
+	c := collector.NewOnScrapeCollector(pc, 0, 0, log.NewNopLogger())
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stopServer()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := c.Collect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := collectorSuccess(t, pc, "queue"); v != 0 {
+		t.Errorf("expected `0` after the TTL, but actual is `%v`", v)
+	}
+}
+
+// serveSlowShowq serves an empty queue slower than the delay, and counts the connections.
+func serveSlowShowq(t *testing.T, delay time.Duration) (string, *int32) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	showqPath := path.Join(dir, "showq")
+	listen, err := net.Listen("unix", showqPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listen.Close() })
+	var conns int32
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			time.Sleep(delay)
+			conn.Write([]byte{0})
+			conn.Close()
+		}
+	}()
+	return showqPath, &conns
+}
+
+func TestOnScrapeCollector_CollectJoinedScrapeCanceled(t *testing.T) {
+	// showq answers an empty queue slower than the first scrape waits.
+	showqPath, _ := serveSlowShowq(t, 200*time.Millisecond)
+	pc := newPostfixCollector(t, showqPath)
+	c := collector.NewOnScrapeCollector(pc, time.Minute, 0, log.NewNopLogger())
+
+	first, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errs := make(chan error)
+	go func() {
+		errs <- c.Collect(first, "queue")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	second, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.Collect(second, "queue"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != context.DeadlineExceeded {
+		t.Errorf("expected `%v`, but actual is `%v`", context.DeadlineExceeded, err)
+	}
+	if v := collectorSuccess(t, pc, "queue"); v != 1 {
+		t.Errorf("expected the joined scrape to succeed `1`, but actual is `%v`", v)
+	}
+}
+
+func TestOnScrapeCollector_CollectCanceledNotCached(t *testing.T) {
+	showqPath, conns := serveSlowShowq(t, 100*time.Millisecond)
+	pc := newPostfixCollector(t, showqPath)
+	c := collector.NewOnScrapeCollector(pc, time.Minute, 0, log.NewNopLogger())
+
+	first, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Collect(first, "queue"); err != context.DeadlineExceeded {
+		t.Fatalf("expected `%v`, but actual is `%v`", context.DeadlineExceeded, err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	second, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.Collect(second, "queue"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(conns); n != 2 {
+		t.Errorf("expected the cancelled update not to be cached `2`, but actual is `%d`", n)
+	}
+}
+
+func TestOnScrapeCollector_CollectOverlappingNames(t *testing.T) {
+	showqPath, conns := serveSlowShowq(t, 100*time.Millisecond)
+	pc := newPostfixCollector(t, showqPath, "--collector.delivery")
+	c := collector.NewOnScrapeCollector(pc, time.Minute, 0, log.NewNopLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	errs := make(chan error)
+	go func() {
+		errs <- c.Collect(ctx, "queue")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Collect(ctx, "queue", "delivery"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(conns); n != 1 {
+		t.Errorf("expected the queue collector to be updated once `1`, but actual is `%d`", n)
+	}
+}
+
+func TestOnScrapeCollector_HandlerInvalidTimeout(t *testing.T) {
+	pc := newPostfixCollector(t, "")
+	c := collector.NewOnScrapeCollector(pc, 0, 0, log.NewNopLogger())
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "foo")
+	rec := httptest.NewRecorder()
+	c.Handler(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected `%v`, but actual is `%v`", http.StatusBadRequest, rec.Code)
+	}
+}
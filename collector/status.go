@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/k-kinzal/postfix-prometheus-exporter/util"
+	"time"
+)
+
+// InstanceReporter is a Collector that reports the outcome of its last update per Postfix instance.
+type InstanceReporter interface {
+	Collector
+
+	// InstanceErrors returns the error of each instance in the last update, or nil for the instances that succeeded.
+	InstanceErrors() map[string]error
+}
+
+// instanceName returns the name of the instance in statuses.
+func instanceName(instance Instance) string {
+	if instance.Name == "" {
+		return "default"
+	}
+	return instance.Name
+}
+
+// Status is the outcome of the updates of a collector or an instance.
+// The last error is masked by util.EmailMask.
+type Status struct {
+	Ready       bool               `json:"ready"`
+	Reason      string             `json:"reason,omitempty"`
+	Success     bool               `json:"success"`
+	LastUpdate  *time.Time         `json:"last_update,omitempty"`
+	LastSuccess *time.Time         `json:"last_success,omitempty"`
+	LastError   string             `json:"last_error,omitempty"`
+	Instances   map[string]*Status `json:"instances,omitempty"`
+}
+
+// record updates the status with the outcome of an update at t.
+func (s *Status) record(t time.Time, err error) {
+	s.LastUpdate = &t
+	s.Success = err == nil
+	if err != nil {
+		s.LastError = util.EmailMask(err.Error())
+		return
+	}
+	s.LastSuccess = &t
+	s.LastError = ""
+}
+
+// check sets whether the status is ready at now.
+// It is ready when the last update succeeded no longer than maxAge ago.
+func (s *Status) check(now time.Time, maxAge time.Duration) {
+	switch {
+	case s.LastSuccess == nil:
+		s.Ready = false
+		s.Reason = "no successful update yet"
+	case maxAge > 0 && now.Sub(*s.LastSuccess) > maxAge:
+		s.Ready = false
+		s.Reason = fmt.Sprintf("last successful update is older than %s", maxAge)
+	default:
+		s.Ready = true
+		s.Reason = ""
+	}
+}
+
+// copy returns a deep copy of the status.
+func (s *Status) copy() *Status {
+	c := *s
+	if s.Instances != nil {
+		c.Instances = make(map[string]*Status, len(s.Instances))
+		for name, instance := range s.Instances {
+			c.Instances[name] = instance.copy()
+		}
+	}
+	return &c
+}
+
+// Readiness is the readiness of the exporter broken down per collector.
+type Readiness struct {
+	Ready      bool               `json:"ready"`
+	Collectors map[string]*Status `json:"collectors"`
+}
+
+// Readiness returns whether every enabled collector has a recent successful update.
+// maxAge returns the maximum age of the last successful update of the named collector.
+func (p *PostfixCollector) Readiness(maxAge func(name string) time.Duration) *Readiness {
+	now := time.Now()
+	readiness := &Readiness{
+		Ready:      true,
+		Collectors: make(map[string]*Status),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name := range p.Collectors {
+		status := &Status{}
+		if s, ok := p.statuses[name]; ok {
+			status = s.copy()
+		}
+		age := maxAge(name)
+		status.check(now, age)
+		for _, instance := range status.Instances {
+			instance.check(now, age)
+		}
+		if !status.Ready {
+			readiness.Ready = false
+		}
+		readiness.Collectors[name] = status
+	}
+	return readiness
+}
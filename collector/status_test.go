@@ -0,0 +1,81 @@
+package collector_test
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
+	"strings"
+	"testing"
+	"time"
+)
+
+func maxAge(d time.Duration) func(string) time.Duration {
+	return func(string) time.Duration {
+		return d
+	}
+}
+
+func TestPostfixCollector_Readiness(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	showqPath, _ := mock.Serve(ctx, mock.ShowqMessageGen(3))
+	c := newPostfixCollector(t, showqPath)
+
+	readiness := c.Readiness(maxAge(time.Minute))
+	if readiness.Ready {
+		t.Errorf("expected not ready before the first update, but actual is `%v`", readiness.Collectors["queue"])
+	}
+
+	c.Update(ctx)
+	readiness = c.Readiness(maxAge(time.Minute))
+	if !readiness.Ready {
+		t.Errorf("expected ready after the update, but actual is `%v`", readiness.Collectors["queue"])
+	}
+	if s := readiness.Collectors["queue"].Instances["default"]; s == nil || !s.Ready {
+		t.Errorf("expected the default instance is ready, but actual is `%v`", s)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	readiness = c.Readiness(maxAge(time.Millisecond))
+	if readiness.Ready || !strings.Contains(readiness.Collectors["queue"].Reason, "older than") {
+		t.Errorf("expected not ready with a stale snapshot, but actual is `%v`", readiness.Collectors["queue"])
+	}
+}
+
+func TestPostfixCollector_ReadinessInstanceError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	showqPath, _ := mock.Serve(ctx, mock.ShowqMessageGen(3))
+	cfg := &config.Config{}
+	*cfg = config.DefaultConfig
+	cfg.Instances = []config.InstanceConfig{
+		{Name: "inbound", ShowqPath: showqPath},
+		{Name: "outbound", ShowqPath: "/nonexistent/postmaster@example.com/showq"},
+	}
+	opts, err := collector.NewOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := collector.NewPostfixCollector(opts, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Update(ctx)
+
+	readiness := c.Readiness(maxAge(time.Minute))
+	if readiness.Ready {
+		t.Errorf("expected not ready, but actual is `%v`", readiness.Collectors["queue"])
+	}
+	instances := readiness.Collectors["queue"].Instances
+	if !instances["inbound"].Ready {
+		t.Errorf("expected `inbound` is ready, but actual is `%v`", instances["inbound"])
+	}
+	outbound := instances["outbound"]
+	if outbound.Ready || !strings.Contains(outbound.LastError, "***@example.com") {
+		t.Errorf("expected `outbound` has the masked error, but actual is `%v`", outbound)
+	}
+}
@@ -0,0 +1,1070 @@
+package config
+
+import (
+	"fmt"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultConfig is the default top-level configuration.
+	DefaultConfig = Config{
+		Web:    DefaultWebConfig,
+		Global: DefaultGlobalConfig,
+		Instances: []InstanceConfig{
+			{ShowqPath: "/var/spool/postfix/public/showq"},
+		},
+		Collectors: DefaultCollectorsConfig,
+		Modules:    DefaultModules,
+	}
+
+	// DefaultModules is the default modules of the probe endpoint.
+	DefaultModules = map[string]ModuleConfig{
+		"default": DefaultModuleConfig,
+	}
+
+	// DefaultModuleConfig is the default configuration of a module.
+	DefaultModuleConfig = ModuleConfig{
+		Timeout: model.Duration(10 * time.Second),
+	}
+
+	// DefaultFileLogConfig is the default configuration of a log file.
+	DefaultFileLogConfig = FileLogConfig{
+		PollInterval: model.Duration(time.Second),
+		StartAt:      "end",
+	}
+
+	// DefaultJournalLogConfig is the default configuration of the systemd journal.
+	DefaultJournalLogConfig = JournalLogConfig{
+		JournalctlPath: "journalctl",
+		Identifiers:    []string{"postfix/*"},
+	}
+
+	// DefaultWebConfig is the default web configuration.
+	DefaultWebConfig = WebConfig{
+		ListenAddress:   ":9154",
+		TelemetryPath:   "/metrics",
+		ReadTimeout:     model.Duration(10 * time.Second),
+		WriteTimeout:    model.Duration(60 * time.Second),
+		IdleTimeout:     model.Duration(120 * time.Second),
+		ShutdownTimeout: model.Duration(30 * time.Second),
+	}
+
+	// DefaultGlobalConfig is the default global configuration.
+	DefaultGlobalConfig = GlobalConfig{
+		CollectMode:         "background",
+		Interval:            model.Duration(60 * time.Second),
+		CacheTTL:            model.Duration(5 * time.Second),
+		ScrapeTimeoutOffset: model.Duration(500 * time.Millisecond),
+	}
+
+	// DefaultCollectorsConfig is the default configuration of the collectors.
+	DefaultCollectorsConfig = CollectorsConfig{
+		Queue:          DefaultQueueCollectorConfig,
+		Delivery:       DefaultDeliveryCollectorConfig,
+		Session:        DefaultSessionCollectorConfig,
+		TLS:            DefaultTLSCollectorConfig,
+		SASL:           DefaultSASLCollectorConfig,
+		SASLUsers:      DefaultSASLUsersCollectorConfig,
+		Lifecycle:      DefaultLifecycleCollectorConfig,
+		Postscreen:     DefaultPostscreenCollectorConfig,
+		ContentFilter:  DefaultContentFilterCollectorConfig,
+		Authentication: DefaultAuthenticationCollectorConfig,
+		Checks:         DefaultChecksCollectorConfig,
+	}
+
+	// DefaultQueueCollectorConfig is the default configuration of the queue collector.
+	DefaultQueueCollectorConfig = QueueCollectorConfig{
+		SizeBuckets: []float64{1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9},
+		AgeBuckets:  []float64{1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8},
+	}
+
+	// DefaultDeliveryCollectorConfig is the default configuration of the delivery collector.
+	DefaultDeliveryCollectorConfig = DeliveryCollectorConfig{
+		MaxRelays:    100,
+		DelayBuckets: []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 1800, 3600, 21600, 86400},
+	}
+
+	// DefaultSessionCollectorConfig is the default configuration of the session collector.
+	DefaultSessionCollectorConfig = SessionCollectorConfig{
+		CommandsBuckets: []float64{1, 2, 3, 5, 8, 13, 21, 50, 100},
+	}
+
+	// DefaultTLSCollectorConfig is the default configuration of the tls collector.
+	DefaultTLSCollectorConfig = TLSCollectorConfig{
+		MaxDestinations: 100,
+	}
+
+	// DefaultSASLCollectorConfig is the default configuration of the sasl collector.
+	DefaultSASLCollectorConfig = SASLCollectorConfig{
+		Window:     model.Duration(time.Hour),
+		TopN:       20,
+		MaxTracked: 10000,
+	}
+
+	// DefaultSASLUsersCollectorConfig is the default configuration of the sasl_users collector.
+	DefaultSASLUsersCollectorConfig = SASLUsersCollectorConfig{
+		Window:           model.Duration(time.Hour),
+		Buckets:          12,
+		BaselineHalfLife: model.Duration(7 * 24 * time.Hour),
+		TopN:             20,
+		MaxUsers:         10000,
+		MaxPending:       10000,
+		Mask:             MaskConfig{Policy: "hash"},
+	}
+
+	// DefaultLifecycleCollectorConfig is the default configuration of the lifecycle collector.
+	DefaultLifecycleCollectorConfig = LifecycleCollectorConfig{
+		MaxMessages:     10000,
+		MaxCompleted:    1000,
+		MaxEvents:       100,
+		OrphanTimeout:   model.Duration(24 * time.Hour),
+		Mask:            MaskConfig{Policy: "local_part"},
+		LatencyBuckets:  []float64{1, 5, 10, 30, 60, 300, 900, 3600, 14400, 86400, 432000},
+		AttemptsBuckets: []float64{1, 2, 3, 5, 10, 20, 50},
+	}
+
+	// DefaultPostscreenCollectorConfig is the default configuration of the postscreen collector.
+	DefaultPostscreenCollectorConfig = PostscreenCollectorConfig{
+		RankBuckets: []float64{1, 2, 3, 4, 5, 6, 8, 10, 15, 20},
+	}
+
+	// DefaultContentFilterCollectorConfig is the default configuration of the content_filter collector.
+	DefaultContentFilterCollectorConfig = ContentFilterCollectorConfig{
+		ScanBuckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}
+
+	// DefaultAuthenticationCollectorConfig is the default configuration of the authentication collector.
+	DefaultAuthenticationCollectorConfig = AuthenticationCollectorConfig{
+		MaxDomains:     100,
+		MaxPending:     10000,
+		PendingTimeout: model.Duration(time.Hour),
+	}
+
+	// DefaultChecksCollectorConfig is the default configuration of the checks collector.
+	DefaultChecksCollectorConfig = ChecksCollectorConfig{
+		MaxRules: 1000,
+	}
+)
+
+// Config is the top-level configuration of the exporter.
+type Config struct {
+	Web        WebConfig        `yaml:"web"`
+	Global     GlobalConfig     `yaml:"global"`
+	Instances  []InstanceConfig `yaml:"instances"`
+	Collectors CollectorsConfig `yaml:"collectors"`
+	// Processors is applied to each message in the queue in order.
+	// If omitted, only the mask processor is applied.
+	Processors []ProcessorConfig `yaml:"processors"`
+	// Modules are named settings of the probe endpoint, selected by the module parameter.
+	Modules map[string]ModuleConfig `yaml:"modules"`
+	// Logs are the log inputs of the log-driven collectors.
+	Logs LogsConfig `yaml:"logs"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultConfig
+	c.Instances = nil
+	c.Modules = nil
+	type plain Config
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	if c.Instances == nil {
+		c.Instances = DefaultConfig.Instances
+	}
+	if c.Modules == nil {
+		c.Modules = DefaultModules
+	}
+	return nil
+}
+
+// Validate returns errors with the paths of invalid values.
+func (c *Config) Validate() error {
+	var errs Errors
+	errs = append(errs, c.Web.validate("web")...)
+	errs = append(errs, c.Global.validate("global")...)
+
+	if len(c.Instances) == 0 {
+		errs = append(errs, &Error{Path: "instances", Message: "at least one instance is required"})
+	}
+	names := make(map[string]bool)
+	for i, instance := range c.Instances {
+		path := fmt.Sprintf("instances[%d]", i)
+		if len(c.Instances) > 1 && instance.Name == "" {
+			errs = append(errs, &Error{Path: path + ".name", Message: "is required when there are multiple instances"})
+		}
+		if names[instance.Name] {
+			errs = append(errs, &Error{Path: path + ".name", Message: fmt.Sprintf("duplicate instance name `%s`", instance.Name)})
+		}
+		names[instance.Name] = true
+		if instance.ShowqPath == "" {
+			errs = append(errs, &Error{Path: path + ".showq_path", Message: "is required"})
+		}
+	}
+
+	errs = append(errs, c.Collectors.validate("collectors")...)
+
+	for i, processor := range c.Processors {
+		errs = append(errs, processor.validate(fmt.Sprintf("processors[%d]", i))...)
+	}
+
+	errs = append(errs, c.Logs.validate("logs")...)
+
+	modules := make([]string, 0, len(c.Modules))
+	for name := range c.Modules {
+		modules = append(modules, name)
+	}
+	sort.Strings(modules)
+	for _, name := range modules {
+		module := c.Modules[name]
+		errs = append(errs, module.validate(fmt.Sprintf("modules.%s", name))...)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// CollectorInterval returns the interval of the named collector, or the global interval if it has none.
+func (c *Config) CollectorInterval(name string) time.Duration {
+	interval := c.Global.Interval
+	if cc := c.Collectors.Collector(name); cc != nil && cc.Interval > 0 {
+		interval = cc.Interval
+	}
+	return time.Duration(interval)
+}
+
+// MaxSnapshotAge returns the age of the last successful update of the named collector after which the exporter is not ready.
+func (c *Config) MaxSnapshotAge(name string) time.Duration {
+	if c.Global.MaxSnapshotAge > 0 {
+		return time.Duration(c.Global.MaxSnapshotAge)
+	}
+	return 3 * c.CollectorInterval(name)
+}
+
+// WebConfig configures the HTTP server.
+type WebConfig struct {
+	ListenAddress          string `yaml:"listen_address"`
+	TelemetryPath          string `yaml:"telemetry_path"`
+	DisableExporterMetrics bool   `yaml:"disable_exporter_metrics"`
+	// ReadTimeout, WriteTimeout and IdleTimeout are the timeouts of the HTTP server. Zero means no timeout.
+	ReadTimeout  model.Duration `yaml:"read_timeout"`
+	WriteTimeout model.Duration `yaml:"write_timeout"`
+	IdleTimeout  model.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is the deadline to drain in-flight scrapes and collections on shutdown.
+	ShutdownTimeout model.Duration `yaml:"shutdown_timeout"`
+	// ConfigFile is the path to the web configuration file that enables TLS and basic authentication.
+	ConfigFile string `yaml:"config_file,omitempty"`
+}
+
+func (c *WebConfig) validate(path string) Errors {
+	var errs Errors
+	if c.ListenAddress == "" {
+		errs = append(errs, &Error{Path: path + ".listen_address", Message: "is required"})
+	}
+	if !strings.HasPrefix(c.TelemetryPath, "/") {
+		errs = append(errs, &Error{Path: path + ".telemetry_path", Message: "must start with `/`"})
+	}
+	timeouts := []struct {
+		name  string
+		value model.Duration
+	}{
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"shutdown_timeout", c.ShutdownTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			errs = append(errs, &Error{Path: path + "." + timeout.name, Message: "must not be negative"})
+		}
+	}
+	return errs
+}
+
+// GlobalConfig configures how statistics are collected.
+type GlobalConfig struct {
+	// CollectMode is either scrape or background.
+	CollectMode string `yaml:"collect_mode"`
+	// Interval is the default interval of the collectors in the background.
+	Interval model.Duration `yaml:"interval"`
+	// CacheTTL is the minimum time to reuse statistics collected on a scrape.
+	CacheTTL model.Duration `yaml:"cache_ttl"`
+	// ScrapeTimeoutOffset is subtracted from the timeout given by Prometheus.
+	ScrapeTimeoutOffset model.Duration `yaml:"scrape_timeout_offset"`
+	// MaxSnapshotAge is the age of the last successful update after which the exporter is not ready.
+	// If zero, three times the interval of each collector is used.
+	MaxSnapshotAge model.Duration `yaml:"max_snapshot_age,omitempty"`
+}
+
+func (c *GlobalConfig) validate(path string) Errors {
+	var errs Errors
+	if c.CollectMode != "scrape" && c.CollectMode != "background" {
+		errs = append(errs, &Error{Path: path + ".collect_mode", Message: fmt.Sprintf("must be one of scrape, background, but is `%s`", c.CollectMode)})
+	}
+	errs = append(errs, validateInterval(path+".interval", c.Interval)...)
+	if c.CacheTTL < 0 {
+		errs = append(errs, &Error{Path: path + ".cache_ttl", Message: "must not be negative"})
+	}
+	if c.ScrapeTimeoutOffset < 0 {
+		errs = append(errs, &Error{Path: path + ".scrape_timeout_offset", Message: "must not be negative"})
+	}
+	if c.MaxSnapshotAge < 0 {
+		errs = append(errs, &Error{Path: path + ".max_snapshot_age", Message: "must not be negative"})
+	}
+	return errs
+}
+
+// InstanceConfig is a Postfix instance to collect statistics from.
+// Statistics of named instances have the postfix_instance label.
+type InstanceConfig struct {
+	Name      string `yaml:"name"`
+	ShowqPath string `yaml:"showq_path"`
+}
+
+// CollectorConfig is the configuration common to all collectors.
+type CollectorConfig struct {
+	// Enabled overrides whether the collector is enabled by default.
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// Interval overrides the global interval for the collector.
+	Interval model.Duration `yaml:"interval,omitempty"`
+}
+
+func (c *CollectorConfig) validate(path string) Errors {
+	if c.Interval == 0 {
+		return nil
+	}
+	return validateInterval(path+".interval", c.Interval)
+}
+
+// CollectorsConfig configures each collector.
+type CollectorsConfig struct {
+	Queue          QueueCollectorConfig          `yaml:"queue"`
+	Delivery       DeliveryCollectorConfig       `yaml:"delivery"`
+	Reject         RejectCollectorConfig         `yaml:"reject"`
+	Session        SessionCollectorConfig        `yaml:"session"`
+	TLS            TLSCollectorConfig            `yaml:"tls"`
+	SASL           SASLCollectorConfig           `yaml:"sasl"`
+	SASLUsers      SASLUsersCollectorConfig      `yaml:"sasl_users"`
+	Lifecycle      LifecycleCollectorConfig      `yaml:"lifecycle"`
+	Postscreen     PostscreenCollectorConfig     `yaml:"postscreen"`
+	ContentFilter  ContentFilterCollectorConfig  `yaml:"content_filter"`
+	Authentication AuthenticationCollectorConfig `yaml:"authentication"`
+	Checks         ChecksCollectorConfig         `yaml:"checks"`
+}
+
+// Collector returns the common configuration of the named collector, or nil if there is none.
+func (c *CollectorsConfig) Collector(name string) *CollectorConfig {
+	switch name {
+	case "queue":
+		return &c.Queue.CollectorConfig
+	case "delivery":
+		return &c.Delivery.CollectorConfig
+	case "reject":
+		return &c.Reject.CollectorConfig
+	case "session":
+		return &c.Session.CollectorConfig
+	case "tls":
+		return &c.TLS.CollectorConfig
+	case "sasl":
+		return &c.SASL.CollectorConfig
+	case "sasl_users":
+		return &c.SASLUsers.CollectorConfig
+	case "lifecycle":
+		return &c.Lifecycle.CollectorConfig
+	case "postscreen":
+		return &c.Postscreen.CollectorConfig
+	case "content_filter":
+		return &c.ContentFilter.CollectorConfig
+	case "authentication":
+		return &c.Authentication.CollectorConfig
+	case "checks":
+		return &c.Checks.CollectorConfig
+	default:
+		return nil
+	}
+}
+
+func (c *CollectorsConfig) validate(path string) Errors {
+	errs := c.Queue.validate(path + ".queue")
+	errs = append(errs, c.Delivery.validate(path+".delivery")...)
+	errs = append(errs, c.Reject.validate(path+".reject")...)
+	errs = append(errs, c.Session.validate(path+".session")...)
+	errs = append(errs, c.TLS.validate(path+".tls")...)
+	errs = append(errs, c.SASL.validate(path+".sasl")...)
+	errs = append(errs, c.SASLUsers.validate(path+".sasl_users")...)
+	errs = append(errs, c.Lifecycle.validate(path+".lifecycle")...)
+	errs = append(errs, c.Postscreen.validate(path+".postscreen")...)
+	errs = append(errs, c.ContentFilter.validate(path+".content_filter")...)
+	errs = append(errs, c.Authentication.validate(path+".authentication")...)
+	errs = append(errs, c.Checks.validate(path+".checks")...)
+	return errs
+}
+
+// QueueCollectorConfig configures the queue collector.
+type QueueCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	SizeBuckets     []float64 `yaml:"size_buckets"`
+	AgeBuckets      []float64 `yaml:"age_buckets"`
+}
+
+func (c *QueueCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	errs = append(errs, validateBuckets(path+".size_buckets", c.SizeBuckets)...)
+	errs = append(errs, validateBuckets(path+".age_buckets", c.AgeBuckets)...)
+	return errs
+}
+
+// DeliveryCollectorConfig configures the delivery collector.
+type DeliveryCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// MaxRelays bounds the relay label. Relays seen after the limit are counted as other.
+	MaxRelays    int       `yaml:"max_relays"`
+	DelayBuckets []float64 `yaml:"delay_buckets"`
+}
+
+func (c *DeliveryCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	if c.MaxRelays <= 0 {
+		errs = append(errs, &Error{Path: path + ".max_relays", Message: "must be positive"})
+	}
+	errs = append(errs, validateBuckets(path+".delay_buckets", c.DelayBuckets)...)
+	return errs
+}
+
+// RejectCollectorConfig configures the reject collector.
+type RejectCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// Restrictions name the restrictions by the reply text, before the built-in names.
+	// They name the rejects of policy services and access tables with custom text.
+	Restrictions []RestrictionConfig `yaml:"restrictions,omitempty"`
+}
+
+func (c *RejectCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	for i, restriction := range c.Restrictions {
+		errs = append(errs, restriction.validate(fmt.Sprintf("%s.restrictions[%d]", path, i))...)
+	}
+	return errs
+}
+
+// RestrictionConfig names the restriction of the rejects whose reply text matches.
+type RestrictionConfig struct {
+	Name string `yaml:"name"`
+	// Match is a regular expression of the reply text (e.g. `Greylisted`).
+	Match *Regexp `yaml:"match"`
+}
+
+func (c *RestrictionConfig) validate(path string) Errors {
+	var errs Errors
+	if c.Name == "" {
+		errs = append(errs, &Error{Path: path + ".name", Message: "is required"})
+	}
+	if c.Match == nil {
+		errs = append(errs, &Error{Path: path + ".match", Message: "is required"})
+	}
+	return errs
+}
+
+// SessionCollectorConfig configures the session collector.
+type SessionCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// CommandsBuckets are the buckets of the number of SMTP commands in a session.
+	CommandsBuckets []float64 `yaml:"commands_buckets"`
+}
+
+func (c *SessionCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	errs = append(errs, validateBuckets(path+".commands_buckets", c.CommandsBuckets)...)
+	return errs
+}
+
+// TLSCollectorConfig configures the tls collector.
+type TLSCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// MaxDestinations bounds the destination label. Destinations seen after the limit are counted as other.
+	MaxDestinations int `yaml:"max_destinations"`
+}
+
+func (c *TLSCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	if c.MaxDestinations <= 0 {
+		errs = append(errs, &Error{Path: path + ".max_destinations", Message: "must be positive"})
+	}
+	return errs
+}
+
+// SASLCollectorConfig configures the sasl collector.
+type SASLCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// Window is the half-life of the failures of the offenders. A failure counts half after the window, and a quarter after twice the window.
+	Window model.Duration `yaml:"window"`
+	// TopN is the number of the offending addresses and networks to expose.
+	TopN int `yaml:"top_n"`
+	// MaxTracked bounds the addresses and the networks to track. The one with the fewest failures is forgotten beyond the limit.
+	MaxTracked int `yaml:"max_tracked"`
+}
+
+func (c *SASLCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	if c.Window <= 0 {
+		errs = append(errs, &Error{Path: path + ".window", Message: "must be positive"})
+	}
+	if c.TopN <= 0 {
+		errs = append(errs, &Error{Path: path + ".top_n", Message: "must be positive"})
+	}
+	if c.MaxTracked < c.TopN {
+		errs = append(errs, &Error{Path: path + ".max_tracked", Message: "must not be less than top_n"})
+	}
+	return errs
+}
+
+// SASLUsersCollectorConfig configures the sasl_users collector.
+type SASLUsersCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// Window is the sliding window of the messages and the recipients of each user.
+	Window model.Duration `yaml:"window"`
+	// Buckets is the number of the steps of the window to slide.
+	Buckets int `yaml:"buckets"`
+	// BaselineHalfLife is the half-life of the learned number of recipients per window of each user.
+	BaselineHalfLife model.Duration `yaml:"baseline_half_life"`
+	// TopN is the number of the users to expose.
+	TopN int `yaml:"top_n"`
+	// MaxUsers bounds the users to track. The user seen least recently is forgotten beyond the limit.
+	MaxUsers int `yaml:"max_users"`
+	// MaxPending bounds the queue IDs waiting for qmgr. The oldest one is forgotten beyond the limit.
+	MaxPending int `yaml:"max_pending"`
+	// Mask is hash (a stable pseudonym of each user), local_part, full or none.
+	// The users with the same masked name are counted together.
+	Mask MaskConfig `yaml:"mask"`
+}
+
+func (c *SASLUsersCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	if c.Window <= 0 {
+		errs = append(errs, &Error{Path: path + ".window", Message: "must be positive"})
+	}
+	if c.Buckets <= 0 || time.Duration(c.Window)/time.Duration(c.Buckets) < time.Second {
+		errs = append(errs, &Error{Path: path + ".buckets", Message: "must be positive, with steps of at least 1s"})
+	}
+	if c.BaselineHalfLife <= 0 {
+		errs = append(errs, &Error{Path: path + ".baseline_half_life", Message: "must be positive"})
+	}
+	if c.TopN <= 0 {
+		errs = append(errs, &Error{Path: path + ".top_n", Message: "must be positive"})
+	}
+	if c.MaxUsers < c.TopN {
+		errs = append(errs, &Error{Path: path + ".max_users", Message: "must not be less than top_n"})
+	}
+	if c.MaxPending <= 0 {
+		errs = append(errs, &Error{Path: path + ".max_pending", Message: "must be positive"})
+	}
+	switch c.Mask.Policy {
+	case "hash", "local_part", "full", "none":
+	default:
+		errs = append(errs, &Error{Path: path + ".mask.policy", Message: fmt.Sprintf("must be one of hash, local_part, full, none, but is `%s`", c.Mask.Policy)})
+	}
+	return errs
+}
+
+// LifecycleCollectorConfig configures the lifecycle collector.
+type LifecycleCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// MaxMessages bounds the messages in flight. The one with the oldest last event is evicted beyond the limit.
+	MaxMessages int `yaml:"max_messages"`
+	// MaxCompleted is the number of the removed messages kept for the API.
+	MaxCompleted int `yaml:"max_completed"`
+	// MaxEvents bounds the timeline of a message. The events after the limit are dropped.
+	MaxEvents int `yaml:"max_events"`
+	// OrphanTimeout evicts the messages in flight without events for the duration, whose lines are lost (e.g. by restarts).
+	OrphanTimeout model.Duration `yaml:"orphan_timeout"`
+	// Mask masks the addresses in the timeline.
+	Mask            MaskConfig `yaml:"mask"`
+	LatencyBuckets  []float64  `yaml:"latency_buckets"`
+	AttemptsBuckets []float64  `yaml:"attempts_buckets"`
+}
+
+func (c *LifecycleCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	if c.MaxMessages <= 0 {
+		errs = append(errs, &Error{Path: path + ".max_messages", Message: "must be positive"})
+	}
+	if c.MaxCompleted < 0 {
+		errs = append(errs, &Error{Path: path + ".max_completed", Message: "must not be negative"})
+	}
+	if c.MaxEvents <= 0 {
+		errs = append(errs, &Error{Path: path + ".max_events", Message: "must be positive"})
+	}
+	if c.OrphanTimeout <= 0 {
+		errs = append(errs, &Error{Path: path + ".orphan_timeout", Message: "must be positive"})
+	}
+	errs = append(errs, c.Mask.validate(path+".mask")...)
+	errs = append(errs, validateBuckets(path+".latency_buckets", c.LatencyBuckets)...)
+	errs = append(errs, validateBuckets(path+".attempts_buckets", c.AttemptsBuckets)...)
+	return errs
+}
+
+// PostscreenCollectorConfig configures the postscreen collector.
+type PostscreenCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// RankBuckets are the buckets of the combined DNSBL score, to tune postscreen_dnsbl_threshold.
+	RankBuckets []float64 `yaml:"rank_buckets"`
+}
+
+func (c *PostscreenCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	errs = append(errs, validateBuckets(path+".rank_buckets", c.RankBuckets)...)
+	return errs
+}
+
+// ContentFilterCollectorConfig configures the content_filter collector.
+type ContentFilterCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// ScanBuckets are the buckets of the time in seconds that the content filters take to scan a message.
+	ScanBuckets []float64 `yaml:"scan_buckets"`
+}
+
+func (c *ContentFilterCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	errs = append(errs, validateBuckets(path+".scan_buckets", c.ScanBuckets)...)
+	return errs
+}
+
+// AuthenticationCollectorConfig configures the authentication collector.
+type AuthenticationCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// MaxDomains bounds the domain label. Domains seen after the limit are counted as other.
+	MaxDomains int `yaml:"max_domains"`
+	// MaxPending bounds the queue IDs waiting for qmgr to know the sender domain. The oldest one is counted without the domain beyond the limit.
+	MaxPending int `yaml:"max_pending"`
+	// PendingTimeout counts the results of a queue ID without the domain when qmgr does not log it for the duration
+	// (e.g. the message is rejected by a milter).
+	PendingTimeout model.Duration `yaml:"pending_timeout"`
+}
+
+func (c *AuthenticationCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	if c.MaxDomains <= 0 {
+		errs = append(errs, &Error{Path: path + ".max_domains", Message: "must be positive"})
+	}
+	if c.MaxPending <= 0 {
+		errs = append(errs, &Error{Path: path + ".max_pending", Message: "must be positive"})
+	}
+	if c.PendingTimeout <= 0 {
+		errs = append(errs, &Error{Path: path + ".pending_timeout", Message: "must be positive"})
+	}
+	return errs
+}
+
+// ChecksCollectorConfig configures the checks collector.
+type ChecksCollectorConfig struct {
+	CollectorConfig `yaml:",inline"`
+	// Rules name the rules of header_checks and body_checks by the matched line, before the hash of the line.
+	Rules []CheckRuleConfig `yaml:"rules,omitempty"`
+	// MaxRules bounds the rule label. Rules seen after the limit are counted as other.
+	MaxRules int `yaml:"max_rules"`
+}
+
+func (c *ChecksCollectorConfig) validate(path string) Errors {
+	errs := c.CollectorConfig.validate(path)
+	for i, rule := range c.Rules {
+		errs = append(errs, rule.validate(fmt.Sprintf("%s.rules[%d]", path, i))...)
+	}
+	if c.MaxRules <= 0 {
+		errs = append(errs, &Error{Path: path + ".max_rules", Message: "must be positive"})
+	}
+	return errs
+}
+
+// CheckRuleConfig names the rule of the actions whose matched header or body line matches.
+type CheckRuleConfig struct {
+	Name string `yaml:"name"`
+	// Match is a regular expression of the matched header or body line, usually the pattern of the rule (e.g. `^Subject:.*viagra`).
+	Match *Regexp `yaml:"match"`
+}
+
+func (c *CheckRuleConfig) validate(path string) Errors {
+	var errs Errors
+	if c.Name == "" {
+		errs = append(errs, &Error{Path: path + ".name", Message: "is required"})
+	}
+	if c.Match == nil {
+		errs = append(errs, &Error{Path: path + ".match", Message: "is required"})
+	}
+	return errs
+}
+
+// ModuleConfig configures a probe of a showq target.
+type ModuleConfig struct {
+	// Timeout bounds the probe, together with the timeout given by Prometheus.
+	Timeout model.Duration `yaml:"timeout"`
+	// Processors is applied to each message of the target. If omitted, the top-level processors are used.
+	Processors []ProcessorConfig `yaml:"processors,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *ModuleConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultModuleConfig
+	type plain ModuleConfig
+	return unmarshal((*plain)(c))
+}
+
+func (c *ModuleConfig) validate(path string) Errors {
+	var errs Errors
+	if c.Timeout < 0 {
+		errs = append(errs, &Error{Path: path + ".timeout", Message: "must not be negative"})
+	}
+	for i, processor := range c.Processors {
+		errs = append(errs, processor.validate(fmt.Sprintf("%s.processors[%d]", path, i))...)
+	}
+	return errs
+}
+
+// LogsConfig configures the log inputs.
+type LogsConfig struct {
+	Files []FileLogConfig `yaml:"files,omitempty"`
+	// Syslog are the sockets to receive syslog messages on.
+	Syslog []SyslogLogConfig `yaml:"syslog,omitempty"`
+	// Journal is the systemd journal to follow, if any.
+	Journal *JournalLogConfig `yaml:"journal,omitempty"`
+	// Timezone is the time zone of timestamps without one (e.g. Asia/Tokyo). If omitted, the local time zone is used.
+	Timezone string `yaml:"timezone,omitempty"`
+	// StateFile is the file to save the positions in the logs, to resume from them after restart.
+	StateFile string `yaml:"state_file,omitempty"`
+	// CheckpointInterval is the interval to save the positions in the state file. If omitted, 10s is used.
+	CheckpointInterval model.Duration `yaml:"checkpoint_interval,omitempty"`
+}
+
+func (c *LogsConfig) validate(path string) Errors {
+	var errs Errors
+	for i, file := range c.Files {
+		errs = append(errs, file.validate(fmt.Sprintf("%s.files[%d]", path, i))...)
+	}
+	for i, syslog := range c.Syslog {
+		errs = append(errs, syslog.validate(fmt.Sprintf("%s.syslog[%d]", path, i))...)
+	}
+	if c.Journal != nil {
+		errs = append(errs, c.Journal.validate(path+".journal")...)
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			errs = append(errs, &Error{Path: path + ".timezone", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// FileLogConfig is a log file to follow (e.g. /var/log/mail.log or maillog_file).
+type FileLogConfig struct {
+	Path string `yaml:"path"`
+	// PollInterval is the interval to check the file for new lines and rotation.
+	PollInterval model.Duration `yaml:"poll_interval,omitempty"`
+	// StartAt is either end (skip existing lines) or beginning, where to start reading the file first opened.
+	StartAt string `yaml:"start_at,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *FileLogConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultFileLogConfig
+	type plain FileLogConfig
+	return unmarshal((*plain)(c))
+}
+
+func (c *FileLogConfig) validate(path string) Errors {
+	var errs Errors
+	if c.Path == "" {
+		errs = append(errs, &Error{Path: path + ".path", Message: "is required"})
+	}
+	if c.PollInterval <= 0 {
+		errs = append(errs, &Error{Path: path + ".poll_interval", Message: "must be positive"})
+	}
+	if c.StartAt != "end" && c.StartAt != "beginning" {
+		errs = append(errs, &Error{Path: path + ".start_at", Message: fmt.Sprintf("must be one of end, beginning, but is `%s`", c.StartAt)})
+	}
+	return errs
+}
+
+// SyslogLogConfig is a socket to receive syslog messages on.
+type SyslogLogConfig struct {
+	// Listen is the URL of the socket: udp://host:port, tcp://host:port, unix:///path, unixgram:///path,
+	// or postlog:///path to stand in for the postlog socket of Postfix.
+	Listen string `yaml:"listen"`
+	// Forward is the URL of the syslog target to forward the received messages to, if any.
+	Forward string `yaml:"forward,omitempty"`
+}
+
+func (c *SyslogLogConfig) validate(path string) Errors {
+	var errs Errors
+	if c.Listen == "" {
+		errs = append(errs, &Error{Path: path + ".listen", Message: "is required"})
+	}
+	return errs
+}
+
+// JournalLogConfig is the systemd journal to follow.
+type JournalLogConfig struct {
+	// JournalctlPath is the path to journalctl.
+	JournalctlPath string `yaml:"journalctl_path,omitempty"`
+	// Identifiers are the SYSLOG_IDENTIFIER of the entries to read. A trailing * matches any suffix.
+	Identifiers []string `yaml:"identifiers,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *JournalLogConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultJournalLogConfig
+	type plain JournalLogConfig
+	return unmarshal((*plain)(c))
+}
+
+func (c *JournalLogConfig) validate(path string) Errors {
+	var errs Errors
+	if c.JournalctlPath == "" {
+		errs = append(errs, &Error{Path: path + ".journalctl_path", Message: "is required"})
+	}
+	if len(c.Identifiers) == 0 {
+		errs = append(errs, &Error{Path: path + ".identifiers", Message: "at least one identifier is required"})
+	}
+	return errs
+}
+
+// ProcessorConfig is one of the message processors.
+// Exactly one of the fields must be set.
+type ProcessorConfig struct {
+	Mask    *MaskConfig   `yaml:"mask,omitempty"`
+	Include *FilterConfig `yaml:"include,omitempty"`
+	Exclude *FilterConfig `yaml:"exclude,omitempty"`
+	Domain  *DomainConfig `yaml:"domain,omitempty"`
+	Label   *LabelConfig  `yaml:"label,omitempty"`
+}
+
+func (c *ProcessorConfig) validate(path string) Errors {
+	var errs Errors
+	n := 0
+	if c.Mask != nil {
+		n++
+		errs = append(errs, c.Mask.validate(path+".mask")...)
+	}
+	if c.Include != nil {
+		n++
+		errs = append(errs, c.Include.validate(path+".include")...)
+	}
+	if c.Exclude != nil {
+		n++
+		errs = append(errs, c.Exclude.validate(path+".exclude")...)
+	}
+	if c.Domain != nil {
+		n++
+		errs = append(errs, c.Domain.validate(path+".domain")...)
+	}
+	if c.Label != nil {
+		n++
+		errs = append(errs, c.Label.validate(path+".label")...)
+	}
+	if n != 1 {
+		errs = append(errs, &Error{Path: path, Message: "exactly one of mask, include, exclude, domain, label must be set"})
+	}
+	return errs
+}
+
+// MaskConfig configures how addresses are masked.
+type MaskConfig struct {
+	// Policy is one of local_part (mask the part before @), full (mask the whole address) or none.
+	Policy string `yaml:"policy"`
+}
+
+func (c *MaskConfig) validate(path string) Errors {
+	switch c.Policy {
+	case "local_part", "full", "none":
+		return nil
+	default:
+		return Errors{&Error{Path: path + ".policy", Message: fmt.Sprintf("must be one of local_part, full, none, but is `%s`", c.Policy)}}
+	}
+}
+
+// FilterConfig matches messages that satisfy all specified conditions.
+type FilterConfig struct {
+	QueueNames  []string       `yaml:"queue_names,omitempty"`
+	Sender      *Regexp        `yaml:"sender,omitempty"`
+	Recipient   *Regexp        `yaml:"recipient,omitempty"`
+	OlderThan   model.Duration `yaml:"older_than,omitempty"`
+	YoungerThan model.Duration `yaml:"younger_than,omitempty"`
+}
+
+func (c *FilterConfig) validate(path string) Errors {
+	if len(c.QueueNames) == 0 && c.Sender == nil && c.Recipient == nil && c.OlderThan == 0 && c.YoungerThan == 0 {
+		return Errors{&Error{Path: path, Message: "at least one condition is required"}}
+	}
+	return nil
+}
+
+// DomainConfig extracts the domain of an address into a label.
+type DomainConfig struct {
+	Label string `yaml:"label"`
+	// Source is either sender or recipient (the first recipient).
+	Source string `yaml:"source"`
+	// Groups maps a group name to its domains. Domains in no group are labeled with Default.
+	Groups  map[string][]string `yaml:"groups,omitempty"`
+	Default string              `yaml:"default,omitempty"`
+}
+
+func (c *DomainConfig) validate(path string) Errors {
+	var errs Errors
+	errs = append(errs, validateLabelName(path+".label", c.Label)...)
+	if c.Source != "sender" && c.Source != "recipient" {
+		errs = append(errs, &Error{Path: path + ".source", Message: fmt.Sprintf("must be one of sender, recipient, but is `%s`", c.Source)})
+	}
+	seen := make(map[string]string)
+	for group, domains := range c.Groups {
+		for _, domain := range domains {
+			domain = strings.ToLower(domain)
+			if other, ok := seen[domain]; ok && other != group {
+				errs = append(errs, &Error{Path: fmt.Sprintf("%s.groups.%s", path, group), Message: fmt.Sprintf("domain `%s` is also in group `%s`", domain, other)})
+			}
+			seen[domain] = group
+		}
+	}
+	return errs
+}
+
+// LabelConfig enriches messages with a label by the first matching rule.
+type LabelConfig struct {
+	Name    string            `yaml:"name"`
+	Rules   []LabelRuleConfig `yaml:"rules"`
+	Default string            `yaml:"default,omitempty"`
+}
+
+func (c *LabelConfig) validate(path string) Errors {
+	var errs Errors
+	errs = append(errs, validateLabelName(path+".name", c.Name)...)
+	for i, rule := range c.Rules {
+		rulePath := fmt.Sprintf("%s.rules[%d]", path, i)
+		if rule.Source == "" {
+			errs = append(errs, &Error{Path: rulePath + ".source", Message: "is required"})
+		}
+		if rule.Regex == nil {
+			errs = append(errs, &Error{Path: rulePath + ".regex", Message: "is required"})
+		}
+	}
+	return errs
+}
+
+// LabelRuleConfig sets the label to Value when Source matches Regex.
+type LabelRuleConfig struct {
+	// Source is one of queue_name, sender, recipient, or a label added by a previous processor.
+	Source string  `yaml:"source"`
+	Regex  *Regexp `yaml:"regex"`
+	Value  string  `yaml:"value"`
+}
+
+// Regexp is a regular expression that is compiled when the configuration is loaded.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (r *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	regex, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	r.Regexp = regex
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (r Regexp) MarshalYAML() (interface{}, error) {
+	if r.Regexp == nil {
+		return nil, nil
+	}
+	return r.String(), nil
+}
+
+// Error is an invalid value at a path in the configuration.
+type Error struct {
+	Path    string
+	Message string
+}
+
+// Error returns an error string.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Errors is a list of invalid values in the configuration.
+type Errors []*Error
+
+// Error returns an error string.
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func validateInterval(path string, d model.Duration) Errors {
+	if time.Duration(d) < time.Second || time.Duration(d)%time.Second != 0 {
+		return Errors{&Error{Path: path, Message: fmt.Sprintf("must be a positive number of whole seconds, but is `%s`", d)}}
+	}
+	return nil
+}
+
+func validateBuckets(path string, buckets []float64) Errors {
+	if len(buckets) == 0 {
+		return Errors{&Error{Path: path, Message: "at least one bucket is required"}}
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return Errors{&Error{Path: fmt.Sprintf("%s[%d]", path, i), Message: "buckets must be in increasing order"}}
+		}
+	}
+	return nil
+}
+
+func validateLabelName(path string, name string) Errors {
+	if !model.LabelName(name).IsValid() {
+		return Errors{&Error{Path: path, Message: fmt.Sprintf("invalid label name `%s`", name)}}
+	}
+	if name == "queue_name" || name == "postfix_instance" {
+		return Errors{&Error{Path: path, Message: fmt.Sprintf("label name `%s` is reserved", name)}}
+	}
+	return nil
+}
+
+// Load parses the YAML input s into a Config and validates it.
+func Load(s string) (*Config, error) {
+	cfg := &Config{}
+	*cfg = DefaultConfig
+	if err := yaml.UnmarshalStrict([]byte(s), cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile parses the given YAML file into a Config and validates it.
+func LoadFile(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Load(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parsing YAML file %s: %v", filename, err)
+	}
+	return cfg, nil
+}
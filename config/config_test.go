@@ -0,0 +1,158 @@
+package config_test
+
+import (
+	"fmt"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleLoad() {
+	cfg, err := config.Load(`
+global:
+  collect_mode: scrape
+instances:
+  - name: inbound
+    showq_path: /var/spool/postfix-in/public/showq
+  - name: outbound
+    showq_path: /var/spool/postfix-out/public/showq
+`)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(cfg.Global.CollectMode, cfg.Global.Interval, len(cfg.Instances))
+	// Output: scrape 1m 2
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := config.Load(`
+web:
+  listen_address: ":19154"
+global:
+  interval: 30s
+collectors:
+  queue:
+    interval: 2m
+    size_buckets: [1024, 1048576]
+processors:
+  - exclude:
+      queue_names: [hold]
+  - mask:
+      policy: full
+  - domain:
+      label: recipient_domain
+      source: recipient
+      groups:
+        google: [gmail.com, googlemail.com]
+      default: other
+  - label:
+      name: tenant
+      rules:
+        - source: sender
+          regex: "@(.+)\\.example\\.com$"
+          value: "$1"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Web.ListenAddress != ":19154" {
+		t.Errorf("expected `:19154`, but actual is `%s`", cfg.Web.ListenAddress)
+	}
+	if cfg.Web.TelemetryPath != "/metrics" {
+		t.Errorf("expected default `/metrics`, but actual is `%s`", cfg.Web.TelemetryPath)
+	}
+	if time.Duration(cfg.Global.Interval) != 30*time.Second {
+		t.Errorf("expected `30s`, but actual is `%s`", cfg.Global.Interval)
+	}
+	if time.Duration(cfg.Collectors.Queue.Interval) != 2*time.Minute {
+		t.Errorf("expected `2m`, but actual is `%s`", cfg.Collectors.Queue.Interval)
+	}
+	if len(cfg.Collectors.Queue.SizeBuckets) != 2 {
+		t.Errorf("expected 2 buckets, but actual is `%v`", cfg.Collectors.Queue.SizeBuckets)
+	}
+	if len(cfg.Collectors.Queue.AgeBuckets) != len(config.DefaultQueueCollectorConfig.AgeBuckets) {
+		t.Errorf("expected default buckets, but actual is `%v`", cfg.Collectors.Queue.AgeBuckets)
+	}
+	if len(cfg.Processors) != 4 {
+		t.Errorf("expected 4 processors, but actual is `%v`", cfg.Processors)
+	}
+	if len(cfg.Instances) != 1 || cfg.Instances[0].ShowqPath != "/var/spool/postfix/public/showq" {
+		t.Errorf("expected the default instance, but actual is `%v`", cfg.Instances)
+	}
+}
+
+func TestLoadEmpty(t *testing.T) {
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Global.CollectMode != "background" {
+		t.Errorf("expected `background`, but actual is `%s`", cfg.Global.CollectMode)
+	}
+	if cfg.Processors != nil {
+		t.Errorf("expected no processors, but actual is `%v`", cfg.Processors)
+	}
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	_, err := config.Load("global:\n  colect_mode: scrape\n")
+	if err == nil || !strings.Contains(err.Error(), "line 2: field colect_mode not found") {
+		t.Errorf("expected unknown field error, but actual is `%v`", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	cases := []struct {
+		yaml     string
+		expected string
+	}{
+		{"global: {collect_mode: pull}", "global.collect_mode: must be one of scrape, background"},
+		{"global: {interval: 1500ms}", "global.interval: must be a positive number of whole seconds"},
+		{"instances: []", "instances: at least one instance is required"},
+		{"instances: [{showq_path: /a}, {name: b, showq_path: /b}]", "instances[0].name: is required when there are multiple instances"},
+		{"instances: [{name: a, showq_path: /a}, {name: a, showq_path: /b}]", "instances[1].name: duplicate instance name `a`"},
+		{"collectors: {queue: {age_buckets: [10, 1]}}", "collectors.queue.age_buckets[1]: buckets must be in increasing order"},
+		{"collectors: {delivery: {max_relays: 0}}", "collectors.delivery.max_relays: must be positive"},
+		{"collectors: {reject: {restrictions: [{name: greylisting, match: '('}]}}", "error parsing regexp: missing closing )"},
+		{"collectors: {reject: {restrictions: [{name: greylisting}]}}", "collectors.reject.restrictions[0].match: is required"},
+		{"collectors: {session: {commands_buckets: [5, 5]}}", "collectors.session.commands_buckets[1]: buckets must be in increasing order"},
+		{"collectors: {tls: {max_destinations: -1}}", "collectors.tls.max_destinations: must be positive"},
+		{"collectors: {sasl: {window: 0s}}", "collectors.sasl.window: must be positive"},
+		{"collectors: {sasl: {top_n: 20, max_tracked: 10}}", "collectors.sasl.max_tracked: must not be less than top_n"},
+		{"collectors: {sasl_users: {window: 10s, buckets: 20}}", "collectors.sasl_users.buckets: must be positive, with steps of at least 1s"},
+		{"collectors: {sasl_users: {mask: {policy: some}}}", "collectors.sasl_users.mask.policy: must be one of hash, local_part, full, none"},
+		{"collectors: {lifecycle: {mask: {policy: some}}}", "collectors.lifecycle.mask.policy: must be one of local_part, full, none"},
+		{"collectors: {postscreen: {rank_buckets: [3, 2]}}", "collectors.postscreen.rank_buckets[1]: buckets must be in increasing order"},
+		{"collectors: {content_filter: {scan_buckets: [1, 1]}}", "collectors.content_filter.scan_buckets[1]: buckets must be in increasing order"},
+		{"collectors: {authentication: {max_domains: 0}}", "collectors.authentication.max_domains: must be positive"},
+		{"collectors: {authentication: {pending_timeout: 0s}}", "collectors.authentication.pending_timeout: must be positive"},
+		{"collectors: {checks: {rules: [{match: viagra}]}}", "collectors.checks.rules[0].name: is required"},
+		{"collectors: {checks: {rules: [{name: viagra}]}}", "collectors.checks.rules[0].match: is required"},
+		{"processors: [{mask: {policy: some}}]", "processors[0].mask.policy: must be one of local_part, full, none"},
+		{"logs: {files: [{path: /var/log/mail.log, start_at: middle}]}", "logs.files[0].start_at: must be one of end, beginning"},
+		{"logs: {files: [{poll_interval: 1s}]}", "logs.files[0].path: is required"},
+		{"logs: {timezone: Mars/Olympus}", "logs.timezone: unknown time zone Mars/Olympus"},
+		{"logs: {syslog: [{forward: udp://127.0.0.1:514}]}", "logs.syslog[0].listen: is required"},
+		{"logs: {journal: {identifiers: []}}", "logs.journal.identifiers: at least one identifier is required"},
+		{"modules: {spool: {processors: [{include: {}}]}}", "modules.spool.processors[0].include: at least one condition is required"},
+		{"processors: [{mask: {policy: full}, exclude: {queue_names: [hold]}}]", "processors[0]: exactly one of"},
+		{"processors: [{include: {}}]", "processors[0].include: at least one condition is required"},
+		{"processors: [{domain: {label: queue_name, source: sender}}]", "processors[0].domain.label: label name `queue_name` is reserved"},
+		{"processors: [{domain: {label: d, source: from}}]", "processors[0].domain.source: must be one of sender, recipient"},
+		{"processors: [{label: {name: t, rules: [{source: sender}]}}]", "processors[0].label.rules[0].regex: is required"},
+	}
+	for _, c := range cases {
+		_, err := config.Load(c.yaml)
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("expected `%s`, but actual is `%v`", c.expected, err)
+		}
+	}
+}
+
+func TestLoadInvalidRegexp(t *testing.T) {
+	_, err := config.Load("processors: [{include: {sender: '('}}]")
+	if err == nil || !strings.Contains(err.Error(), "missing closing )") {
+		t.Errorf("expected regexp error, but actual is `%v`", err)
+	}
+}
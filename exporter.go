@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/go-kit/kit/log/level"
 	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
-	"github.com/k-kinzal/postfix-prometheus-exporter/postfix"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/web"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var (
@@ -18,15 +24,23 @@ var (
 	version   string
 	gitCommit string
 
+	// Commands
+	serveCommand       = kingpin.Command("serve", "Run the exporter (default).").Default()
+	checkConfigCommand = kingpin.Command("check-config", "Validate the configuration file and exit.")
+
 	// Command-line flags
+	configFile = kingpin.Flag(
+		"config.file",
+		"Path to the YAML configuration file. Flags given on the command line override its values.",
+	).String()
 	listenAddress = kingpin.Flag(
 		"web.listen-address",
 		"Address on which to expose metrics and web interface.",
-	).Default(":9154").String()
+	).Default(config.DefaultWebConfig.ListenAddress).String()
 	metricsPath = kingpin.Flag(
 		"web.telemetry-path",
 		"Path under which to expose metrics.",
-	).Default("/metrics").String()
+	).Default(config.DefaultWebConfig.TelemetryPath).String()
 	disableExporterMetrics = kingpin.Flag(
 		"web.disable-exporter-metrics",
 		"Exclude metrics about the exporter itself (promhttp_*, process_*, go_*).",
@@ -34,54 +48,283 @@ var (
 	postfixShowqPath = kingpin.Flag(
 		"postfix.showq-path",
 		"Path to showq in postfix.",
-	).Default("/var/spool/postfix/public/showq").String()
+	).Default(config.DefaultConfig.Instances[0].ShowqPath).String()
+	postfixMaillogPath = kingpin.Flag(
+		"postfix.maillog-path",
+		"Path to the mail log file to follow (e.g. /var/log/mail.log or maillog_file).",
+	).String()
+	postfixSyslogListen = kingpin.Flag(
+		"postfix.syslog-listen",
+		"URL of a socket to receive syslog messages on (e.g. udp://0.0.0.0:514, postlog:///var/spool/postfix/public/postlog). Can be repeated.",
+	).Strings()
+	postfixJournal = kingpin.Flag(
+		"postfix.journal",
+		"Follow the postfix/* entries of the systemd journal.",
+	).Bool()
+	postfixLogStateFile = kingpin.Flag(
+		"postfix.log-state-file",
+		"Path to the file to save the positions in the mail log, to resume from them after restart.",
+	).String()
 	postfixCollectIntervalSeconds = kingpin.Flag(
 		"postfix.interval",
 		"Postfix queue in the background to collect statistics on the interval (seconds).",
 	).Default("60").Uint64()
+	postfixCollectMode = kingpin.Flag(
+		"postfix.collect-mode",
+		"When to collect statistics of postfix queue: on every scrape or in the background on the interval. One of: [scrape, background]",
+	).Default(config.DefaultGlobalConfig.CollectMode).Enum("scrape", "background")
+	postfixCacheTTL = kingpin.Flag(
+		"postfix.cache-ttl",
+		"Minimum time to reuse statistics collected on a scrape (only in scrape mode).",
+	).Default(config.DefaultGlobalConfig.CacheTTL.String()).Duration()
+	postfixScrapeTimeoutOffset = kingpin.Flag(
+		"postfix.scrape-timeout-offset",
+		"Offset to subtract from the timeout given by Prometheus (only in scrape mode).",
+	).Default("500ms").Duration()
+	postfixMaxSnapshotAge = kingpin.Flag(
+		"postfix.max-snapshot-age",
+		"Age of the last successful collection after which /-/ready fails (default: 3 times the interval of each collector).",
+	).Default("0s").Duration()
+	readTimeout = kingpin.Flag(
+		"web.read-timeout",
+		"Maximum duration for reading an entire request.",
+	).Default(config.DefaultWebConfig.ReadTimeout.String()).Duration()
+	writeTimeout = kingpin.Flag(
+		"web.write-timeout",
+		"Maximum duration before timing out writes of a response.",
+	).Default(config.DefaultWebConfig.WriteTimeout.String()).Duration()
+	idleTimeout = kingpin.Flag(
+		"web.idle-timeout",
+		"Maximum duration to wait for the next request on a keep-alive connection.",
+	).Default(config.DefaultWebConfig.IdleTimeout.String()).Duration()
+	shutdownTimeout = kingpin.Flag(
+		"web.shutdown-timeout",
+		"Maximum duration to drain in-flight scrapes and collections on shutdown.",
+	).Default(config.DefaultWebConfig.ShutdownTimeout.String()).Duration()
+	webConfigFile = kingpin.Flag(
+		"web.config.file",
+		"Path to the web configuration file that enables TLS or basic authentication.",
+	).String()
+	enableLifecycle = kingpin.Flag(
+		"web.enable-lifecycle",
+		"Enable reloading the configuration via HTTP requests (POST /-/reload).",
+	).Bool()
 )
 
+// flagsSetByUser returns the names of flags given on the command line.
+func flagsSetByUser(args []string) map[string]bool {
+	flags := make(map[string]bool)
+	ctx, err := kingpin.CommandLine.ParseContext(args)
+	if err != nil {
+		return flags
+	}
+	for _, element := range ctx.Elements {
+		if f, ok := element.Clause.(*kingpin.FlagClause); ok {
+			flags[f.Model().Name] = true
+		}
+	}
+	return flags
+}
+
+// loadConfig loads the configuration file, and overrides its values with the flags given on the command line.
+// Without the configuration file, the values of the flags are used.
+func loadConfig(filename string, setByUser map[string]bool) (*config.Config, error) {
+	cfg := &config.Config{}
+	*cfg = config.DefaultConfig
+	if filename != "" {
+		c, err := config.LoadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		cfg = c
+	}
+
+	override := func(name string) bool {
+		return filename == "" || setByUser[name]
+	}
+	if override("web.listen-address") {
+		cfg.Web.ListenAddress = *listenAddress
+	}
+	if override("web.telemetry-path") {
+		cfg.Web.TelemetryPath = *metricsPath
+	}
+	if override("web.disable-exporter-metrics") {
+		cfg.Web.DisableExporterMetrics = *disableExporterMetrics
+	}
+	if override("web.read-timeout") {
+		cfg.Web.ReadTimeout = model.Duration(*readTimeout)
+	}
+	if override("web.write-timeout") {
+		cfg.Web.WriteTimeout = model.Duration(*writeTimeout)
+	}
+	if override("web.idle-timeout") {
+		cfg.Web.IdleTimeout = model.Duration(*idleTimeout)
+	}
+	if override("web.shutdown-timeout") {
+		cfg.Web.ShutdownTimeout = model.Duration(*shutdownTimeout)
+	}
+	if override("web.config.file") {
+		cfg.Web.ConfigFile = *webConfigFile
+	}
+	if override("postfix.showq-path") {
+		cfg.Instances = []config.InstanceConfig{{ShowqPath: *postfixShowqPath}}
+	}
+	if override("postfix.maillog-path") && *postfixMaillogPath != "" {
+		file := config.DefaultFileLogConfig
+		file.Path = *postfixMaillogPath
+		cfg.Logs.Files = []config.FileLogConfig{file}
+	}
+	if override("postfix.syslog-listen") && len(*postfixSyslogListen) > 0 {
+		cfg.Logs.Syslog = nil
+		for _, listen := range *postfixSyslogListen {
+			cfg.Logs.Syslog = append(cfg.Logs.Syslog, config.SyslogLogConfig{Listen: listen})
+		}
+	}
+	if override("postfix.journal") && *postfixJournal {
+		journal := config.DefaultJournalLogConfig
+		cfg.Logs.Journal = &journal
+	}
+	if override("postfix.log-state-file") {
+		cfg.Logs.StateFile = *postfixLogStateFile
+	}
+	if override("postfix.interval") {
+		cfg.Global.Interval = model.Duration(time.Duration(*postfixCollectIntervalSeconds) * time.Second)
+	}
+	if override("postfix.collect-mode") {
+		cfg.Global.CollectMode = *postfixCollectMode
+	}
+	if override("postfix.cache-ttl") {
+		cfg.Global.CacheTTL = model.Duration(*postfixCacheTTL)
+	}
+	if override("postfix.scrape-timeout-offset") {
+		cfg.Global.ScrapeTimeoutOffset = model.Duration(*postfixScrapeTimeoutOffset)
+	}
+
+	if override("postfix.max-snapshot-age") {
+		cfg.Global.MaxSnapshotAge = model.Duration(*postfixMaxSnapshotAge)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Web.ConfigFile != "" {
+		if _, err := web.LoadFile(cfg.Web.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
 func main() {
 	promlogConfig := &promlog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promlogConfig)
 	kingpin.Version(version)
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
 
 	logger := promlog.New(promlogConfig)
 
+	setByUser := flagsSetByUser(os.Args[1:])
+	cfg, err := loadConfig(*configFile, setByUser)
+	if command == checkConfigCommand.FullCommand() {
+		if *configFile == "" {
+			fmt.Fprintln(os.Stderr, "FAILED: --config.file is required")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FAILED: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("SUCCESS: %s is valid\n", *configFile)
+		return
+	}
+	if err != nil {
+		level.Error(logger).Log("msg", "Error loading config", "err", err)
+		os.Exit(1)
+	}
+
 	level.Info(logger).Log("msg", "Starting postfix exporter", "version", version, "git commit", gitCommit)
 
-	queue := postfix.NewPostQueue(&postfix.PostQueueOpt{ShowqPath: *postfixShowqPath})
-	scheduler := collector.NewPostfixQueueCollectScheduler(queue, logger)
+	e, err := newExporter(*configFile, setByUser, cfg, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Couldn't create collector", "err", err)
+		os.Exit(1)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		ch := scheduler.Start(*postfixCollectIntervalSeconds)
-		scheduler.Collect()
-		<-ch
+		for range hup {
+			if err := e.Reload(); err != nil {
+				level.Error(logger).Log("msg", "Error reloading config", "err", err)
+			}
+		}
 	}()
 
 	registry := prometheus.NewRegistry()
-	if !*disableExporterMetrics {
+	if e.input != nil {
+		registry.MustRegister(e.input)
+	}
+	if !cfg.Web.DisableExporterMetrics {
 		registry.MustRegister(
 			prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
 			prometheus.NewGoCollector(),
 		)
 	}
-	registry.MustRegister(scheduler.Collector())
 
-	http.Handle(*metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Web.TelemetryPath, e.Handler(registry))
+	mux.Handle("/probe", collector.ProbeHandler(e.Config, logger))
+	mux.Handle("/-/healthy", e.HealthyHandler())
+	mux.Handle("/-/ready", e.ReadyHandler())
+	mux.Handle("/api/sasl/offenders", e.APIHandler("sasl"))
+	mux.Handle("/api/messages/", e.APIHandler("lifecycle"))
+	if *enableLifecycle {
+		mux.Handle("/-/reload", e.ReloadHandler())
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>Postfix Exporter</title></head>
 			<body>
 			<h1>Postfix Exporter</h1>
-			<p><a href="` + *metricsPath + `">Metrics</a></p>
+			<p><a href="` + cfg.Web.TelemetryPath + `">Metrics</a></p>
+			<p><a href="/-/ready">Readiness</a></p>
 			</body>
 			</html>`))
 	})
 
-	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
+	server := &http.Server{
+		Addr:         cfg.Web.ListenAddress,
+		Handler:      mux,
+		ReadTimeout:  time.Duration(cfg.Web.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Web.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Web.IdleTimeout),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		level.Info(logger).Log("msg", "Listening on", "address", cfg.Web.ListenAddress)
+		serverErr <- web.ListenAndServe(server, cfg.Web.ConfigFile, logger)
+	}()
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+	select {
+	case sig := <-term:
+		level.Info(logger).Log("msg", "Received signal, shutting down gracefully", "signal", sig)
+	case err := <-serverErr:
 		level.Error(logger).Log("err", err)
 		os.Exit(1)
 	}
+	signal.Stop(hup)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Web.ShutdownTimeout))
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		level.Warn(logger).Log("msg", "Closing in-flight scrapes", "err", err)
+		server.Close()
+	}
+	if err := e.Shutdown(ctx); err != nil {
+		level.Warn(logger).Log("msg", "Interrupted in-flight collections", "err", err)
+	}
+	level.Info(logger).Log("msg", "See you next time!")
 }
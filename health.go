@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/util"
+	"net/http"
+)
+
+// readiness is the body of /-/ready, with the log sources that failed and wait to be restarted.
+type readiness struct {
+	*collector.Readiness
+	LogSourcesDown map[string]string `json:"log_sources_down,omitempty"`
+}
+
+// HealthyHandler returns a handler of GET /-/healthy, which succeeds while the exporter is running.
+func (e *exporter) HealthyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Postfix Exporter is Healthy.\n"))
+	})
+}
+
+// ReadyHandler returns a handler of GET /-/ready, which fails until every enabled collector has succeeded,
+// and when the last successful update of a collector is older than the maximum snapshot age or a log source is down.
+// In scrape mode, the collectors are updated before the check unless the cached statistics are fresh.
+// The body is a JSON breakdown per collector and instance.
+func (e *exporter) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.mu.RLock()
+		cfg := e.cfg
+		collectors := e.collectors
+		onScrape := e.onScrape
+		e.mu.RUnlock()
+
+		if onScrape != nil {
+			onScrape.Collect(r.Context())
+		}
+		body := &readiness{Readiness: collectors.Readiness(cfg.MaxSnapshotAge)}
+		if e.input != nil {
+			for name, err := range e.input.Down() {
+				if body.LogSourcesDown == nil {
+					body.LogSourcesDown = make(map[string]string)
+				}
+				body.LogSourcesDown[name] = util.EmailMask(err.Error())
+				body.Ready = false
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !body.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(body)
+	})
+}
@@ -0,0 +1,128 @@
+package logs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// maxLineHash bounds the bytes at the end of a line that are hashed to verify a checkpoint.
+const maxLineHash = 64 * 1024
+
+// Checkpointer is a Source that resumes from the position saved in the state file.
+type Checkpointer interface {
+	Source
+
+	// SavePosition returns the position after the last line passed to fn, or nil if there is none.
+	SavePosition() (json.RawMessage, error)
+	// RestorePosition sets the position to resume from. It is called before Run.
+	RestorePosition(b json.RawMessage) error
+}
+
+// StateFile stores the positions of the sources by name in a JSON file.
+type StateFile struct {
+	path string
+}
+
+// Load returns the positions of the sources. If the file does not exist, no positions are returned.
+func (f *StateFile) Load() (map[string]json.RawMessage, error) {
+	positions := make(map[string]json.RawMessage)
+	b, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return positions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &positions); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// Save replaces the positions of the sources.
+// The file is written to a temporary file and renamed, so that a crash does not leave a partial file.
+func (f *StateFile) Save(positions map[string]json.RawMessage) error {
+	b, err := json.MarshalIndent(positions, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// NewStateFile returns new StateFile at the path.
+func NewStateFile(path string) *StateFile {
+	return &StateFile{path: path}
+}
+
+// Position is the position of a Tailer in a file.
+type Position struct {
+	Inode  uint64 `json:"inode"`
+	Device uint64 `json:"device"`
+	Offset int64  `json:"offset"`
+	// LastLineHash is the hash of the line before the offset, to verify that the file at the offset is the same one.
+	LastLineHash string `json:"last_line_hash,omitempty"`
+}
+
+// fileID returns the inode and the device of the file.
+func fileID(info os.FileInfo) (uint64, uint64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(st.Ino), uint64(st.Dev)
+}
+
+// hashLine returns the hash of the line without the line terminator.
+func hashLine(line []byte) string {
+	if len(line) > maxLineHash {
+		line = line[len(line)-maxLineHash:]
+	}
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// lastLineHash returns the hash of the line that ends at the offset of the file, or empty if offset is 0.
+func lastLineHash(f *os.File, offset int64) (string, error) {
+	if offset == 0 {
+		return "", nil
+	}
+	size := int64(maxLineHash + 1)
+	if offset < size {
+		size = offset
+	}
+	buf := make([]byte, size)
+	if _, err := f.ReadAt(buf, offset-size); err != nil {
+		return "", err
+	}
+	if buf[len(buf)-1] == '\n' {
+		buf = buf[:len(buf)-1]
+	}
+	for i := len(buf) - 1; i >= 0; i-- {
+		if buf[i] == '\n' {
+			buf = buf[i+1:]
+			break
+		}
+	}
+	return hashLine(buf), nil
+}
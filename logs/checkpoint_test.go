@@ -0,0 +1,243 @@
+package logs_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/logs"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// runUntil runs the tailer until the lines are read, and returns the position after them.
+func runUntil(t *testing.T, tailer *logs.Tailer, expected ...string) json.RawMessage {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string, 100)
+	done := make(chan error)
+	go func() {
+		done <- tailer.Run(ctx, func(line string) {
+			lines <- line
+		})
+	}()
+	expectLines(t, lines, expected...)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-lines:
+		t.Fatalf("expected no more lines, but actual is `%s`", line)
+	default:
+	}
+
+	b, err := tailer.SavePosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// restartTailer returns new Tailer that resumes from the position.
+func restartTailer(t *testing.T, filename string, position json.RawMessage) *logs.Tailer {
+	t.Helper()
+	tailer := logs.NewTailer(filename, 10*time.Millisecond, true, log.NewNopLogger())
+	if err := tailer.RestorePosition(position); err != nil {
+		t.Fatal(err)
+	}
+	return tailer
+}
+
+func TestTailer_Resume(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "line 1\n")
+
+	position := runUntil(t, logs.NewTailer(filename, 10*time.Millisecond, true, log.NewNopLogger()), "line 1")
+
+	appendFile(t, filename, "line 2\n")
+	runUntil(t, restartTailer(t, filename, position), "line 2")
+}
+
+func TestTailer_RunAgain(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "skipped\n")
+
+	// Input runs a failed source again, which continues from the last line instead of the end of the file.
+	tailer := logs.NewTailer(filename, 10*time.Millisecond, false, log.NewNopLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string, 100)
+	done := make(chan error)
+	go func() {
+		done <- tailer.Run(ctx, func(line string) {
+			lines <- line
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filename, "line 1\n")
+	expectLines(t, lines, "line 1")
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, filename, "line 2\n")
+	runUntil(t, tailer, "line 2")
+}
+
+func TestTailer_RunAgainFromStart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "line 1\n")
+
+	tailer := logs.NewTailer(filename, 10*time.Millisecond, true, log.NewNopLogger())
+	position := runUntil(t, tailer, "line 1")
+	appendFile(t, filename, "line 2\n")
+	runUntil(t, tailer, "line 2")
+
+	// The restored position is used only by the first run.
+	tailer = restartTailer(t, filename, position)
+	runUntil(t, tailer, "line 2")
+	appendFile(t, filename, "line 3\n")
+	runUntil(t, tailer, "line 3")
+}
+
+func TestTailer_ResumeRename(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "line 1\n")
+
+	position := runUntil(t, logs.NewTailer(filename, 10*time.Millisecond, true, log.NewNopLogger()), "line 1")
+
+	appendFile(t, filename, "line 2\n")
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, filename, "line 3\n")
+	runUntil(t, restartTailer(t, filename, position), "line 2", "line 3")
+}
+
+func TestTailer_ResumeCopyTruncate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "line 1\n")
+
+	position := runUntil(t, logs.NewTailer(filename, 10*time.Millisecond, true, log.NewNopLogger()), "line 1")
+
+	appendFile(t, filename, "line 2\n")
+	appendFile(t, filename+".1", "line 1\nline 2\n")
+	if err := os.Truncate(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, filename, "line 3\n")
+	runUntil(t, restartTailer(t, filename, position), "line 2", "line 3")
+}
+
+func TestTailer_ResumeMismatch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "line 1\n")
+
+	position := runUntil(t, logs.NewTailer(filename, 10*time.Millisecond, true, log.NewNopLogger()), "line 1")
+
+	// the file is rewritten in place, so the line before the offset differs
+	if err := ioutil.WriteFile(filename, []byte("other 1\nother 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	runUntil(t, restartTailer(t, filename, position), "other 1", "other 2")
+}
+
+func TestStateFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	file := logs.NewStateFile(path.Join(dir, "state.json"))
+
+	positions, err := file.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 0 {
+		t.Errorf("expected no positions, but actual is `%v`", positions)
+	}
+
+	if err := file.Save(map[string]json.RawMessage{"file:/var/log/mail.log": json.RawMessage(`{"offset":1}`)}); err != nil {
+		t.Fatal(err)
+	}
+	positions, err = file.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p logs.Position
+	if err := json.Unmarshal(positions["file:/var/log/mail.log"], &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Offset != 1 {
+		t.Errorf("expected `1`, but actual is `%v`", p.Offset)
+	}
+}
+
+// eventChannel passes the events to the channel.
+type eventChannel chan *maillog.Event
+
+func (c eventChannel) HandleEvent(e *maillog.Event) {
+	c <- e
+}
+
+func TestInput_RunStateFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "Apr  1 11:59:59 mail postfix/smtpd[1]: 3F8C41A2B3: client=unknown[192.0.2.1]\n")
+	stateFile := logs.NewStateFile(path.Join(dir, "state.json"))
+
+	run := func() *maillog.Event {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		input := logs.NewInput([]logs.Source{logs.NewTailer(filename, 10*time.Millisecond, true, log.NewNopLogger())}, &maillog.Parser{}, log.NewNopLogger())
+		input.SetStateFile(stateFile, time.Hour)
+		events := make(eventChannel, 10)
+		input.SetHandlers([]logs.Handler{events})
+		done := make(chan error)
+		go func() {
+			done <- input.Run(ctx)
+		}()
+
+		var e *maillog.Event
+		select {
+		case e = <-events:
+		case <-time.After(3 * time.Second):
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	if e := run(); e == nil || e.QueueID != "3F8C41A2B3" {
+		t.Fatalf("expected the event of `3F8C41A2B3`, but actual is `%v`", e)
+	}
+	positions, err := stateFile.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := positions["file:"+filename]; !ok {
+		t.Fatalf("expected the position of `%s`, but actual is `%v`", filename, positions)
+	}
+
+	appendFile(t, filename, "Apr  1 12:00:00 mail postfix/qmgr[2]: 4A1B2C3D4E: removed\n")
+	if e := run(); e == nil || e.QueueID != "4A1B2C3D4E" {
+		t.Errorf("expected the event of `4A1B2C3D4E`, but actual is `%v`", e)
+	}
+}
@@ -0,0 +1,345 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/k-kinzal/postfix-prometheus-exporter/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+const namespace = "postfix"
+
+const (
+	// defaultCheckpointInterval is the interval to save the positions if it is not configured.
+	defaultCheckpointInterval = 10 * time.Second
+	// defaultMinRetryInterval and defaultMaxRetryInterval bound the backoff to restart a failed source.
+	defaultMinRetryInterval = time.Second
+	defaultMaxRetryInterval = time.Minute
+)
+
+// Source produces log lines until ctx is done.
+type Source interface {
+	// Name identifies the source in metrics and logs.
+	Name() string
+	// Run passes each log line without the line terminator to fn. Calls of fn are not concurrent.
+	Run(ctx context.Context, fn func(line string)) error
+}
+
+// Handler handles the events parsed from log lines.
+type Handler interface {
+	HandleEvent(e *maillog.Event)
+}
+
+// Input reads log lines from the sources, parses them into events, and passes the events to the handlers.
+// Events are passed to the handlers one at a time.
+type Input struct {
+	sources []Source
+	parser  *maillog.Parser
+	logger  log.Logger
+
+	stateFile          *StateFile
+	checkpointInterval time.Duration
+	minRetryInterval   time.Duration
+	maxRetryInterval   time.Duration
+
+	mu       sync.Mutex
+	handlers []Handler
+
+	downMu sync.Mutex
+	down   map[string]error
+
+	// metrics
+	linesCounter       *prometheus.CounterVec
+	parseErrorsCounter *prometheus.CounterVec
+	sourceUpGauge      *prometheus.GaugeVec
+}
+
+// SetHandlers replaces the handlers of the events.
+func (i *Input) SetHandlers(handlers []Handler) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.handlers = handlers
+}
+
+// SetStateFile saves the positions of the sources that implement the Checkpointer interface in the file
+// on the interval and when Run returns, and resumes from them when Run is called.
+func (i *Input) SetStateFile(file *StateFile, interval time.Duration) {
+	i.stateFile = file
+	i.checkpointInterval = interval
+}
+
+// SetRetryInterval sets the backoff to restart a failed source, which doubles from min up to max.
+func (i *Input) SetRetryInterval(min time.Duration, max time.Duration) {
+	i.minRetryInterval = min
+	i.maxRetryInterval = max
+}
+
+// Down returns the errors of the sources that failed and wait to be restarted, by the name of the source.
+func (i *Input) Down() map[string]error {
+	i.downMu.Lock()
+	defer i.downMu.Unlock()
+	down := make(map[string]error, len(i.down))
+	for name, err := range i.down {
+		down[name] = err
+	}
+	return down
+}
+
+// Handle parses a log line from the named source and passes the event to the handlers.
+func (i *Input) Handle(source string, line string) {
+	i.linesCounter.WithLabelValues(source).Inc()
+	e, err := i.parser.Parse(line)
+	if err != nil {
+		i.parseErrorsCounter.WithLabelValues(source).Inc()
+		level.Debug(i.logger).Log("msg", "Failed to parse log line", "source", source, "err", err, "line", util.EmailMask(line))
+		return
+	}
+	i.HandleEvent(source, e)
+}
+
+// HandleEvent passes an event from the named source to the handlers.
+// It is used by sources that produce structured entries instead of lines.
+func (i *Input) HandleEvent(source string, e *maillog.Event) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, h := range i.handlers {
+		h.HandleEvent(e)
+	}
+}
+
+// Run runs the sources until ctx is done, or until all sources finish.
+// A source that fails is restarted with backoff while the other sources keep running,
+// and is reported by Down and postfix_log_source_up until it runs again.
+func (i *Input) Run(ctx context.Context) error {
+	i.restore()
+
+	done := make(chan struct{}, len(i.sources))
+	for _, source := range i.sources {
+		go func(source Source) {
+			i.runSource(ctx, source)
+			done <- struct{}{}
+		}(source)
+	}
+
+	var tick <-chan time.Time
+	if i.stateFile != nil {
+		ticker := time.NewTicker(i.checkpointInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for remaining := len(i.sources); remaining > 0; {
+		select {
+		case <-done:
+			remaining--
+		case <-tick:
+			i.checkpoint()
+		}
+	}
+	i.checkpoint()
+	return nil
+}
+
+// runSource runs the source until ctx is done or the source finishes, and restarts it when it fails.
+// The backoff doubles on each consecutive failure, and is reset when the source ran longer than the maximum backoff.
+func (i *Input) runSource(ctx context.Context, source Source) {
+	name := source.Name()
+	backoff := i.minRetryInterval
+	for {
+		i.setDown(name, nil)
+		started := time.Now()
+		err := source.Run(ctx, func(line string) {
+			i.Handle(name, line)
+		})
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		i.setDown(name, err)
+		if time.Since(started) > i.maxRetryInterval {
+			backoff = i.minRetryInterval
+		}
+		level.Error(i.logger).Log("msg", "Log source failed, restarting", "source", name, "err", err, "backoff", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > i.maxRetryInterval {
+			backoff = i.maxRetryInterval
+		}
+	}
+}
+
+// setDown records the error of the named source, or that it runs if err is nil.
+func (i *Input) setDown(name string, err error) {
+	i.downMu.Lock()
+	defer i.downMu.Unlock()
+	if err == nil {
+		delete(i.down, name)
+		i.sourceUpGauge.WithLabelValues(name).Set(1)
+		return
+	}
+	i.down[name] = err
+	i.sourceUpGauge.WithLabelValues(name).Set(0)
+}
+
+// restore passes the positions in the state file to the sources.
+// A state file that cannot be read is ignored, and the sources start as if there were no state file.
+func (i *Input) restore() {
+	if i.stateFile == nil {
+		return
+	}
+	positions, err := i.stateFile.Load()
+	if err != nil {
+		level.Warn(i.logger).Log("msg", "Failed to load the state file, starting without the positions", "path", i.stateFile.path, "err", err)
+		return
+	}
+	for _, source := range i.sources {
+		checkpointer, ok := source.(Checkpointer)
+		if !ok {
+			continue
+		}
+		b, ok := positions[source.Name()]
+		if !ok {
+			continue
+		}
+		if err := checkpointer.RestorePosition(b); err != nil {
+			level.Warn(i.logger).Log("msg", "Failed to restore the position", "source", source.Name(), "err", err)
+		}
+	}
+}
+
+// checkpoint saves the positions of the sources in the state file.
+func (i *Input) checkpoint() {
+	if i.stateFile == nil {
+		return
+	}
+	positions := make(map[string]json.RawMessage)
+	for _, source := range i.sources {
+		checkpointer, ok := source.(Checkpointer)
+		if !ok {
+			continue
+		}
+		b, err := checkpointer.SavePosition()
+		if err != nil {
+			level.Warn(i.logger).Log("msg", "Failed to save the position", "source", source.Name(), "err", err)
+			continue
+		}
+		if b != nil {
+			positions[source.Name()] = b
+		}
+	}
+	if err := i.stateFile.Save(positions); err != nil {
+		level.Warn(i.logger).Log("msg", "Failed to save the state file", "path", i.stateFile.path, "err", err)
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (i *Input) Describe(ch chan<- *prometheus.Desc) {
+	i.linesCounter.Describe(ch)
+	i.parseErrorsCounter.Describe(ch)
+	i.sourceUpGauge.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (i *Input) Collect(ch chan<- prometheus.Metric) {
+	i.linesCounter.Collect(ch)
+	i.parseErrorsCounter.Collect(ch)
+	i.sourceUpGauge.Collect(ch)
+}
+
+// NewInput returns new Input with the sources.
+func NewInput(sources []Source, parser *maillog.Parser, logger log.Logger) *Input {
+	return &Input{
+		sources:          sources,
+		parser:           parser,
+		logger:           logger,
+		minRetryInterval: defaultMinRetryInterval,
+		maxRetryInterval: defaultMaxRetryInterval,
+		down:             make(map[string]error),
+		linesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "log",
+				Name:      "lines_total",
+				Help:      "Total number of log lines read.",
+			},
+			[]string{"source"}),
+		parseErrorsCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "log",
+				Name:      "parse_errors_total",
+				Help:      "Total number of log lines that failed to be parsed.",
+			},
+			[]string{"source"}),
+		sourceUpGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "log",
+				Name:      "source_up",
+				Help:      "Whether the log source is running (1) or failed and waits to be restarted (0).",
+			},
+			[]string{"source"}),
+	}
+}
+
+// NewInputFromConfig returns new Input with the sources of the configuration.
+// It returns nil if no source is configured.
+func NewInputFromConfig(cfg *config.LogsConfig, logger log.Logger) (*Input, error) {
+	parser := &maillog.Parser{}
+	if cfg.Timezone != "" {
+		location, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		parser.Location = location
+	}
+
+	var sources []Source
+	for _, file := range cfg.Files {
+		sources = append(sources, NewTailer(file.Path, time.Duration(file.PollInterval), file.StartAt == "beginning", log.With(logger, "source", "file")))
+	}
+	for i, syslog := range cfg.Syslog {
+		logger := log.With(logger, "source", "syslog")
+		var forwarder *Forwarder
+		if syslog.Forward != "" {
+			var err error
+			forwarder, err = NewForwarder(syslog.Forward, logger)
+			if err != nil {
+				return nil, fmt.Errorf("logs.syslog[%d].forward: %v", i, err)
+			}
+		}
+		receiver, err := NewSyslogReceiver(syslog.Listen, forwarder, logger)
+		if err != nil {
+			return nil, fmt.Errorf("logs.syslog[%d].listen: %v", i, err)
+		}
+		sources = append(sources, receiver)
+	}
+	if cfg.Journal != nil {
+		sources = append(sources, NewJournal(cfg.Journal.JournalctlPath, cfg.Journal.Identifiers, log.With(logger, "source", "journal")))
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	input := NewInput(sources, parser, logger)
+	if cfg.StateFile != "" {
+		interval := time.Duration(cfg.CheckpointInterval)
+		if interval == 0 {
+			interval = defaultCheckpointInterval
+		}
+		input.SetStateFile(NewStateFile(cfg.StateFile), interval)
+	}
+	return input, nil
+}
@@ -0,0 +1,135 @@
+package logs_test
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/logs"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lineSource produces the lines once.
+type lineSource []string
+
+func (s lineSource) Name() string {
+	return "lines"
+}
+
+func (s lineSource) Run(ctx context.Context, fn func(line string)) error {
+	for _, line := range s {
+		fn(line)
+	}
+	return nil
+}
+
+// eventRecorder records the events.
+type eventRecorder []*maillog.Event
+
+func (r *eventRecorder) HandleEvent(e *maillog.Event) {
+	*r = append(*r, e)
+}
+
+func TestInput_Run(t *testing.T) {
+	source := lineSource{
+		"Apr  1 11:59:59 mail postfix/smtpd[1]: connect from unknown[192.0.2.1]",
+		"garbage",
+		"Apr  1 11:59:59 mail postfix/smtpd[1]: 3F8C41A2B3: client=unknown[192.0.2.1]",
+	}
+	input := logs.NewInput([]logs.Source{source}, &maillog.Parser{}, log.NewNopLogger())
+	recorder := &eventRecorder{}
+	input.SetHandlers([]logs.Handler{recorder})
+
+	if err := input.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(*recorder) != 2 || (*recorder)[1].QueueID != "3F8C41A2B3" {
+		t.Errorf("expected 2 events, but actual is `%v`", *recorder)
+	}
+
+	expected := `
+# HELP postfix_log_parse_errors_total Total number of log lines that failed to be parsed.
+# TYPE postfix_log_parse_errors_total counter
+postfix_log_parse_errors_total{source="lines"} 1
+`
+	if err := testutil.CollectAndCompare(input, strings.NewReader(expected), "postfix_log_parse_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+// flakySource fails the first runs, then produces the line until ctx is done.
+type flakySource struct {
+	line     string
+	failures int
+
+	mu   sync.Mutex
+	runs int
+}
+
+func (s *flakySource) Name() string {
+	return "flaky"
+}
+
+func (s *flakySource) Run(ctx context.Context, fn func(line string)) error {
+	s.mu.Lock()
+	s.runs++
+	runs := s.runs
+	s.mu.Unlock()
+	if runs <= s.failures {
+		return errors.New("connection refused")
+	}
+	fn(s.line)
+	<-ctx.Done()
+	return nil
+}
+
+func TestInput_RunRestartsFailedSource(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	healthy := lineSource{"Apr  1 11:59:59 mail postfix/smtpd[1]: connect from unknown[192.0.2.1]"}
+	flaky := &flakySource{line: "Apr  1 11:59:59 mail postfix/smtpd[1]: 3F8C41A2B3: client=unknown[192.0.2.1]", failures: 2}
+	input := logs.NewInput([]logs.Source{healthy, flaky}, &maillog.Parser{}, log.NewNopLogger())
+	input.SetRetryInterval(50*time.Millisecond, time.Second)
+	events := make(eventChannel, 10)
+	input.SetHandlers([]logs.Handler{events})
+	done := make(chan error)
+	go func() {
+		done <- input.Run(ctx)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := input.Down()["flaky"]; err == nil {
+		t.Errorf("expected the failed source to be down, but actual is `%v`", input.Down())
+	}
+	expected := `
+# HELP postfix_log_source_up Whether the log source is running (1) or failed and waits to be restarted (0).
+# TYPE postfix_log_source_up gauge
+postfix_log_source_up{source="flaky"} 0
+postfix_log_source_up{source="lines"} 1
+`
+	if err := testutil.CollectAndCompare(input, strings.NewReader(expected), "postfix_log_source_up"); err != nil {
+		t.Error(err)
+	}
+
+	var queueIDs []string
+	for len(queueIDs) < 2 {
+		select {
+		case e := <-events:
+			queueIDs = append(queueIDs, e.QueueID)
+		case <-ctx.Done():
+			t.Fatalf("expected the events of both sources, but actual is `%v`", queueIDs)
+		}
+	}
+	if down := input.Down(); len(down) != 0 {
+		t.Errorf("expected no source is down after the restart, but actual is `%v`", down)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
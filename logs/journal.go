@@ -0,0 +1,214 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxJournalFieldSize bounds a binary field of the journal export format.
+const maxJournalFieldSize = 1024 * 1024
+
+// Journal follows the systemd journal by `journalctl -o export --follow`.
+// Entries are passed as RFC 5424 lines, with __REALTIME_TIMESTAMP as the timestamp, _HOSTNAME as the hostname,
+// SYSLOG_IDENTIFIER as the app name and _PID as the process ID.
+// It implements the Checkpointer interface to resume after the cursor of the last entry after restart.
+type Journal struct {
+	journalctlPath string
+	identifiers    []string
+	logger         log.Logger
+
+	mu     sync.Mutex
+	cursor string
+}
+
+// Name implements the Source interface.
+func (j *Journal) Name() string {
+	return "journal"
+}
+
+// SavePosition implements the Checkpointer interface.
+func (j *Journal) SavePosition() (json.RawMessage, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cursor == "" {
+		return nil, nil
+	}
+	return json.Marshal(map[string]string{"cursor": j.cursor})
+}
+
+// RestorePosition implements the Checkpointer interface.
+func (j *Journal) RestorePosition(b json.RawMessage) error {
+	var p map[string]string
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cursor = p["cursor"]
+	return nil
+}
+
+// Run implements the Source interface.
+// It starts after the restored cursor if any, or at the end of the journal, and follows it until ctx is done.
+func (j *Journal) Run(ctx context.Context, fn func(line string)) error {
+	args := []string{"--output=export", "--follow"}
+	j.mu.Lock()
+	if j.cursor != "" {
+		args = append(args, "--after-cursor="+j.cursor)
+	} else {
+		args = append(args, "--lines=0")
+	}
+	j.mu.Unlock()
+
+	cmd := exec.CommandContext(ctx, j.journalctlPath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	level.Info(j.logger).Log("msg", "Following journal", "args", strings.Join(args, " "))
+
+	reader := bufio.NewReader(stdout)
+	var readErr error
+	for {
+		entry, err := readJournalEntry(reader)
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+		if j.match(entry["SYSLOG_IDENTIFIER"]) {
+			fn(formatJournalEntry(entry))
+		}
+		if cursor, ok := entry["__CURSOR"]; ok {
+			j.mu.Lock()
+			j.cursor = cursor
+			j.mu.Unlock()
+		}
+	}
+	if readErr != nil {
+		cmd.Process.Kill()
+	}
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if readErr != nil {
+		return readErr
+	}
+	if err != nil {
+		return fmt.Errorf("journalctl exited: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return fmt.Errorf("journalctl exited")
+}
+
+// match returns whether the SYSLOG_IDENTIFIER is one of the identifiers.
+func (j *Journal) match(identifier string) bool {
+	for _, pattern := range j.identifiers {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(identifier, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if identifier == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// formatJournalEntry returns the RFC 5424 line of the entry.
+func formatJournalEntry(entry map[string]string) string {
+	timestamp := "-"
+	if usec, err := strconv.ParseInt(entry["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		timestamp = time.Unix(0, usec*int64(time.Microsecond)).UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+	pid := entry["_PID"]
+	if pid == "" {
+		pid = entry["SYSLOG_PID"]
+	}
+	line := fmt.Sprintf("1 %s %s %s %s - - %s",
+		timestamp, nilOr(entry["_HOSTNAME"]), nilOr(entry["SYSLOG_IDENTIFIER"]), nilOr(pid), entry["MESSAGE"])
+	if priority, err := strconv.Atoi(entry["PRIORITY"]); err == nil {
+		facility, _ := strconv.Atoi(entry["SYSLOG_FACILITY"])
+		line = fmt.Sprintf("<%d>%s", facility*8+priority, line)
+	}
+	return line
+}
+
+// nilOr returns the NILVALUE of RFC 5424 for empty s.
+func nilOr(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// readJournalEntry reads an entry of the journal export format, which ends with an empty line.
+// A field is either `KEY=value\n`, or `KEY\n` followed by the size in little-endian 64 bits, the binary value and `\n`.
+func readJournalEntry(r *bufio.Reader) (map[string]string, error) {
+	entry := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && len(entry) == 0 {
+				return nil, io.EOF
+			}
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(entry) == 0 {
+				continue
+			}
+			return entry, nil
+		}
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			entry[line[:i]] = line[i+1:]
+			continue
+		}
+
+		var size uint64
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		if size > maxJournalFieldSize {
+			return nil, fmt.Errorf("field %s of %d bytes exceeds %d bytes", line, size, maxJournalFieldSize)
+		}
+		value := make([]byte, size+1)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		entry[line] = string(value[:size])
+	}
+}
+
+// NewJournal returns new Journal that runs journalctl at the path,
+// and passes the entries whose SYSLOG_IDENTIFIER is one of the identifiers (e.g. postfix/*).
+// A trailing * of an identifier matches any suffix.
+func NewJournal(journalctlPath string, identifiers []string, logger log.Logger) *Journal {
+	return &Journal{
+		journalctlPath: journalctlPath,
+		identifiers:    identifiers,
+		logger:         logger,
+	}
+}
@@ -0,0 +1,127 @@
+package logs_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/logs"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeJournalctl writes a journalctl that records its arguments in dir/args and outputs the export file.
+func fakeJournalctl(t *testing.T, dir string, exportFile string) string {
+	t.Helper()
+	exportFile, err := filepath.Abs(exportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := path.Join(dir, "journalctl")
+	body := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\nexec cat %s\n", path.Join(dir, "args"), exportFile)
+	if err := ioutil.WriteFile(script, []byte(body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestJournal_Run(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	journal := logs.NewJournal(fakeJournalctl(t, dir, "testdata/journal.export"), []string{"postfix/*"}, log.NewNopLogger())
+
+	input := logs.NewInput([]logs.Source{journal}, &maillog.Parser{}, log.NewNopLogger())
+	recorder := &eventRecorder{}
+	input.SetHandlers([]logs.Handler{recorder})
+	err := journal.Run(context.Background(), func(line string) {
+		input.Handle(journal.Name(), line)
+	})
+	if err == nil || !strings.Contains(err.Error(), "journalctl exited") {
+		t.Errorf("expected journalctl exited, but actual is `%v`", err)
+	}
+
+	expected := []maillog.Event{
+		{
+			Time:       time.Date(2020, 4, 1, 11, 59, 59, 223456000, time.UTC),
+			Host:       "mail",
+			Service:    "postfix/smtpd",
+			SyslogName: "postfix",
+			Process:    "smtpd",
+			PID:        2345,
+			Payload:    "connect from unknown[192.0.2.1]",
+		},
+		{
+			Time:       time.Date(2020, 4, 1, 11, 59, 59, 323456000, time.UTC),
+			Host:       "mail",
+			Service:    "postfix/submission/smtpd",
+			SyslogName: "postfix/submission",
+			Process:    "smtpd",
+			PID:        2346,
+			QueueID:    "3F8C41A2B3",
+			Payload:    "client=unknown[192.0.2.1], sasl_method=PLAIN, sasl_username=\u200buser@example.com",
+		},
+		{
+			Time:       time.Date(2020, 4, 1, 11, 59, 59, 423456000, time.UTC),
+			Host:       "mail",
+			Service:    "postfix/qmgr",
+			SyslogName: "postfix",
+			Process:    "qmgr",
+			PID:        1234,
+			QueueID:    "3F8C41A2B3",
+			Payload:    "from=<sender@example.com>, size=1234, nrcpt=1 (queue active)",
+		},
+	}
+	if len(*recorder) != len(expected) {
+		t.Fatalf("expected %d events, but actual is `%v`", len(expected), *recorder)
+	}
+	for i, e := range *recorder {
+		if !e.Time.Equal(expected[i].Time) {
+			t.Errorf("expected `%v`, but actual is `%v`", expected[i].Time, e.Time)
+		}
+		e.Time = expected[i].Time
+		if *e != expected[i] {
+			t.Errorf("expected `%+v`, but actual is `%+v`", expected[i], *e)
+		}
+	}
+
+	args, _ := ioutil.ReadFile(path.Join(dir, "args"))
+	if strings.TrimSpace(string(args)) != "--output=export --follow --lines=0" {
+		t.Errorf("expected `%s`, but actual is `%s`", "--output=export --follow --lines=0", args)
+	}
+}
+
+func TestJournal_RunCursor(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	journalctl := fakeJournalctl(t, dir, "testdata/journal.export")
+
+	journal := logs.NewJournal(journalctl, []string{"postfix/qmgr"}, log.NewNopLogger())
+	var lines []string
+	journal.Run(context.Background(), func(line string) {
+		lines = append(lines, line)
+	})
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "<22>1 2020-04-01T11:59:59.423456Z mail postfix/qmgr 1234 - - 3F8C41A2B3: ") {
+		t.Errorf("expected the line of postfix/qmgr, but actual is `%v`", lines)
+	}
+
+	position, err := journal.SavePosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := logs.NewJournal(journalctl, []string{"postfix/*"}, log.NewNopLogger())
+	if err := restarted.RestorePosition(position); err != nil {
+		t.Fatal(err)
+	}
+	restarted.Run(context.Background(), func(line string) {})
+
+	cursor := "s=3f1d4e6b9c2a4f8e8d7c6b5a4f3e2d1c;i=1a2e;b=6c5cdf8e2a2a4a8e9f4a1a3f0c6bd2a1;m=8f172267;t=5a2396c6c43e0;x=329d4f2"
+	args, _ := ioutil.ReadFile(path.Join(dir, "args"))
+	if strings.TrimSpace(string(args)) != "--output=export --follow --after-cursor="+cursor {
+		t.Errorf("expected `%s`, but actual is `%s`", "--output=export --follow --after-cursor="+cursor, args)
+	}
+}
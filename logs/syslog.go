@@ -0,0 +1,385 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSyslogMessageSize bounds a received message.
+	maxSyslogMessageSize = 64 * 1024
+	// forwardQueueSize bounds the messages waiting to be forwarded. Messages beyond it are dropped.
+	forwardQueueSize = 1024
+	// forwardRetryInterval is the interval to reconnect to the forward target.
+	forwardRetryInterval = 5 * time.Second
+	// maxAcceptRetryInterval bounds the backoff of the temporary errors of accept (e.g. too many open files).
+	maxAcceptRetryInterval = time.Second
+)
+
+// parseSocketURL returns the network and the address of the socket at the URL.
+// The schemes are udp, tcp, unix (stream), unixgram, and postlog, which is a unixgram socket writable by all users.
+func parseSocketURL(s string) (string, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Port() == "" {
+			return "", "", fmt.Errorf("missing port in `%s`", s)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix", "unixgram", "postlog":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("missing path in `%s`", s)
+		}
+		return u.Scheme, u.Path, nil
+	default:
+		return "", "", fmt.Errorf("unsupported scheme `%s` in `%s`: must be one of udp, tcp, unix, unixgram, postlog", u.Scheme, s)
+	}
+}
+
+// SyslogReceiver receives syslog messages on a socket.
+// On stream sockets, octet-counted framing and newline framing (RFC 6587) are detected for each message.
+type SyslogReceiver struct {
+	name       string
+	packetConn net.PacketConn
+	listener   net.Listener
+	path       string
+	forwarder  *Forwarder
+	logger     log.Logger
+
+	mu        sync.Mutex
+	closeOnce sync.Once
+}
+
+// Name implements the Source interface.
+func (r *SyslogReceiver) Name() string {
+	return r.name
+}
+
+// Addr returns the address the receiver listens on.
+func (r *SyslogReceiver) Addr() net.Addr {
+	if r.packetConn != nil {
+		return r.packetConn.LocalAddr()
+	}
+	return r.listener.Addr()
+}
+
+// Run implements the Source interface.
+// It receives messages until ctx is done, and forwards them to the forwarder if any.
+// The socket is kept open when Run returns an error, so that Input can run it again,
+// and it is closed when the ctx of the first run is done.
+func (r *SyslogReceiver) Run(ctx context.Context, fn func(line string)) error {
+	r.closeOnce.Do(func() {
+		done := ctx.Done()
+		go func() {
+			<-done
+			r.close()
+		}()
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if r.forwarder != nil {
+		go r.forwarder.Run(ctx)
+	}
+	emit := func(line string) {
+		line = strings.TrimRight(line, "\r\n\x00")
+		if line == "" {
+			return
+		}
+		r.mu.Lock()
+		fn(line)
+		r.mu.Unlock()
+		if r.forwarder != nil {
+			r.forwarder.Forward(line)
+		}
+	}
+
+	if r.packetConn != nil {
+		return r.receive(ctx, emit)
+	}
+	return r.accept(ctx, emit)
+}
+
+// close closes the socket, and removes the file of the unix socket.
+func (r *SyslogReceiver) close() {
+	if r.packetConn != nil {
+		r.packetConn.Close()
+	} else {
+		r.listener.Close()
+	}
+	if r.path != "" {
+		os.Remove(r.path)
+	}
+}
+
+// receive reads a message from each datagram.
+func (r *SyslogReceiver) receive(ctx context.Context, emit func(line string)) error {
+	buf := make([]byte, maxSyslogMessageSize)
+	for {
+		n, _, err := r.packetConn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		emit(string(buf[:n]))
+	}
+}
+
+// accept reads the messages from each connection until ctx is done.
+// Temporary errors are retried with a backoff, like net/http.
+func (r *SyslogReceiver) accept(ctx context.Context, emit func(line string)) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	var delay time.Duration
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > maxAcceptRetryInterval {
+					delay = maxAcceptRetryInterval
+				}
+				level.Warn(r.logger).Log("msg", "Failed to accept syslog connection, retrying", "source", r.name, "err", err, "retry_in", delay)
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(delay):
+				}
+				continue
+			}
+			return err
+		}
+		delay = 0
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.serve(ctx, conn, emit)
+		}()
+	}
+}
+
+// serve reads the messages from the connection until it is closed or ctx is done.
+func (r *SyslogReceiver) serve(ctx context.Context, conn net.Conn, emit func(line string)) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	reader := bufio.NewReaderSize(conn, maxSyslogMessageSize)
+	for {
+		message, err := readFrame(reader)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				level.Warn(r.logger).Log("msg", "Closing syslog connection", "source", r.name, "remote", conn.RemoteAddr(), "err", err)
+			}
+			return
+		}
+		emit(message)
+	}
+}
+
+// readFrame reads a message in octet-counted framing (`11 <22>message`) or newline framing (`<22>message\n`).
+// A message starting with digits and a space is taken as octet-counted.
+func readFrame(r *bufio.Reader) (string, error) {
+	for i := 0; i < 10; i++ {
+		b, err := r.Peek(i + 1)
+		if err != nil {
+			if i == 0 {
+				return "", err
+			}
+			break
+		}
+		c := b[i]
+		if c == ' ' && i > 0 {
+			n, _ := strconv.Atoi(string(b[:i]))
+			if n > maxSyslogMessageSize {
+				return "", fmt.Errorf("message length %d exceeds %d bytes", n, maxSyslogMessageSize)
+			}
+			if _, err := r.Discard(i + 1); err != nil {
+				return "", err
+			}
+			message := make([]byte, n)
+			if _, err := io.ReadFull(r, message); err != nil {
+				return "", err
+			}
+			return string(message), nil
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+	}
+
+	message, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("message exceeds %d bytes", maxSyslogMessageSize)
+	}
+	if err == io.EOF && len(message) > 0 {
+		return string(message), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(message), nil
+}
+
+// listenUnix removes the stale socket file at the path, and calls listen.
+func listenUnix(path string, listen func() error) error {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return listen()
+}
+
+// NewSyslogReceiver returns new SyslogReceiver listening on the socket at the URL (e.g. udp://0.0.0.0:514).
+// A postlog URL (e.g. postlog:///var/spool/postfix/public/postlog) stands in for the postlog socket of Postfix 3.4 or later.
+// The forwarder may be nil.
+func NewSyslogReceiver(listen string, forwarder *Forwarder, logger log.Logger) (*SyslogReceiver, error) {
+	network, address, err := parseSocketURL(listen)
+	if err != nil {
+		return nil, err
+	}
+	r := &SyslogReceiver{
+		name:      "syslog:" + listen,
+		forwarder: forwarder,
+		logger:    logger,
+	}
+	switch network {
+	case "udp":
+		r.packetConn, err = net.ListenPacket(network, address)
+	case "tcp":
+		r.listener, err = net.Listen(network, address)
+	case "unix":
+		r.path = address
+		err = listenUnix(address, func() error {
+			r.listener, err = net.Listen(network, address)
+			return err
+		})
+	case "unixgram", "postlog":
+		r.path = address
+		err = listenUnix(address, func() error {
+			r.packetConn, err = net.ListenPacket("unixgram", address)
+			return err
+		})
+		if err == nil && network == "postlog" {
+			r.name = "postlog:" + address
+			// Postfix programs run as various users write to the postlog socket.
+			if err = os.Chmod(address, 0666); err != nil {
+				r.packetConn.Close()
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Forwarder forwards messages to a syslog target.
+// Messages are sent in the background, and dropped while the target is unavailable.
+type Forwarder struct {
+	network string
+	address string
+	queue   chan string
+	logger  log.Logger
+}
+
+// Forward queues the message to be forwarded.
+func (f *Forwarder) Forward(message string) {
+	select {
+	case f.queue <- message:
+	default:
+		level.Debug(f.logger).Log("msg", "Dropped a message to forward", "target", f.address)
+	}
+}
+
+// Run sends the queued messages until ctx is done.
+// Messages are sent in a datagram each, or in octet-counted framing on stream sockets.
+func (f *Forwarder) Run(ctx context.Context) {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	var retryAt time.Time
+	for {
+		var message string
+		select {
+		case <-ctx.Done():
+			return
+		case message = <-f.queue:
+		}
+
+		if conn == nil {
+			if time.Now().Before(retryAt) {
+				continue
+			}
+			var err error
+			dialer := net.Dialer{Timeout: forwardRetryInterval}
+			conn, err = dialer.DialContext(ctx, f.network, f.address)
+			if err != nil {
+				level.Warn(f.logger).Log("msg", "Failed to connect to the forward target", "target", f.address, "err", err)
+				retryAt = time.Now().Add(forwardRetryInterval)
+				continue
+			}
+		}
+
+		b := []byte(message)
+		if f.network == "tcp" || f.network == "unix" {
+			b = []byte(strconv.Itoa(len(message)) + " " + message)
+		}
+		if _, err := conn.Write(b); err != nil {
+			level.Warn(f.logger).Log("msg", "Failed to forward a message", "target", f.address, "err", err)
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// NewForwarder returns new Forwarder to the syslog target at the URL (e.g. udp://loghost:514).
+func NewForwarder(target string, logger log.Logger) (*Forwarder, error) {
+	network, address, err := parseSocketURL(target)
+	if err != nil {
+		return nil, err
+	}
+	if network == "postlog" {
+		return nil, errors.New("cannot forward to a postlog socket")
+	}
+	return &Forwarder{
+		network: network,
+		address: address,
+		queue:   make(chan string, forwardQueueSize),
+		logger:  logger,
+	}, nil
+}
@@ -0,0 +1,186 @@
+package logs_test
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/logs"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func dial(t *testing.T, network string, address string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func write(t *testing.T, conn net.Conn, s string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyslogReceiver_RunUDP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receiver, err := logs.NewSyslogReceiver("udp://127.0.0.1:0", nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := runSource(ctx, receiver)
+
+	conn := dial(t, "udp", receiver.Addr().String())
+	defer conn.Close()
+	write(t, conn, "<22>Apr  1 12:00:00 mail postfix/smtpd[1]: line 1\n")
+	write(t, conn, "<22>Apr  1 12:00:00 mail postfix/smtpd[1]: line 2")
+	expectLines(t, lines,
+		"<22>Apr  1 12:00:00 mail postfix/smtpd[1]: line 1",
+		"<22>Apr  1 12:00:00 mail postfix/smtpd[1]: line 2")
+}
+
+func TestSyslogReceiver_RunTCP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receiver, err := logs.NewSyslogReceiver("tcp://127.0.0.1:0", nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := runSource(ctx, receiver)
+
+	conn := dial(t, "tcp", receiver.Addr().String())
+	defer conn.Close()
+	// octet-counted framing, newline framing, and a line starting with digits
+	write(t, conn, "10 <22>line\n1")
+	write(t, conn, "<22>line 3\n2020-04-01T12:00:00Z line 4\n")
+	expectLines(t, lines, "<22>line\n1", "<22>line 3", "2020-04-01T12:00:00Z line 4")
+}
+
+func TestSyslogReceiver_RunPostlog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	socket := path.Join(dir, "postlog")
+
+	receiver, err := logs.NewSyslogReceiver("postlog://"+socket, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receiver.Name() != "postlog:"+socket {
+		t.Errorf("expected `%s`, but actual is `%s`", "postlog:"+socket, receiver.Name())
+	}
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0666 {
+		t.Errorf("expected `%v`, but actual is `%v`", os.FileMode(0666), info.Mode().Perm())
+	}
+	lines := runSource(ctx, receiver)
+
+	conn := dial(t, "unixgram", socket)
+	defer conn.Close()
+	write(t, conn, "Apr  1 12:00:00.123456 mail postfix/smtpd[1]: line 1")
+	expectLines(t, lines, "Apr  1 12:00:00.123456 mail postfix/smtpd[1]: line 1")
+}
+
+func TestSyslogReceiver_RunUnix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	socket := path.Join(dir, "syslog")
+
+	receiver, err := logs.NewSyslogReceiver("unix://"+socket, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := runSource(ctx, receiver)
+
+	conn := dial(t, "unix", socket)
+	defer conn.Close()
+	write(t, conn, "<22>Apr  1 12:00:00 mail postfix/smtpd[1]: line 1\n")
+	expectLines(t, lines, "<22>Apr  1 12:00:00 mail postfix/smtpd[1]: line 1")
+
+	cancel()
+	for i := 0; ; i++ {
+		if _, err := os.Stat(socket); os.IsNotExist(err) {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("expected `%s` to be removed on stop, but it exists", socket)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSyslogReceiver_RunForward(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	target, err := logs.NewSyslogReceiver("tcp://127.0.0.1:0", nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarded := runSource(ctx, target)
+
+	forwarder, err := logs.NewForwarder("tcp://"+target.Addr().String(), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := logs.NewSyslogReceiver("udp://127.0.0.1:0", forwarder, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := runSource(ctx, receiver)
+
+	conn := dial(t, "udp", receiver.Addr().String())
+	defer conn.Close()
+	write(t, conn, "<22>line\n1")
+	expectLines(t, lines, "<22>line\n1")
+	expectLines(t, forwarded, "<22>line\n1")
+}
+
+func TestNewSyslogReceiver_Invalid(t *testing.T) {
+	for _, listen := range []string{"udp://127.0.0.1", "unixgram://", "http://127.0.0.1:80"} {
+		if _, err := logs.NewSyslogReceiver(listen, nil, log.NewNopLogger()); err == nil {
+			t.Errorf("expected an error for `%s`, but actual is nil", listen)
+		}
+	}
+}
+
+func TestSyslogReceiver_RunStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	receiver, err := logs.NewSyslogReceiver("tcp://127.0.0.1:0", nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- receiver.Run(ctx, func(line string) {})
+	}()
+	conn := dial(t, "tcp", receiver.Addr().String())
+	defer conn.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected to stop, but timed out")
+	}
+}
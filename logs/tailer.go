@@ -0,0 +1,335 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Tailer follows a log file like `tail -F`.
+// A file replaced by rename-based rotation is read to the end before the new file is opened,
+// and a file truncated by copytruncate-based rotation is read again from the start.
+// It implements the Checkpointer interface to resume from the position of the last line after restart.
+type Tailer struct {
+	path         string
+	pollInterval time.Duration
+	fromStart    bool
+	logger       log.Logger
+
+	file    *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial []byte
+
+	// started is true once the file was looked for, so that a Tailer run again does not skip the lines written meanwhile.
+	started bool
+
+	mu       sync.Mutex
+	position *Position
+	restored *Position
+}
+
+// Name implements the Source interface.
+func (t *Tailer) Name() string {
+	return "file:" + t.path
+}
+
+// open opens the file at the path, and seeks to the end if end is true.
+func (t *Tailer) open(end bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	offset := int64(0)
+	if end {
+		offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return t.use(f, offset)
+}
+
+// use starts reading f at the offset.
+func (t *Tailer) use(f *os.File, offset int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	hash, err := lastLineHash(f, offset)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	inode, device := fileID(info)
+
+	t.file = f
+	t.reader = bufio.NewReader(f)
+	t.offset = offset
+	t.partial = nil
+	t.mu.Lock()
+	t.position = &Position{Inode: inode, Device: device, Offset: offset, LastLineHash: hash}
+	t.mu.Unlock()
+	return nil
+}
+
+// resume continues from the position restored from the checkpoint.
+// When the file was rotated meanwhile, the rest of the rotated file (renamed, or copied by copytruncate) is read first,
+// and the file at the path is opened from the start afterwards.
+func (t *Tailer) resume(p *Position, fn func(line string)) error {
+	candidates, err := filepath.Glob(t.path + "?*")
+	if err != nil {
+		return err
+	}
+	candidates = append([]string{t.path}, candidates...)
+
+	// the file of the checkpoint, renamed or not
+	for _, candidate := range candidates {
+		f, ok := openAt(candidate, p, true)
+		if !ok {
+			continue
+		}
+		if candidate == t.path {
+			level.Info(t.logger).Log("msg", "Resuming log file from the checkpoint", "path", t.path, "offset", p.Offset)
+			return t.use(f, p.Offset)
+		}
+		level.Info(t.logger).Log("msg", "Log file was rotated since the checkpoint, reading the rotated file first", "path", candidate, "offset", p.Offset)
+		return t.readRotated(f, p.Offset, fn)
+	}
+
+	// the copy of the file by copytruncate
+	if p.LastLineHash != "" {
+		for _, candidate := range candidates[1:] {
+			f, ok := openAt(candidate, p, false)
+			if !ok {
+				continue
+			}
+			level.Info(t.logger).Log("msg", "Log file was truncated since the checkpoint, reading the copy first", "path", candidate, "offset", p.Offset)
+			return t.readRotated(f, p.Offset, fn)
+		}
+	}
+
+	level.Warn(t.logger).Log("msg", "Position of the checkpoint is not found, reading from the start", "path", t.path)
+	return nil
+}
+
+// readRotated reads f from the offset to the end.
+func (t *Tailer) readRotated(f *os.File, offset int64, fn func(line string)) error {
+	defer t.close()
+	if err := t.use(f, offset); err != nil {
+		return err
+	}
+	if err := t.readLines(fn); err != nil {
+		return err
+	}
+	if len(t.partial) > 0 {
+		fn(string(t.partial))
+	}
+	return nil
+}
+
+// openAt opens the file seeked to the offset of p, if the line before the offset matches p.
+// If sameFile is true, the file also has to have the inode and the device of p.
+func openAt(filename string, p *Position, sameFile bool) (*os.File, bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, false
+	}
+	info, err := f.Stat()
+	if err != nil || info.Size() < p.Offset {
+		f.Close()
+		return nil, false
+	}
+	if inode, device := fileID(info); sameFile && (inode != p.Inode || device != p.Device) {
+		f.Close()
+		return nil, false
+	}
+	if hash, err := lastLineHash(f, p.Offset); err != nil || hash != p.LastLineHash {
+		f.Close()
+		return nil, false
+	}
+	if _, err := f.Seek(p.Offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, false
+	}
+	return f, true
+}
+
+// SavePosition implements the Checkpointer interface.
+func (t *Tailer) SavePosition() (json.RawMessage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.position
+	if p == nil {
+		p = t.restored
+	}
+	if p == nil {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// RestorePosition implements the Checkpointer interface.
+func (t *Tailer) RestorePosition(b json.RawMessage) error {
+	p := &Position{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.restored = p
+	return nil
+}
+
+func (t *Tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+	}
+	t.file = nil
+	t.reader = nil
+	t.partial = nil
+}
+
+// readLines passes the complete lines until the end of the file to fn.
+// An incomplete last line is kept until the rest is written.
+func (t *Tailer) readLines(fn func(line string)) error {
+	for {
+		b, err := t.reader.ReadBytes('\n')
+		if len(b) > 0 {
+			t.partial = append(t.partial, b...)
+			if b[len(b)-1] == '\n' {
+				line := t.partial[:len(t.partial)-1]
+				t.offset += int64(len(t.partial))
+				t.partial = nil
+				fn(string(line))
+
+				t.mu.Lock()
+				t.position.Offset = t.offset
+				t.position.LastLineHash = hashLine(line)
+				t.mu.Unlock()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkRotation reopens the file when it was rotated, after reading the rest of the rotated file.
+func (t *Tailer) checkRotation(fn func(line string)) error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		// the rotated file is renamed, and the new file is not created yet.
+		return nil
+	}
+	current, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !os.SameFile(info, current) {
+		if err := t.readLines(fn); err != nil {
+			return err
+		}
+		if len(t.partial) > 0 {
+			fn(string(t.partial))
+		}
+		level.Info(t.logger).Log("msg", "Log file was rotated, reopening", "path", t.path)
+		t.close()
+		return t.open(false)
+	}
+	if info.Size() < t.offset+int64(len(t.partial)) {
+		level.Info(t.logger).Log("msg", "Log file was truncated, reading from the start", "path", t.path)
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.reader.Reset(t.file)
+		t.offset = 0
+		t.partial = nil
+		t.mu.Lock()
+		t.position.Offset = 0
+		t.position.LastLineHash = ""
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+// Run implements the Source interface.
+// It resumes from the position of the last line if any, or the restored position,
+// waits for the file to be created, and follows it until ctx is done.
+// When it is run again (e.g. restarted by Input after a failure), it continues from the last line read by the previous run.
+func (t *Tailer) Run(ctx context.Context, fn func(line string)) error {
+	defer t.close()
+
+	ticker := time.NewTicker(t.pollInterval)
+	defer ticker.Stop()
+
+	t.mu.Lock()
+	var last *Position
+	if t.position != nil {
+		p := *t.position
+		last = &p
+	} else if t.restored != nil {
+		last = t.restored
+	}
+	t.mu.Unlock()
+	if last != nil {
+		t.started = true
+		if err := t.resume(last, fn); err != nil {
+			return err
+		}
+	}
+	for {
+		if t.file == nil {
+			if err := t.open(!t.started && !t.fromStart); err != nil {
+				if !os.IsNotExist(err) {
+					return err
+				}
+				level.Debug(t.logger).Log("msg", "Waiting for log file", "path", t.path)
+			} else {
+				level.Info(t.logger).Log("msg", "Following log file", "path", t.path, "offset", t.offset)
+			}
+			t.started = true
+		}
+		if t.file != nil {
+			if err := t.readLines(fn); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if t.file != nil {
+			if err := t.checkRotation(fn); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// NewTailer returns new Tailer that checks the file for new lines and rotation on the poll interval.
+// Unless fromStart is true, lines already in the file when it is first opened are skipped.
+func NewTailer(path string, pollInterval time.Duration, fromStart bool, logger log.Logger) *Tailer {
+	return &Tailer{
+		path:         path,
+		pollInterval: pollInterval,
+		fromStart:    fromStart,
+		logger:       logger,
+	}
+}
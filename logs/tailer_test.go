@@ -0,0 +1,111 @@
+package logs_test
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/logs"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// runSource runs the source in the background, and returns the channel of its lines.
+func runSource(ctx context.Context, source logs.Source) chan string {
+	lines := make(chan string, 100)
+	go source.Run(ctx, func(line string) {
+		lines <- line
+	})
+	return lines
+}
+
+// expectLines waits for the lines in order.
+func expectLines(t *testing.T, lines chan string, expected ...string) {
+	t.Helper()
+	for _, e := range expected {
+		select {
+		case line := <-lines:
+			if line != e {
+				t.Fatalf("expected `%s`, but actual is `%s`", e, line)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expected `%s`, but timed out", e)
+		}
+	}
+}
+
+func appendFile(t *testing.T, filename string, s string) {
+	t.Helper()
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailer_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "skipped\n")
+
+	lines := runSource(ctx, logs.NewTailer(filename, 10*time.Millisecond, false, log.NewNopLogger()))
+	time.Sleep(50 * time.Millisecond)
+
+	appendFile(t, filename, "line 1\nline")
+	expectLines(t, lines, "line 1")
+	appendFile(t, filename, " 2\n")
+	expectLines(t, lines, "line 2")
+}
+
+func TestTailer_RunRename(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+
+	lines := runSource(ctx, logs.NewTailer(filename, 10*time.Millisecond, false, log.NewNopLogger()))
+	time.Sleep(50 * time.Millisecond)
+
+	// the file created after the start is read from the beginning
+	appendFile(t, filename, "line 1\n")
+	expectLines(t, lines, "line 1")
+
+	appendFile(t, filename, "line 2\n")
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, filename+".1", "line 3\n")
+	appendFile(t, filename, "line 4\n")
+	expectLines(t, lines, "line 2", "line 3", "line 4")
+}
+
+func TestTailer_RunCopyTruncate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "mail.log")
+	appendFile(t, filename, "")
+
+	lines := runSource(ctx, logs.NewTailer(filename, 10*time.Millisecond, true, log.NewNopLogger()))
+	appendFile(t, filename, "line 1\nline 2\n")
+	expectLines(t, lines, "line 1", "line 2")
+
+	if err := os.Truncate(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, filename, "line 3\n")
+	expectLines(t, lines, "line 3")
+}
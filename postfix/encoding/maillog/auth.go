@@ -0,0 +1,107 @@
+package maillog
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	spfRegex           = regexp.MustCompile(`\bReceived-SPF: (\w+)\b(.*)$`)
+	dkimDomainRegex    = regexp.MustCompile(`\bd=([^\s,)]+)`)
+	dkimSignatureRegex = regexp.MustCompile(`^DKIM-Signature field added \(s=[^,]*, d=([^)]+)\)`)
+	dmarcRegex         = regexp.MustCompile(`^(\S+\.\S+) (none|pass|fail|bestguesspass|temperror|permerror)\b(.*)$`)
+	dmarcPolicyRegex   = regexp.MustCompile(`\b(?:policy|p)=(\w+)`)
+)
+
+// dkimResults are the results of the verification messages of opendkim.
+var dkimResults = []struct {
+	message string
+	result  string
+}{
+	{"DKIM verification successful", "pass"},
+	{"bad signature data", "fail"},
+	{"no signature data", "none"},
+	{"key retrieval failed", "temperror"},
+}
+
+// AuthResult is a result of SPF, DKIM or DMARC of an inbound message.
+type AuthResult struct {
+	// Method is spf, dkim or dmarc.
+	Method string
+	// Result is the result in lower case (e.g. pass, fail, softfail or none).
+	Result string
+	// Domain is the domain in lower case that the result is for, or empty if the line has none.
+	Domain string
+	// Policy is the DMARC policy of the domain applied to the message (e.g. reject), or empty.
+	Policy string
+}
+
+// ParseSPF returns the SPF result of policyd-spf, or false if the payload is not a result
+// (e.g. `prepend Received-SPF: Pass (mailfrom) identity=mailfrom; client-ip=192.0.2.1; helo=mail.example.com; envelope-from=sender@example.com; receiver=<UNKNOWN>`).
+// The domain is the one of the identity, which is the envelope sender or the HELO name.
+func ParseSPF(payload string) (*AuthResult, bool) {
+	match := spfRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	attributes := make(map[string]string)
+	for _, part := range strings.Split(match[2], ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		// The first attribute follows the comment of the result (e.g. `(mailfrom) identity=mailfrom`).
+		kv := fields[len(fields)-1]
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			attributes[kv[:i]] = kv[i+1:]
+		}
+	}
+	r := &AuthResult{Method: "spf", Result: strings.ToLower(match[1])}
+	if attributes["identity"] == "helo" {
+		r.Domain = strings.ToLower(attributes["helo"])
+	} else if i := strings.LastIndexByte(attributes["envelope-from"], '@'); i >= 0 {
+		r.Domain = strings.ToLower(strings.Trim(attributes["envelope-from"][i+1:], "<>"))
+	}
+	return r, true
+}
+
+// ParseDKIM returns the DKIM verification result of opendkim, or false if the payload is not a result
+// (e.g. `DKIM verification successful` or `bad signature data`).
+// opendkim logs the signing domain only in some messages, so that the domain is often empty.
+func ParseDKIM(payload string) (*AuthResult, bool) {
+	for _, r := range dkimResults {
+		if !strings.Contains(payload, r.message) {
+			continue
+		}
+		result := &AuthResult{Method: "dkim", Result: r.result}
+		if match := dkimDomainRegex.FindStringSubmatch(payload); match != nil {
+			result.Domain = strings.ToLower(match[1])
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// ParseDKIMSignature returns the signing domain of opendkim, or false if the payload is not a signing
+// (e.g. example.com of `DKIM-Signature field added (s=mail, d=example.com)`).
+func ParseDKIMSignature(payload string) (string, bool) {
+	match := dkimSignatureRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return "", false
+	}
+	return strings.ToLower(match[1]), true
+}
+
+// ParseDMARC returns the DMARC result of opendmarc, or false if the payload is not a result
+// (e.g. `example.com pass` or `example.com fail (policy=reject)`).
+func ParseDMARC(payload string) (*AuthResult, bool) {
+	match := dmarcRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	r := &AuthResult{Method: "dmarc", Result: match[2], Domain: strings.ToLower(match[1])}
+	if match := dmarcPolicyRegex.FindStringSubmatch(match[3]); match != nil {
+		r.Policy = strings.ToLower(match[1])
+	}
+	return r, true
+}
@@ -0,0 +1,87 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParseAuthResult(t *testing.T) {
+	cases := []struct {
+		parse    func(string) (*maillog.AuthResult, bool)
+		payload  string
+		expected *maillog.AuthResult
+	}{
+		{
+			maillog.ParseSPF,
+			"prepend Received-SPF: Pass (mailfrom) identity=mailfrom; client-ip=192.0.2.1; helo=mail.example.com; envelope-from=sender@Example.COM; receiver=<UNKNOWN>",
+			&maillog.AuthResult{Method: "spf", Result: "pass", Domain: "example.com"},
+		},
+		{
+			maillog.ParseSPF,
+			"prepend Received-SPF: Softfail (domain owner discourages use of this host) identity=mailfrom; client-ip=192.0.2.1; helo=mail.example.net; envelope-from=sender@example.org; receiver=user@example.com",
+			&maillog.AuthResult{Method: "spf", Result: "softfail", Domain: "example.org"},
+		},
+		{
+			maillog.ParseSPF,
+			"prepend Received-SPF: None (no SPF record) identity=helo; client-ip=192.0.2.1; helo=mail.example.net; envelope-from=<>; receiver=<UNKNOWN>",
+			&maillog.AuthResult{Method: "spf", Result: "none", Domain: "mail.example.net"},
+		},
+		{
+			maillog.ParseSPF,
+			"Starting",
+			nil,
+		},
+		{
+			maillog.ParseDKIM,
+			"DKIM verification successful",
+			&maillog.AuthResult{Method: "dkim", Result: "pass"},
+		},
+		{
+			maillog.ParseDKIM,
+			"bad signature data",
+			&maillog.AuthResult{Method: "dkim", Result: "fail"},
+		},
+		{
+			maillog.ParseDKIM,
+			"key retrieval failed (s=mail, d=example.com): 'mail._domainkey.example.com' query timed out",
+			&maillog.AuthResult{Method: "dkim", Result: "temperror", Domain: "example.com"},
+		},
+		{
+			maillog.ParseDKIM,
+			"mail.example.com [192.0.2.1] not internal",
+			nil,
+		},
+		{
+			maillog.ParseDMARC,
+			"example.com pass",
+			&maillog.AuthResult{Method: "dmarc", Result: "pass", Domain: "example.com"},
+		},
+		{
+			maillog.ParseDMARC,
+			"Example.org fail (policy=reject)",
+			&maillog.AuthResult{Method: "dmarc", Result: "fail", Domain: "example.org", Policy: "reject"},
+		},
+		{
+			maillog.ParseDMARC,
+			"SPF(mailfrom): sender@example.com pass",
+			nil,
+		},
+	}
+	for _, c := range cases {
+		actual, ok := c.parse(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
+
+func TestParseDKIMSignature(t *testing.T) {
+	domain, ok := maillog.ParseDKIMSignature("DKIM-Signature field added (s=mail, d=Example.com)")
+	if !ok || domain != "example.com" {
+		t.Errorf("expected `example.com`, but actual is `%s`", domain)
+	}
+	if _, ok := maillog.ParseDKIMSignature("DKIM verification successful"); ok {
+		t.Error("expected a verification is not a signing, but actual is")
+	}
+}
@@ -0,0 +1,67 @@
+package maillog
+
+import (
+	"regexp"
+	"strings"
+)
+
+var checkActionRegex = regexp.MustCompile(`^(reject|warning|hold|discard|redirect|replace|filter|prepend|info): (header|body|mime-header|nested-header) (.*) from (\S+); (from=<.*)$`)
+
+// CheckAction is an action of header_checks, body_checks, mime_header_checks or nested_header_checks of cleanup
+// (e.g. `reject: header Subject: buy now from unknown[192.0.2.1]; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>: 5.7.1 Spam`).
+type CheckAction struct {
+	// Action is the action of the rule in lower case (e.g. reject, warning, hold or redirect).
+	Action string
+	// Class is header, body, mime-header or nested-header.
+	Class string
+	// Content is the header or the body line that the rule matched, truncated by cleanup to 200 characters.
+	Content string
+	Client  string
+	// Text is the optional text of the action in the rule (e.g. the reply text of reject, or the destination of redirect), or empty.
+	Text string
+	// Attributes are from, to, proto and helo after the client.
+	Attributes map[string]string
+}
+
+// ParseCheckAction returns the action of the checks of cleanup, or false if the payload is not an action.
+func ParseCheckAction(payload string) (*CheckAction, bool) {
+	match := checkActionRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	a := &CheckAction{
+		Action:     match[1],
+		Class:      match[2],
+		Content:    match[3],
+		Client:     match[4],
+		Attributes: make(map[string]string),
+	}
+	rest := match[5]
+	// The attributes are followed by `: <text>` if the rule has the text.
+	for rest != "" {
+		i := strings.IndexByte(rest, '=')
+		if i <= 0 || strings.ContainsAny(rest[:i], " :") {
+			break
+		}
+		key := rest[:i]
+		rest = rest[i+1:]
+		var value string
+		if strings.HasPrefix(rest, "<") {
+			j := strings.IndexByte(rest, '>')
+			if j < 0 {
+				j = len(rest) - 1
+			}
+			value, rest = rest[1:j], rest[j+1:]
+		} else {
+			j := strings.IndexAny(rest, " :")
+			if j < 0 {
+				j = len(rest)
+			}
+			value, rest = rest[:j], rest[j:]
+		}
+		a.Attributes[key] = value
+		rest = strings.TrimPrefix(rest, " ")
+	}
+	a.Text = strings.TrimPrefix(rest, ": ")
+	return a, true
+}
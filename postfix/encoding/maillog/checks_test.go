@@ -0,0 +1,57 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParseCheckAction(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.CheckAction
+	}{
+		{
+			"reject: header Subject: buy now from unknown[192.0.2.1]; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>: 5.7.1 Spam not allowed",
+			&maillog.CheckAction{
+				Action:     "reject",
+				Class:      "header",
+				Content:    "Subject: buy now",
+				Client:     "unknown[192.0.2.1]",
+				Text:       "5.7.1 Spam not allowed",
+				Attributes: map[string]string{"from": "sender@example.com", "to": "user@example.com", "proto": "ESMTP", "helo": "client"},
+			},
+		},
+		{
+			"hold: header Received: from mail.example.com (mail.example.com [192.0.2.1]) by mx from local; from=<sender@example.com> to=<user@example.com>",
+			&maillog.CheckAction{
+				Action:     "hold",
+				Class:      "header",
+				Content:    "Received: from mail.example.com (mail.example.com [192.0.2.1]) by mx",
+				Client:     "local",
+				Attributes: map[string]string{"from": "sender@example.com", "to": "user@example.com"},
+			},
+		},
+		{
+			"redirect: body click here from unknown[192.0.2.1]; from=<> to=<user@example.com> proto=SMTP helo=<[IPv6:2001:db8::1]>: spam@example.com",
+			&maillog.CheckAction{
+				Action:     "redirect",
+				Class:      "body",
+				Content:    "click here",
+				Client:     "unknown[192.0.2.1]",
+				Text:       "spam@example.com",
+				Attributes: map[string]string{"from": "", "to": "user@example.com", "proto": "SMTP", "helo": "[IPv6:2001:db8::1]"},
+			},
+		},
+		{
+			"message-id=<1@example.com>",
+			nil,
+		},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseCheckAction(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
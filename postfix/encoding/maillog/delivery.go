@@ -0,0 +1,105 @@
+package maillog
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Transport returns the master.cf service of the process:
+// the last part of a syslog_name with a service (e.g. relay of postfix/relay/smtp), or the process name.
+func (e *Event) Transport() string {
+	if i := strings.LastIndex(e.SyslogName, "/"); i >= 0 {
+		return e.SyslogName[i+1:]
+	}
+	return e.Process
+}
+
+// ParseAttributes returns the attributes of a payload such as `to=<user@example.com>, relay=none, delay=0.1`.
+// Parts without `=` are ignored.
+func ParseAttributes(s string) map[string]string {
+	attributes := make(map[string]string)
+	for _, part := range strings.Split(s, ", ") {
+		i := strings.IndexByte(part, '=')
+		if i <= 0 {
+			continue
+		}
+		attributes[part[:i]] = part[i+1:]
+	}
+	return attributes
+}
+
+// Delivery is the status line of a delivery attempt of a recipient, logged by the delivery agents
+// (e.g. `to=<user@example.com>, relay=mx.example.com[192.0.2.1]:25, delay=1.2, delays=0.1/0/0.5/0.6, dsn=2.0.0, status=sent (250 OK)`),
+// or by qmgr for expired messages.
+type Delivery struct {
+	To     string
+	OrigTo string
+	// Relay is the nexthop (e.g. mx.example.com[192.0.2.1]:25, local or none).
+	Relay string
+	// Delay is the time from the arrival to the delivery attempt, or -1 if it is not logged.
+	Delay float64
+	// Delays is the time before qmgr, in qmgr, in connection setup and in transmission, or nil if it is not logged.
+	Delays []float64
+	DSN    string
+	// Status is one of sent, deferred, bounced, expired, or another status of Postfix.
+	Status string
+	// Response is the text in parentheses after the status.
+	Response string
+}
+
+// DSNClass returns the class of the DSN (e.g. 4 of 4.4.1), or empty if there is no DSN.
+func (d *Delivery) DSNClass() string {
+	if i := strings.IndexByte(d.DSN, '.'); i > 0 {
+		return d.DSN[:i]
+	}
+	return ""
+}
+
+// RelayHost returns the host of the relay without the address and port (e.g. mx.example.com).
+func (d *Delivery) RelayHost() string {
+	return hostOf(d.Relay)
+}
+
+// ParseDelivery returns the delivery status of the payload, or false if the payload has no status.
+func ParseDelivery(payload string) (*Delivery, bool) {
+	i := strings.Index(payload, "status=")
+	if i < 0 || (i > 0 && !strings.HasSuffix(payload[:i], ", ")) {
+		return nil, false
+	}
+	attributes := ParseAttributes(payload[:i])
+	status := payload[i+len("status="):]
+	var response string
+	if j := strings.IndexAny(status, " ,"); j >= 0 {
+		response = strings.TrimLeft(status[j:], " ,")
+		status = status[:j]
+	}
+	if strings.HasPrefix(response, "(") && strings.HasSuffix(response, ")") {
+		response = response[1 : len(response)-1]
+	}
+
+	d := &Delivery{
+		To:       strings.Trim(attributes["to"], "<>"),
+		OrigTo:   strings.Trim(attributes["orig_to"], "<>"),
+		Relay:    attributes["relay"],
+		Delay:    -1,
+		DSN:      attributes["dsn"],
+		Status:   status,
+		Response: response,
+	}
+	if delay, err := strconv.ParseFloat(attributes["delay"], 64); err == nil {
+		d.Delay = delay
+	}
+	if parts := strings.Split(attributes["delays"], "/"); len(parts) == 4 {
+		delays := make([]float64, 4)
+		for j, part := range parts {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				delays = nil
+				break
+			}
+			delays[j] = v
+		}
+		d.Delays = delays
+	}
+	return d, true
+}
@@ -0,0 +1,73 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParseDelivery(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.Delivery
+	}{
+		{
+			payload: "to=<user@example.com>, relay=mx.example.com[192.0.2.1]:25, delay=1.2, delays=0.1/0/0.5/0.6, dsn=2.0.0, status=sent (250 2.0.0 OK)",
+			expected: &maillog.Delivery{
+				To: "user@example.com", Relay: "mx.example.com[192.0.2.1]:25", Delay: 1.2, Delays: []float64{0.1, 0, 0.5, 0.6},
+				DSN: "2.0.0", Status: "sent", Response: "250 2.0.0 OK",
+			},
+		},
+		{
+			payload: "to=<user@example.com>, orig_to=<alias@example.com>, relay=local, delay=0.01, delays=0/0/0/0.01, dsn=5.1.1, status=bounced (unknown user: \"user\")",
+			expected: &maillog.Delivery{
+				To: "user@example.com", OrigTo: "alias@example.com", Relay: "local", Delay: 0.01, Delays: []float64{0, 0, 0, 0.01},
+				DSN: "5.1.1", Status: "bounced", Response: "unknown user: \"user\"",
+			},
+		},
+		{
+			payload: "from=<sender@example.com>, status=expired, returned to sender",
+			expected: &maillog.Delivery{
+				Delay: -1, Status: "expired", Response: "returned to sender",
+			},
+		},
+		{payload: "from=<sender@example.com>, size=1234, nrcpt=1 (queue active)"},
+		{payload: "client=unknown[192.0.2.1], sasl_username=status=sent"},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseDelivery(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
+
+func TestDelivery_RelayHost(t *testing.T) {
+	for relay, expected := range map[string]string{
+		"mx.example.com[192.0.2.1]:25": "mx.example.com",
+		"private/dovecot-lmtp":         "private/dovecot-lmtp",
+		"none":                         "none",
+	} {
+		d := &maillog.Delivery{Relay: relay}
+		if d.RelayHost() != expected {
+			t.Errorf("expected `%s`, but actual is `%s`", expected, d.RelayHost())
+		}
+	}
+}
+
+func TestEvent_Transport(t *testing.T) {
+	for line, expected := range map[string]string{
+		"Apr  1 12:00:00 mail postfix/smtp[1]: 3F8C41A2B3: removed":             "smtp",
+		"Apr  1 12:00:00 mail postfix/relay/smtp[1]: 3F8C41A2B3: removed":       "relay",
+		"Apr  1 12:00:00 mail postfix-out/lmtp[1]: 3F8C41A2B3: removed":         "lmtp",
+		"Apr  1 12:00:00 mail postfix/submission/smtpd[1]: connect from x[::1]": "submission",
+	} {
+		e, err := maillog.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Transport() != expected {
+			t.Errorf("expected `%s`, but actual is `%s`", expected, e.Transport())
+		}
+	}
+}
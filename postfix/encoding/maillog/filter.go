@@ -0,0 +1,168 @@
+package maillog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	amavisRegex        = regexp.MustCompile(`^\([^)]*\) (Passed|Blocked) ([A-Z][A-Z-]*)\b`)
+	amavisQueueIDRegex = regexp.MustCompile(`\bQueue-ID: ([0-9A-Za-z]+)`)
+	amavisTimeRegex    = regexp.MustCompile(`, (\d+) ms$`)
+	rspamdRegex        = regexp.MustCompile(`\(\S+: ([TFS]) \(([^)]+)\): \[`)
+	rspamdQueueIDRegex = regexp.MustCompile(`\bqid: <([0-9A-Za-z]+)>`)
+	rspamdTimeRegex    = regexp.MustCompile(`\btime: (\d+(?:\.\d+)?)(ms|s)\b`)
+	spamdRegex         = regexp.MustCompile(`^spamd: result: ([YN.]) -?\d+ - .*\bscantime=(\d+(?:\.\d+)?)`)
+	clamavMilterRegex  = regexp.MustCompile(`^(?:Message (\S+) from .* infected by (\S+)|Clean message (\S+) from )`)
+	milterActionRegex  = regexp.MustCompile(`^(?:NOQUEUE: )?milter-(reject|discard|hold|redirect): (\S+) from (\S+): (.*)$`)
+	milterWarningRegex = regexp.MustCompile(`^warning: milter (\S+): (.*)$`)
+	milterTimeoutRegex = regexp.MustCompile(`(?i)timed out|timeout`)
+)
+
+// FilterVerdict is the verdict of a content filter on a message.
+type FilterVerdict struct {
+	// Filter is amavis, rspamd, spamassassin or clamav.
+	Filter string
+	// Verdict is the classification of the message in lower case (e.g. clean, spam or infected).
+	Verdict string
+	// Action is what the filter did to the message in lower case (e.g. passed, blocked or reject), or empty if the filter does not decide it.
+	Action string
+	// QueueID is the queue ID of the message in Postfix, or empty if the line has none.
+	QueueID string
+	// ScanTime is the time to scan the message, or zero if the line has none.
+	ScanTime time.Duration
+}
+
+// ParseAmavis returns the verdict of an amavis line, or false if the payload is not a verdict
+// (e.g. `(01234-05) Passed CLEAN {RelayedInbound}, [192.0.2.1]:12345 [192.0.2.1] <sender@example.com> -> <user@example.com>, Queue-ID: 4F9D195432C, ..., 1234 ms`).
+func ParseAmavis(payload string) (*FilterVerdict, bool) {
+	match := amavisRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	v := &FilterVerdict{
+		Filter:  "amavis",
+		Verdict: normalizeVerdict(match[2]),
+		Action:  strings.ToLower(match[1]),
+	}
+	if match := amavisQueueIDRegex.FindStringSubmatch(payload); match != nil {
+		v.QueueID = match[1]
+	}
+	if match := amavisTimeRegex.FindStringSubmatch(payload); match != nil {
+		ms, _ := strconv.Atoi(match[1])
+		v.ScanTime = time.Duration(ms) * time.Millisecond
+	}
+	return v, true
+}
+
+// ParseRspamd returns the verdict of an rspamd task log, or false if the payload is not a verdict
+// (e.g. `<8f1c2a>; task; rspamd_task_write_log: id: <...>, qid: <4F9D195432C>, ip: 192.0.2.1, (default: T (reject): [16.20/15.00] [...]), len: 1234, time: 156.123ms, ...`).
+// The verdict is spam, clean or skipped by the T, F and S of the log.
+func ParseRspamd(payload string) (*FilterVerdict, bool) {
+	match := rspamdRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	v := &FilterVerdict{
+		Filter:  "rspamd",
+		Verdict: map[string]string{"T": "spam", "F": "clean", "S": "skipped"}[match[1]],
+		Action:  normalizeVerdict(match[2]),
+	}
+	if match := rspamdQueueIDRegex.FindStringSubmatch(payload); match != nil {
+		v.QueueID = match[1]
+	}
+	if match := rspamdTimeRegex.FindStringSubmatch(payload); match != nil {
+		v.ScanTime, _ = time.ParseDuration(match[1] + match[2])
+	}
+	return v, true
+}
+
+// ParseSpamd returns the verdict of a spamd result of SpamAssassin, or false if the payload is not a result
+// (e.g. `spamd: result: Y 15 - BAYES_99,URIBL_BLACK scantime=1.2,size=1234,user=amavis,...`).
+func ParseSpamd(payload string) (*FilterVerdict, bool) {
+	match := spamdRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	v := &FilterVerdict{
+		Filter:  "spamassassin",
+		Verdict: "clean",
+	}
+	if match[1] == "Y" {
+		v.Verdict = "spam"
+	}
+	v.ScanTime, _ = time.ParseDuration(match[2] + "s")
+	return v, true
+}
+
+// ParseClamavMilter returns the verdict of clamav-milter logged by LogInfected or LogClean, or false if the payload is not a verdict
+// (e.g. `Message 4F9D195432C from <sender@example.com> to <user@example.com> infected by Eicar-Test-Signature`).
+func ParseClamavMilter(payload string) (*FilterVerdict, bool) {
+	match := clamavMilterRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	if match[1] != "" {
+		return &FilterVerdict{Filter: "clamav", Verdict: "infected", QueueID: match[1]}, true
+	}
+	return &FilterVerdict{Filter: "clamav", Verdict: "clean", QueueID: match[3]}, true
+}
+
+// MilterAction is an action of a milter applied by smtpd or cleanup
+// (e.g. `milter-reject: END-OF-MESSAGE from unknown[192.0.2.1]: 5.7.1 Spam message rejected; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>`).
+type MilterAction struct {
+	// Action is reject, discard, hold or redirect.
+	Action string
+	// Stage is the SMTP command or END-OF-MESSAGE.
+	Stage  string
+	Client string
+	// Text is the reply text or the description of the action, without the attributes after it.
+	Text string
+}
+
+// ParseMilterAction returns the milter action of the payload, or false if the payload is not a milter action.
+func ParseMilterAction(payload string) (*MilterAction, bool) {
+	match := milterActionRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	a := &MilterAction{
+		Action: match[1],
+		Stage:  match[2],
+		Client: match[3],
+		Text:   match[4],
+	}
+	if i := strings.LastIndex(a.Text, "; from=<"); i >= 0 {
+		a.Text = a.Text[:i]
+	}
+	return a, true
+}
+
+// MilterWarning is a warning of smtpd or cleanup about a milter
+// (e.g. `warning: milter inet:127.0.0.1:11332: can't read SMFIC_BODYEOB reply packet header: Connection timed out`).
+type MilterWarning struct {
+	// Milter is the address of the milter as in smtpd_milters or non_smtpd_milters.
+	Milter string
+	Text   string
+}
+
+// Timeout returns whether the milter did not respond in time.
+func (w *MilterWarning) Timeout() bool {
+	return milterTimeoutRegex.MatchString(w.Text)
+}
+
+// ParseMilterWarning returns the milter warning of the payload, or false if the payload is not a milter warning.
+func ParseMilterWarning(payload string) (*MilterWarning, bool) {
+	match := milterWarningRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	return &MilterWarning{Milter: match[1], Text: match[2]}, true
+}
+
+// normalizeVerdict returns the verdict or the action in lower case with underscores (e.g. BAD-HEADER is bad_header, and no action is no_action).
+func normalizeVerdict(s string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(s))
+}
@@ -0,0 +1,120 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFilterVerdict(t *testing.T) {
+	cases := []struct {
+		parse    func(string) (*maillog.FilterVerdict, bool)
+		payload  string
+		expected *maillog.FilterVerdict
+	}{
+		{
+			maillog.ParseAmavis,
+			"(01234-05) Passed CLEAN {RelayedInbound}, [192.0.2.1]:12345 [192.0.2.1] <sender@example.com> -> <user@example.com>, Queue-ID: 4F9D195432C, Message-ID: <1@example.com>, mail_id: abc, Hits: -1.2, size: 1234, queued_as: 5A0B1954330, 1234 ms",
+			&maillog.FilterVerdict{Filter: "amavis", Verdict: "clean", Action: "passed", QueueID: "4F9D195432C", ScanTime: 1234 * time.Millisecond},
+		},
+		{
+			maillog.ParseAmavis,
+			"(01234-06) Blocked INFECTED (Eicar-Test-Signature) {DiscardedInbound,Quarantined}, [192.0.2.1]:12345 [192.0.2.1] <sender@example.com> -> <user@example.com>, quarantine: virus-abc, Queue-ID: 4F9D195432C, 87 ms",
+			&maillog.FilterVerdict{Filter: "amavis", Verdict: "infected", Action: "blocked", QueueID: "4F9D195432C", ScanTime: 87 * time.Millisecond},
+		},
+		{
+			maillog.ParseAmavis,
+			"(01234-07) Passed BAD-HEADER, [192.0.2.1] <sender@example.com> -> <user@example.com>",
+			&maillog.FilterVerdict{Filter: "amavis", Verdict: "bad_header", Action: "passed"},
+		},
+		{
+			maillog.ParseAmavis,
+			"(01234-05) Checking: abc [192.0.2.1] <sender@example.com> -> <user@example.com>",
+			nil,
+		},
+		{
+			maillog.ParseRspamd,
+			"<8f1c2a>; task; rspamd_task_write_log: id: <1@example.com>, qid: <4F9D195432C>, ip: 192.0.2.1, from: <sender@example.com>, (default: T (reject): [16.20/15.00] [BAYES_SPAM(5.10){99.99%;}]), len: 1234, time: 156.123ms, dns req: 12, digest: <abc>, rcpts: <user@example.com>",
+			&maillog.FilterVerdict{Filter: "rspamd", Verdict: "spam", Action: "reject", QueueID: "4F9D195432C", ScanTime: 156123 * time.Microsecond},
+		},
+		{
+			maillog.ParseRspamd,
+			"<8f1c2a>; task; rspamd_task_write_log: id: <1@example.com>, ip: 192.0.2.1, (default: F (no action): [1.20/15.00] [R_SPF_ALLOW(-0.20){}]), len: 1234, time: 1.5s real, 12.000ms virtual",
+			&maillog.FilterVerdict{Filter: "rspamd", Verdict: "clean", Action: "no_action", ScanTime: 1500 * time.Millisecond},
+		},
+		{
+			maillog.ParseSpamd,
+			"spamd: result: Y 15 - BAYES_99,URIBL_BLACK scantime=1.2,size=1234,user=amavis,uid=1001,required_score=5.0,rhost=localhost,raddr=127.0.0.1,rport=12345,mid=<1@example.com>,autolearn=no",
+			&maillog.FilterVerdict{Filter: "spamassassin", Verdict: "spam", ScanTime: 1200 * time.Millisecond},
+		},
+		{
+			maillog.ParseSpamd,
+			"spamd: result: . -1 - ALL_TRUSTED scantime=0.3,size=1234,user=amavis",
+			&maillog.FilterVerdict{Filter: "spamassassin", Verdict: "clean", ScanTime: 300 * time.Millisecond},
+		},
+		{
+			maillog.ParseClamavMilter,
+			"Message 4F9D195432C from <sender@example.com> to <user@example.com> infected by Eicar-Test-Signature",
+			&maillog.FilterVerdict{Filter: "clamav", Verdict: "infected", QueueID: "4F9D195432C"},
+		},
+		{
+			maillog.ParseClamavMilter,
+			"Clean message 4F9D195432C from <sender@example.com> to <user@example.com>",
+			&maillog.FilterVerdict{Filter: "clamav", Verdict: "clean", QueueID: "4F9D195432C"},
+		},
+	}
+	for _, c := range cases {
+		actual, ok := c.parse(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
+
+func TestParseMilterAction(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.MilterAction
+	}{
+		{
+			"milter-reject: END-OF-MESSAGE from unknown[192.0.2.1]: 5.7.1 Spam message rejected; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+			&maillog.MilterAction{Action: "reject", Stage: "END-OF-MESSAGE", Client: "unknown[192.0.2.1]", Text: "5.7.1 Spam message rejected"},
+		},
+		{
+			"NOQUEUE: milter-reject: RCPT from unknown[192.0.2.1]: 451 4.7.1 Try again later; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+			&maillog.MilterAction{Action: "reject", Stage: "RCPT", Client: "unknown[192.0.2.1]", Text: "451 4.7.1 Try again later"},
+		},
+		{
+			"milter-hold: END-OF-MESSAGE from unknown[192.0.2.1]: milter triggers HOLD action; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+			&maillog.MilterAction{Action: "hold", Stage: "END-OF-MESSAGE", Client: "unknown[192.0.2.1]", Text: "milter triggers HOLD action"},
+		},
+		{
+			"NOQUEUE: reject: RCPT from unknown[192.0.2.1]: 554 5.7.1 <user@example.com>: Relay access denied; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>",
+			nil,
+		},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseMilterAction(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
+
+func TestParseMilterWarning(t *testing.T) {
+	cases := []struct {
+		payload string
+		milter  string
+		timeout bool
+	}{
+		{"warning: milter inet:127.0.0.1:11332: can't read SMFIC_BODYEOB reply packet header: Connection timed out", "inet:127.0.0.1:11332", true},
+		{"warning: milter unix:/run/opendkim/opendkim.sock: read error in initial handshake", "unix:/run/opendkim/opendkim.sock", false},
+	}
+	for _, c := range cases {
+		w, ok := maillog.ParseMilterWarning(c.payload)
+		if !ok || w.Milter != c.milter || w.Timeout() != c.timeout {
+			t.Errorf("expected `%s` (timeout: %v), but actual is `%+v`", c.milter, c.timeout, w)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package maillog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var notificationRegex = regexp.MustCompile(`^(?:sender|postmaster) (?:non-delivery|delivery status|delay) notification: (\S+)$`)
+
+// Client is the client of a new message of smtpd
+// (e.g. `client=unknown[192.0.2.1], sasl_method=PLAIN, sasl_username=user@example.com`).
+type Client struct {
+	// Client is the name and the address of the client (e.g. unknown[192.0.2.1]).
+	Client       string
+	SASLMethod   string
+	SASLUsername string
+}
+
+// ParseClient returns the client of the payload, or false if the payload is not a client line.
+func ParseClient(payload string) (*Client, bool) {
+	if !strings.HasPrefix(payload, "client=") {
+		return nil, false
+	}
+	attributes := ParseAttributes(payload)
+	return &Client{
+		Client:       attributes["client"],
+		SASLMethod:   attributes["sasl_method"],
+		SASLUsername: attributes["sasl_username"],
+	}, true
+}
+
+// Active is a message that qmgr moved to the active queue
+// (e.g. `from=<sender@example.com>, size=1234, nrcpt=3 (queue active)`).
+type Active struct {
+	From  string
+	Size  int64
+	Nrcpt int
+}
+
+// ParseActive returns the active message of the payload, or false if the payload is not a message of the active queue.
+func ParseActive(payload string) (*Active, bool) {
+	if !strings.HasPrefix(payload, "from=") || !strings.HasSuffix(payload, " (queue active)") {
+		return nil, false
+	}
+	attributes := ParseAttributes(strings.TrimSuffix(payload, " (queue active)"))
+	size, err := strconv.ParseInt(attributes["size"], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	nrcpt, err := strconv.Atoi(attributes["nrcpt"])
+	if err != nil {
+		return nil, false
+	}
+	return &Active{
+		From:  strings.Trim(attributes["from"], "<>"),
+		Size:  size,
+		Nrcpt: nrcpt,
+	}, true
+}
+
+// ParseMessageID returns the Message-ID header of the payload of cleanup (e.g. `message-id=<20200401120000.1234@example.com>`),
+// or false if the payload is not a Message-ID.
+func ParseMessageID(payload string) (string, bool) {
+	if !strings.HasPrefix(payload, "message-id=") {
+		return "", false
+	}
+	return strings.Trim(strings.TrimPrefix(payload, "message-id="), "<>"), true
+}
+
+// ParseNotification returns the queue ID of the notification that bounce sent for the message
+// (e.g. 4B2C3D4E5F of `sender non-delivery notification: 4B2C3D4E5F`), or false if the payload is not a notification.
+func ParseNotification(payload string) (string, bool) {
+	match := notificationRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
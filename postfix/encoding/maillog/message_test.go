@@ -0,0 +1,83 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParseClient(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.Client
+	}{
+		{
+			payload:  "client=unknown[192.0.2.1], sasl_method=PLAIN, sasl_username=user@example.com",
+			expected: &maillog.Client{Client: "unknown[192.0.2.1]", SASLMethod: "PLAIN", SASLUsername: "user@example.com"},
+		},
+		{
+			payload:  "client=client.example.com[192.0.2.2]",
+			expected: &maillog.Client{Client: "client.example.com[192.0.2.2]"},
+		},
+		{payload: "connect from unknown[192.0.2.1]"},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseClient(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
+
+func TestParseActive(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.Active
+	}{
+		{
+			payload:  "from=<sender@example.com>, size=1234, nrcpt=3 (queue active)",
+			expected: &maillog.Active{From: "sender@example.com", Size: 1234, Nrcpt: 3},
+		},
+		{
+			payload:  "from=<>, size=2048, nrcpt=1 (queue active)",
+			expected: &maillog.Active{Size: 2048, Nrcpt: 1},
+		},
+		{payload: "from=<sender@example.com>, status=expired, returned to sender"},
+		{payload: "removed"},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseActive(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
+
+func TestParseMessageID(t *testing.T) {
+	id, ok := maillog.ParseMessageID("message-id=<20200401120000.1234@example.com>")
+	if !ok || id != "20200401120000.1234@example.com" {
+		t.Errorf("expected `20200401120000.1234@example.com`, but actual is `%s`", id)
+	}
+	if _, ok := maillog.ParseMessageID("removed"); ok {
+		t.Error("expected `removed` is not a Message-ID, but actual is")
+	}
+}
+
+func TestParseNotification(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected string
+	}{
+		{"sender non-delivery notification: 4B2C3D4E5F", "4B2C3D4E5F"},
+		{"sender delivery status notification: 4B2C3D4E5F", "4B2C3D4E5F"},
+		{"sender delay notification: 4B2C3D4E5F", "4B2C3D4E5F"},
+		{"postmaster non-delivery notification: 4B2C3D4E5F", "4B2C3D4E5F"},
+		{"removed", ""},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseNotification(c.payload)
+		if ok != (c.expected != "") || actual != c.expected {
+			t.Errorf("expected `%s`, but actual is `%s`", c.expected, actual)
+		}
+	}
+}
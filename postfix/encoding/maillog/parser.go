@@ -0,0 +1,241 @@
+package maillog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a log line of Postfix or another mail service.
+type Event struct {
+	Time time.Time `json:"time"`
+	Host string    `json:"host"`
+	// Service is the syslog tag without the pid (e.g. postfix/submission/smtpd).
+	Service string `json:"service"`
+	// SyslogName is the syslog_name of the Postfix service (e.g. postfix/submission), or empty if the tag has no slash.
+	SyslogName string `json:"syslog_name,omitempty"`
+	// Process is the name of the program (e.g. smtpd).
+	Process string `json:"process"`
+	PID     int    `json:"pid,omitempty"`
+	// QueueID is the queue ID the message starts with, or empty (e.g. NOQUEUE).
+	QueueID string `json:"queue_id,omitempty"`
+	// Payload is the message without the queue ID.
+	Payload string `json:"payload"`
+}
+
+// IsPostfix returns whether the event is logged by Postfix.
+// Postfix services are tagged with syslog_name, which starts with postfix by default.
+func (e *Event) IsPostfix() bool {
+	return strings.HasPrefix(e.SyslogName, "postfix")
+}
+
+// ParseError occurs when an unexpected string of characters is encountered.
+type ParseError struct {
+	message string
+	line    string
+}
+
+// Line returns a string of lines that failed to be parsed.
+func (e *ParseError) Line() string {
+	return e.line
+}
+
+// Error returns an error string.
+func (e *ParseError) Error() string {
+	return e.message
+}
+
+var (
+	rfc3164Regex = regexp.MustCompile(`^([A-Z][a-z]{2} +\d{1,2} \d\d:\d\d:\d\d(?:\.\d+)?) (\S+) (.*)$`)
+	rfc3339Regex = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT\S+) (\S+) (.*)$`)
+	tagRegex     = regexp.MustCompile(`^([^\s\[\]:]+)(?:\[(\d+)\])?: ?(.*)$`)
+	queueIDRegex = regexp.MustCompile(`^([0-9A-F]{6,}|[0-9B-DF-HJ-NP-TV-Zb-df-hj-np-tv-z]{10,}): ?(.*)$`)
+	spacesRegex  = regexp.MustCompile(` +`)
+)
+
+// Parser parses log lines in the RFC 3164, RFC 5424 and Postfix maillog_file formats.
+// RFC 3164 lines and the traditional file format of rsyslog with RFC 3339 timestamps are accepted.
+// The syslog priority (e.g. <22>) is optional in all formats.
+type Parser struct {
+	// Location is the time zone of timestamps without one. If nil, time.Local is used.
+	Location *time.Location
+	// Now returns the current time to infer the year of timestamps without one. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+func (p *Parser) location() *time.Location {
+	if p.Location == nil {
+		return time.Local
+	}
+	return p.Location
+}
+
+func (p *Parser) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+// Parse parses a log line into an Event.
+func (p *Parser) Parse(line string) (*Event, error) {
+	s := strings.TrimRight(line, "\r\n")
+	s = stripPriority(s)
+
+	if strings.HasPrefix(s, "1 ") {
+		return p.parseRFC5424(line, s[2:])
+	}
+
+	var t time.Time
+	var host, rest string
+	if match := rfc3339Regex.FindStringSubmatch(s); match != nil {
+		var err error
+		t, err = time.Parse(time.RFC3339Nano, match[1])
+		if err != nil {
+			return nil, &ParseError{message: "Invalid RFC 3339 timestamp: " + err.Error(), line: line}
+		}
+		host, rest = match[2], match[3]
+	} else if match := rfc3164Regex.FindStringSubmatch(s); match != nil {
+		var err error
+		t, err = p.parseStamp(spacesRegex.ReplaceAllString(match[1], " "))
+		if err != nil {
+			return nil, &ParseError{message: "Invalid RFC 3164 timestamp: " + err.Error(), line: line}
+		}
+		host, rest = match[2], match[3]
+	} else {
+		return nil, &ParseError{message: "A log line must start with a timestamp and a hostname", line: line}
+	}
+
+	match := tagRegex.FindStringSubmatch(rest)
+	if match == nil {
+		return nil, &ParseError{message: "A log line must have a tag followed by `:`", line: line}
+	}
+	pid, _ := strconv.Atoi(match[2])
+	return NewEvent(t, host, match[1], pid, match[3]), nil
+}
+
+// parseStamp parses the timestamp of RFC 3164, which has no year.
+// The year is the current one, or the previous one if the timestamp would be more than a day ahead.
+func (p *Parser) parseStamp(s string) (time.Time, error) {
+	t, err := time.ParseInLocation("Jan 2 15:04:05", s, p.location())
+	if err != nil {
+		return t, err
+	}
+	now := p.now().In(p.location())
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.Sub(now) > 24*time.Hour {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
+
+// parseRFC5424 parses the rest of an RFC 5424 line after the version:
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func (p *Parser) parseRFC5424(line string, s string) (*Event, error) {
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 6 {
+		return nil, &ParseError{message: "An RFC 5424 line must have TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA", line: line}
+	}
+
+	t := p.now()
+	if fields[0] != "-" {
+		var err error
+		t, err = time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return nil, &ParseError{message: "Invalid RFC 5424 timestamp: " + err.Error(), line: line}
+		}
+	}
+	host := nilValue(fields[1])
+	tag := nilValue(fields[2])
+	pid, _ := strconv.Atoi(fields[3])
+
+	message, ok := skipStructuredData(fields[5])
+	if !ok {
+		return nil, &ParseError{message: "Invalid RFC 5424 structured data", line: line}
+	}
+	message = strings.TrimPrefix(message, "\xef\xbb\xbf")
+	return NewEvent(t, host, tag, pid, message), nil
+}
+
+// NewEvent returns new Event from the parts of a log entry.
+// The tag is split into the syslog_name and the process, and the queue ID is split from the message.
+func NewEvent(t time.Time, host string, tag string, pid int, message string) *Event {
+	e := &Event{
+		Time:    t,
+		Host:    host,
+		Service: tag,
+		Process: tag,
+		PID:     pid,
+		Payload: message,
+	}
+	if i := strings.LastIndex(tag, "/"); i >= 0 {
+		e.SyslogName = tag[:i]
+		e.Process = tag[i+1:]
+	}
+	if match := queueIDRegex.FindStringSubmatch(message); match != nil {
+		e.QueueID = match[1]
+		e.Payload = match[2]
+	}
+	return e
+}
+
+// Parse parses a log line into an Event by the default Parser.
+func Parse(line string) (*Event, error) {
+	return (&Parser{}).Parse(line)
+}
+
+// stripPriority removes the syslog priority (e.g. <22>) at the start of s.
+func stripPriority(s string) string {
+	if !strings.HasPrefix(s, "<") {
+		return s
+	}
+	i := strings.IndexByte(s, '>')
+	if i < 2 || i > 4 {
+		return s
+	}
+	if _, err := strconv.Atoi(s[1:i]); err != nil {
+		return s
+	}
+	return s[i+1:]
+}
+
+// skipStructuredData returns the message after the structured data of RFC 5424.
+func skipStructuredData(s string) (string, bool) {
+	if strings.HasPrefix(s, "-") {
+		return strings.TrimPrefix(s[1:], " "), true
+	}
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		i++
+		for i < len(s) && s[i] != ']' {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				i++
+				for i < len(s) && s[i] != '"' {
+					if s[i] == '\\' {
+						i++
+					}
+					i++
+				}
+			}
+			i++
+		}
+		if i >= len(s) {
+			return "", false
+		}
+		i++
+	}
+	if i == 0 {
+		return "", false
+	}
+	return strings.TrimPrefix(s[i:], " "), true
+}
+
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package maillog_test
+
+import (
+	"fmt"
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"testing"
+	"time"
+)
+
+func ExampleParse() {
+	e, err := maillog.Parse("2020-04-01T12:00:00.123456+00:00 mail postfix/submission/smtpd[1234]: 3F8C41A2B3: client=unknown[192.0.2.1]")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(e.Host, e.SyslogName, e.Process, e.PID, e.QueueID, e.Payload)
+	// Output: mail postfix/submission smtpd 1234 3F8C41A2B3 client=unknown[192.0.2.1]
+}
+
+func TestParser_Parse(t *testing.T) {
+	utc := time.UTC
+	p := &maillog.Parser{
+		Location: utc,
+		Now: func() time.Time {
+			return time.Date(2020, 4, 1, 12, 0, 0, 0, utc)
+		},
+	}
+	cases := []struct {
+		name     string
+		line     string
+		expected maillog.Event
+	}{
+		{
+			name: "RFC 3164",
+			line: "Apr  1 11:59:59 mail postfix/smtp[4321]: 3F8C41A2B3: to=<***@example.com>, status=sent\n",
+			expected: maillog.Event{
+				Time: time.Date(2020, 4, 1, 11, 59, 59, 0, utc), Host: "mail",
+				Service: "postfix/smtp", SyslogName: "postfix", Process: "smtp", PID: 4321,
+				QueueID: "3F8C41A2B3", Payload: "to=<***@example.com>, status=sent",
+			},
+		},
+		{
+			name: "RFC 3164 with priority from the previous year",
+			line: "<22>Dec 31 23:59:59 mail postfix/qmgr[99]: 3nQDNd0sD9z3WBc: removed",
+			expected: maillog.Event{
+				Time: time.Date(2019, 12, 31, 23, 59, 59, 0, utc), Host: "mail",
+				Service: "postfix/qmgr", SyslogName: "postfix", Process: "qmgr", PID: 99,
+				QueueID: "3nQDNd0sD9z3WBc", Payload: "removed",
+			},
+		},
+		{
+			name: "Postfix maillog_file",
+			line: "Apr  1 11:00:00.250000 mail postfix/submission/smtpd[1234]: NOQUEUE: reject: RCPT from unknown[192.0.2.1]: 554 5.7.1 Relay access denied",
+			expected: maillog.Event{
+				Time: time.Date(2020, 4, 1, 11, 0, 0, 250000000, utc), Host: "mail",
+				Service: "postfix/submission/smtpd", SyslogName: "postfix/submission", Process: "smtpd", PID: 1234,
+				Payload: "NOQUEUE: reject: RCPT from unknown[192.0.2.1]: 554 5.7.1 Relay access denied",
+			},
+		},
+		{
+			name: "rsyslog with RFC 3339 timestamp",
+			line: "2020-04-01T11:00:00.5+09:00 mail postfix/postfix-script: starting the Postfix mail system",
+			expected: maillog.Event{
+				Time: time.Date(2020, 4, 1, 2, 0, 0, 500000000, utc), Host: "mail",
+				Service: "postfix/postfix-script", SyslogName: "postfix", Process: "postfix-script",
+				Payload: "starting the Postfix mail system",
+			},
+		},
+		{
+			name: "RFC 5424",
+			line: `<22>1 2020-04-01T11:00:00Z mail postfix/cleanup 555 - [meta sequenceId="1" note="a \"]\" b"] 3F8C41A2B3: message-id=<abc@example.com>`,
+			expected: maillog.Event{
+				Time: time.Date(2020, 4, 1, 11, 0, 0, 0, utc), Host: "mail",
+				Service: "postfix/cleanup", SyslogName: "postfix", Process: "cleanup", PID: 555,
+				QueueID: "3F8C41A2B3", Payload: "message-id=<abc@example.com>",
+			},
+		},
+		{
+			name: "RFC 5424 without structured data",
+			line: "<22>1 2020-04-01T11:00:00Z mail opendkim - - - \xef\xbb\xbf3F8C41A2B3: DKIM-Signature field added",
+			expected: maillog.Event{
+				Time: time.Date(2020, 4, 1, 11, 0, 0, 0, utc), Host: "mail",
+				Service: "opendkim", Process: "opendkim",
+				QueueID: "3F8C41A2B3", Payload: "DKIM-Signature field added",
+			},
+		},
+	}
+	for _, c := range cases {
+		e, err := p.Parse(c.line)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !e.Time.Equal(c.expected.Time) {
+			t.Errorf("%s: expected `%v`, but actual is `%v`", c.name, c.expected.Time, e.Time)
+		}
+		e.Time = c.expected.Time
+		if *e != c.expected {
+			t.Errorf("%s: expected `%+v`, but actual is `%+v`", c.name, c.expected, *e)
+		}
+	}
+}
+
+func TestParser_ParseError(t *testing.T) {
+	lines := []string{
+		"",
+		"postfix/smtpd[1]: connect from unknown",
+		"Apr  1 11:00:00 mail",
+		"Apr  1 11:00:00 mail no tag here",
+		"<22>1 2020-04-01T11:00:00Z mail postfix/smtpd",
+		"<22>1 2020-04-01T11:00:00Z mail postfix/smtpd 1 - [unterminated",
+	}
+	for _, line := range lines {
+		_, err := maillog.Parse(line)
+		e, ok := err.(*maillog.ParseError)
+		if !ok {
+			t.Errorf("expected ParseError for `%s`, but actual is `%v`", line, err)
+			continue
+		}
+		if e.Line() != line {
+			t.Errorf("expected `%s`, but actual is `%s`", line, e.Line())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package maillog
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	postscreenRegex = regexp.MustCompile(`^(CONNECT|PASS NEW|PASS OLD|WHITELISTED|WHITELIST VETO|BLACKLISTED|ALLOWLISTED|ALLOWLIST VETO|DENYLISTED|DNSBL rank (\d+)|PREGREET \d+ after \S+|HANGUP after \S+|COMMAND PIPELINING|NON-SMTP COMMAND|BARE NEWLINE|COMMAND TIME LIMIT|COMMAND COUNT LIMIT|COMMAND LENGTH LIMIT|DISCONNECT) (?:from |for )?(\[[^\]]*\]:\d+)`)
+	dnsblHitRegex   = regexp.MustCompile(`^addr (\S+) listed by domain (\S+) as (\S+)`)
+	// postscreenEventRegex removes the details from the event of postscreenRegex.
+	postscreenEventRegex = regexp.MustCompile(`^(DNSBL|PREGREET|HANGUP)\b.*`)
+	// postscreenRenamedEvents are the events renamed by Postfix 3.6, by the names before it.
+	postscreenRenamedEvents = map[string]string{
+		"ALLOWLISTED":    "WHITELISTED",
+		"ALLOWLIST VETO": "WHITELIST VETO",
+		"DENYLISTED":     "BLACKLISTED",
+	}
+)
+
+// PostscreenEvent is an event of postscreen (e.g. `PASS NEW [192.0.2.1]:12345` or `DNSBL rank 6 for [192.0.2.1]:12345`).
+type PostscreenEvent struct {
+	// Event is one of CONNECT, PASS NEW, PASS OLD, WHITELISTED, WHITELIST VETO, BLACKLISTED, DNSBL, PREGREET, HANGUP,
+	// COMMAND PIPELINING, NON-SMTP COMMAND, BARE NEWLINE, COMMAND TIME LIMIT, COMMAND COUNT LIMIT, COMMAND LENGTH LIMIT and DISCONNECT.
+	// ALLOWLISTED, ALLOWLIST VETO and DENYLISTED of Postfix 3.6 and later are WHITELISTED, WHITELIST VETO and BLACKLISTED.
+	Event string
+	// Client is the address and the port of the client (e.g. [192.0.2.1]:12345).
+	Client string
+	// Rank is the combined score of the DNS blocklists of a DNSBL event.
+	Rank int
+}
+
+// ParsePostscreen returns the postscreen event of the payload, or false if the payload is not a known event.
+func ParsePostscreen(payload string) (*PostscreenEvent, bool) {
+	match := postscreenRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	e := &PostscreenEvent{
+		Event:  postscreenEventRegex.ReplaceAllString(match[1], "$1"),
+		Client: match[3],
+	}
+	if event, ok := postscreenRenamedEvents[e.Event]; ok {
+		e.Event = event
+	}
+	if match[2] != "" {
+		e.Rank, _ = strconv.Atoi(match[2])
+	}
+	return e, true
+}
+
+// DNSBLHit is a client listed by a DNS blocklist, logged by dnsblog for postscreen
+// (e.g. `addr 192.0.2.1 listed by domain zen.spamhaus.org as 127.0.0.2`).
+type DNSBLHit struct {
+	Address string
+	// Site is the domain of the blocklist as in postscreen_dnsbl_sites, without the filter and the weight.
+	Site  string
+	Reply string
+}
+
+// ParseDNSBLHit returns the blocklist hit of the payload, or false if the payload is not a hit.
+func ParseDNSBLHit(payload string) (*DNSBLHit, bool) {
+	match := dnsblHitRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	return &DNSBLHit{Address: match[1], Site: match[2], Reply: match[3]}, true
+}
@@ -0,0 +1,48 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParsePostscreen(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.PostscreenEvent
+	}{
+		{"CONNECT from [192.0.2.1]:12345 to [198.51.100.1]:25", &maillog.PostscreenEvent{Event: "CONNECT", Client: "[192.0.2.1]:12345"}},
+		{"PASS NEW [192.0.2.1]:12345", &maillog.PostscreenEvent{Event: "PASS NEW", Client: "[192.0.2.1]:12345"}},
+		{"PASS OLD [2001:db8::1]:12345", &maillog.PostscreenEvent{Event: "PASS OLD", Client: "[2001:db8::1]:12345"}},
+		{"WHITELISTED [192.0.2.1]:12345", &maillog.PostscreenEvent{Event: "WHITELISTED", Client: "[192.0.2.1]:12345"}},
+		{"BLACKLISTED [192.0.2.1]:12345", &maillog.PostscreenEvent{Event: "BLACKLISTED", Client: "[192.0.2.1]:12345"}},
+		{"ALLOWLISTED [192.0.2.1]:12345", &maillog.PostscreenEvent{Event: "WHITELISTED", Client: "[192.0.2.1]:12345"}},
+		{"ALLOWLIST VETO [192.0.2.1]:12345", &maillog.PostscreenEvent{Event: "WHITELIST VETO", Client: "[192.0.2.1]:12345"}},
+		{"DENYLISTED [192.0.2.1]:12345", &maillog.PostscreenEvent{Event: "BLACKLISTED", Client: "[192.0.2.1]:12345"}},
+		{"DNSBL rank 6 for [192.0.2.1]:12345", &maillog.PostscreenEvent{Event: "DNSBL", Client: "[192.0.2.1]:12345", Rank: 6}},
+		{"PREGREET 11 after 0.19 from [192.0.2.1]:12345: EHLO client\\r\\n", &maillog.PostscreenEvent{Event: "PREGREET", Client: "[192.0.2.1]:12345"}},
+		{"HANGUP after 0.7 from [192.0.2.1]:12345 in tests after SMTP handshake", &maillog.PostscreenEvent{Event: "HANGUP", Client: "[192.0.2.1]:12345"}},
+		{"COMMAND PIPELINING from [192.0.2.1]:12345 after EHLO: QUIT\\r\\n", &maillog.PostscreenEvent{Event: "COMMAND PIPELINING", Client: "[192.0.2.1]:12345"}},
+		{"NON-SMTP COMMAND from [192.0.2.1]:12345 after CONNECT: GET / HTTP/1.1", &maillog.PostscreenEvent{Event: "NON-SMTP COMMAND", Client: "[192.0.2.1]:12345"}},
+		{"BARE NEWLINE from [192.0.2.1]:12345 after DATA", &maillog.PostscreenEvent{Event: "BARE NEWLINE", Client: "[192.0.2.1]:12345"}},
+		{"DISCONNECT [192.0.2.1]:12345", &maillog.PostscreenEvent{Event: "DISCONNECT", Client: "[192.0.2.1]:12345"}},
+		{"NOQUEUE: reject: RCPT from [192.0.2.1]:12345: 550 5.7.1 Service unavailable; client [192.0.2.1] blocked using zen.spamhaus.org", nil},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParsePostscreen(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
+
+func TestParseDNSBLHit(t *testing.T) {
+	hit, ok := maillog.ParseDNSBLHit("addr 192.0.2.1 listed by domain zen.spamhaus.org as 127.0.0.2")
+	expected := &maillog.DNSBLHit{Address: "192.0.2.1", Site: "zen.spamhaus.org", Reply: "127.0.0.2"}
+	if !ok || !reflect.DeepEqual(hit, expected) {
+		t.Errorf("expected `%+v`, but actual is `%+v`", expected, hit)
+	}
+	if _, ok := maillog.ParseDNSBLHit("warning: dnsblog_query: lookup error for DNS query 1.2.0.192.zen.spamhaus.org"); ok {
+		t.Error("expected a lookup error is not a hit, but actual is")
+	}
+}
@@ -0,0 +1,67 @@
+package maillog
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	rejectRegex = regexp.MustCompile(`^(?:NOQUEUE: )?(reject|reject_warning): (\S+) from (\S+): (\d{3})(?: (\d\.\d{1,3}\.\d{1,3}))? (.*)$`)
+	rblRegex    = regexp.MustCompile(`blocked using ([^\s;,]+)`)
+)
+
+// Reject is a rejected SMTP command of smtpd, or a warning of warn_if_reject
+// (e.g. `NOQUEUE: reject: RCPT from unknown[192.0.2.1]: 554 5.7.1 <user@example.com>: Relay access denied; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client.example.com>`).
+type Reject struct {
+	// Warning is true for reject_warning, which is logged instead of reject by warn_if_reject.
+	Warning bool
+	// Stage is the SMTP command (e.g. CONNECT, EHLO, MAIL, RCPT or DATA).
+	Stage  string
+	Client string
+	// Code is the SMTP reply code (e.g. 554), and EnhancedStatus is the enhanced status code (e.g. 5.7.1) if any.
+	Code           string
+	EnhancedStatus string
+	// Text is the reply text without the attributes after it.
+	Text string
+	// Attributes are from, to, proto and helo after the reply text.
+	Attributes map[string]string
+}
+
+// RBL returns the DNS blocklist domain of `blocked using <domain>` in the reply text, or empty.
+func (r *Reject) RBL() string {
+	if match := rblRegex.FindStringSubmatch(r.Text); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// ParseReject returns the rejected SMTP command of the payload, or false if the payload is not a reject.
+func ParseReject(payload string) (*Reject, bool) {
+	match := rejectRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	r := &Reject{
+		Warning:        match[1] == "reject_warning",
+		Stage:          match[2],
+		Client:         match[3],
+		Code:           match[4],
+		EnhancedStatus: match[5],
+		Text:           match[6],
+		Attributes:     make(map[string]string),
+	}
+
+	i := strings.LastIndex(r.Text, "; from=<")
+	if i < 0 {
+		i = strings.LastIndex(r.Text, "; proto=")
+	}
+	if i >= 0 {
+		for _, part := range strings.Fields(r.Text[i+2:]) {
+			if j := strings.IndexByte(part, '='); j > 0 {
+				r.Attributes[part[:j]] = strings.Trim(part[j+1:], "<>")
+			}
+		}
+		r.Text = r.Text[:i]
+	}
+	return r, true
+}
@@ -0,0 +1,54 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParseReject(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.Reject
+	}{
+		{
+			payload: "NOQUEUE: reject: RCPT from unknown[192.0.2.1]: 554 5.7.1 <user@example.com>: Relay access denied; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client.example.com>",
+			expected: &maillog.Reject{
+				Stage: "RCPT", Client: "unknown[192.0.2.1]", Code: "554", EnhancedStatus: "5.7.1",
+				Text:       "<user@example.com>: Relay access denied",
+				Attributes: map[string]string{"from": "sender@example.com", "to": "user@example.com", "proto": "ESMTP", "helo": "client.example.com"},
+			},
+		},
+		{
+			payload: "NOQUEUE: reject_warning: CONNECT from unknown[192.0.2.1]: 450 4.7.1 Client host rejected: cannot find your hostname, [192.0.2.1]; proto=SMTP",
+			expected: &maillog.Reject{
+				Warning: true, Stage: "CONNECT", Client: "unknown[192.0.2.1]", Code: "450", EnhancedStatus: "4.7.1",
+				Text:       "Client host rejected: cannot find your hostname, [192.0.2.1]",
+				Attributes: map[string]string{"proto": "SMTP"},
+			},
+		},
+		{
+			payload: "reject: DATA from client.example.com[192.0.2.1]: 550 Multi-recipient bounce; from=<> proto=ESMTP helo=<client.example.com>",
+			expected: &maillog.Reject{
+				Stage: "DATA", Client: "client.example.com[192.0.2.1]", Code: "550",
+				Text:       "Multi-recipient bounce",
+				Attributes: map[string]string{"from": "", "proto": "ESMTP", "helo": "client.example.com"},
+			},
+		},
+		{payload: "connect from unknown[192.0.2.1]"},
+		{payload: "reject: header Subject: spam from unknown[192.0.2.1]; from=<> to=<>: 5.7.1 message content rejected"},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseReject(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
+
+func TestReject_RBL(t *testing.T) {
+	r, _ := maillog.ParseReject("NOQUEUE: reject: RCPT from unknown[192.0.2.1]: 554 5.7.1 Service unavailable; Client host [192.0.2.1] blocked using zen.spamhaus.org; https://www.spamhaus.org/query/ip/192.0.2.1; from=<sender@example.com> to=<user@example.com> proto=ESMTP helo=<client>")
+	if r.RBL() != "zen.spamhaus.org" {
+		t.Errorf("expected `zen.spamhaus.org`, but actual is `%s`", r.RBL())
+	}
+}
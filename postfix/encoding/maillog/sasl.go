@@ -0,0 +1,40 @@
+package maillog
+
+import (
+	"regexp"
+	"strings"
+)
+
+var saslFailureRegex = regexp.MustCompile(`^warning: ([^\s\[]+)\[([^\]]*)\]: SASL (\S+) authentication failed: ?(.*)$`)
+
+// SASLFailure is a failed SASL authentication of smtpd
+// (e.g. `warning: unknown[192.0.2.1]: SASL LOGIN authentication failed: authentication failure, sasl_username=user@example.com`).
+type SASLFailure struct {
+	// Hostname is the name of the client, or unknown.
+	Hostname string
+	// Address is the IP address of the client.
+	Address   string
+	Mechanism string
+	Reason    string
+	// Username is the sasl_username that Postfix 3.x logs after the reason, or empty.
+	Username string
+}
+
+// ParseSASLFailure returns the failed SASL authentication of the payload, or false if the payload is not a failed authentication.
+func ParseSASLFailure(payload string) (*SASLFailure, bool) {
+	match := saslFailureRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	f := &SASLFailure{
+		Hostname:  match[1],
+		Address:   match[2],
+		Mechanism: match[3],
+		Reason:    match[4],
+	}
+	if i := strings.LastIndex(f.Reason, ", sasl_username="); i >= 0 {
+		f.Username = f.Reason[i+len(", sasl_username="):]
+		f.Reason = f.Reason[:i]
+	}
+	return f, true
+}
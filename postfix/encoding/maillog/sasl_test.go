@@ -0,0 +1,31 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParseSASLFailure(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.SASLFailure
+	}{
+		{
+			payload:  "warning: unknown[192.0.2.1]: SASL LOGIN authentication failed: UGFzc3dvcmQ6",
+			expected: &maillog.SASLFailure{Hostname: "unknown", Address: "192.0.2.1", Mechanism: "LOGIN", Reason: "UGFzc3dvcmQ6"},
+		},
+		{
+			payload:  "warning: client.example.com[2001:db8::1]: SASL PLAIN authentication failed: authentication failure, sasl_username=user@example.com",
+			expected: &maillog.SASLFailure{Hostname: "client.example.com", Address: "2001:db8::1", Mechanism: "PLAIN", Reason: "authentication failure", Username: "user@example.com"},
+		},
+		{payload: "warning: unknown[192.0.2.1]: SASL LOGIN authentication failed:", expected: &maillog.SASLFailure{Hostname: "unknown", Address: "192.0.2.1", Mechanism: "LOGIN"}},
+		{payload: "warning: hostname client.example.com does not resolve to address 192.0.2.1"},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseSASLFailure(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
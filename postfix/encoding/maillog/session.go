@@ -0,0 +1,69 @@
+package maillog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	disconnectRegex   = regexp.MustCompile(`^disconnect from (\S+)((?: [a-z-]+=\d+(?:/\d+)?)*)$`)
+	sessionErrorRegex = regexp.MustCompile(`^(lost connection|timeout|too many errors) after ([A-Z-]+)`)
+)
+
+// CommandStats is the number of successful and all attempts of an SMTP command in a session.
+type CommandStats struct {
+	Name    string
+	Success int
+	Total   int
+}
+
+// Disconnect is the end of an SMTP session with its command statistics
+// (e.g. `disconnect from unknown[192.0.2.1] ehlo=1 mail=1 rcpt=0/1 data=0 commands=2/3`).
+type Disconnect struct {
+	Client string
+	// Commands are the statistics of each command in the logged order, without commands=.
+	Commands []CommandStats
+	// Total is the statistics of all commands, commands=, or nil if they are not logged (Postfix before 3.0).
+	Total *CommandStats
+}
+
+// ParseDisconnect returns the disconnect of the payload, or false if the payload is not a disconnect.
+// A count without a slash (e.g. ehlo=1) is the number of attempts that all succeeded.
+func ParseDisconnect(payload string) (*Disconnect, bool) {
+	match := disconnectRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	d := &Disconnect{Client: match[1]}
+	for _, field := range strings.Fields(match[2]) {
+		i := strings.IndexByte(field, '=')
+		stats := CommandStats{Name: field[:i]}
+		counts := field[i+1:]
+		if j := strings.IndexByte(counts, '/'); j >= 0 {
+			stats.Success, _ = strconv.Atoi(counts[:j])
+			stats.Total, _ = strconv.Atoi(counts[j+1:])
+		} else {
+			stats.Success, _ = strconv.Atoi(counts)
+			stats.Total = stats.Success
+		}
+		if stats.Name == "commands" {
+			total := stats
+			d.Total = &total
+		} else {
+			d.Commands = append(d.Commands, stats)
+		}
+	}
+	return d, true
+}
+
+// ParseSessionError returns the error and the SMTP stage of a session that ended abnormally
+// (e.g. lost connection and DATA of `lost connection after DATA (0 bytes) from unknown[192.0.2.1]`),
+// or false if the payload is not such an error. The error is one of lost connection, timeout and too many errors.
+func ParseSessionError(payload string) (string, string, bool) {
+	match := sessionErrorRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
@@ -0,0 +1,59 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParseDisconnect(t *testing.T) {
+	d, ok := maillog.ParseDisconnect("disconnect from unknown[192.0.2.1] ehlo=1 auth=0/1 mail=1 rcpt=0/1 data=0 unknown=0/1 commands=2/5")
+	if !ok {
+		t.Fatal("expected a disconnect, but actual is not")
+	}
+	expected := &maillog.Disconnect{
+		Client: "unknown[192.0.2.1]",
+		Commands: []maillog.CommandStats{
+			{Name: "ehlo", Success: 1, Total: 1},
+			{Name: "auth", Success: 0, Total: 1},
+			{Name: "mail", Success: 1, Total: 1},
+			{Name: "rcpt", Success: 0, Total: 1},
+			{Name: "data", Success: 0, Total: 0},
+			{Name: "unknown", Success: 0, Total: 1},
+		},
+		Total: &maillog.CommandStats{Name: "commands", Success: 2, Total: 5},
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("expected `%+v`, but actual is `%+v`", expected, d)
+	}
+
+	d, ok = maillog.ParseDisconnect("disconnect from unknown[192.0.2.1]")
+	if !ok || d.Total != nil {
+		t.Errorf("expected a disconnect without the statistics, but actual is `%+v`", d)
+	}
+
+	for _, payload := range []string{"connect from unknown[192.0.2.1]", "disconnect from unknown[192.0.2.1] ehlo=x"} {
+		if _, ok := maillog.ParseDisconnect(payload); ok {
+			t.Errorf("expected `%s` is not a disconnect, but actual is", payload)
+		}
+	}
+}
+
+func TestParseSessionError(t *testing.T) {
+	cases := []struct {
+		payload string
+		err     string
+		stage   string
+	}{
+		{"lost connection after DATA (0 bytes) from unknown[192.0.2.1]", "lost connection", "DATA"},
+		{"timeout after END-OF-MESSAGE from unknown[192.0.2.1]", "timeout", "END-OF-MESSAGE"},
+		{"too many errors after RCPT from unknown[192.0.2.1]", "too many errors", "RCPT"},
+		{"connect from unknown[192.0.2.1]", "", ""},
+	}
+	for _, c := range cases {
+		err, stage, ok := maillog.ParseSessionError(c.payload)
+		if ok != (c.err != "") || err != c.err || stage != c.stage {
+			t.Errorf("expected `%s` and `%s`, but actual is `%s` and `%s`", c.err, c.stage, err, stage)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package maillog
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	tlsConnectionRegex = regexp.MustCompile(`^(Anonymous|Untrusted|Trusted|Verified) TLS connection established (to|from) (\S+): (\S+) with cipher (\S+)`)
+	tlsFailureRegex    = regexp.MustCompile(`^SSL_(accept|connect) error (?:from|to) (\S+): (.*)$`)
+)
+
+// TLSConnection is an established TLS connection of the SMTP client or server
+// (e.g. `Trusted TLS connection established to mx.example.com[192.0.2.1]:25: TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits)`).
+type TLSConnection struct {
+	// Trust is one of Anonymous, Untrusted, Trusted and Verified.
+	// Verified is a peer verified by the DANE, secure or MTA-STS policy, and Trusted is a certificate of a trusted CA without the name matched.
+	Trust string
+	// Outbound is true for the connections to a server, and false for the connections from a client.
+	Outbound bool
+	// Peer is the server or the client (e.g. mx.example.com[192.0.2.1]:25).
+	Peer     string
+	Protocol string
+	Cipher   string
+}
+
+// PeerHost returns the host of the peer without the address and port (e.g. mx.example.com).
+func (c *TLSConnection) PeerHost() string {
+	return hostOf(c.Peer)
+}
+
+// ParseTLSConnection returns the TLS connection of the payload, or false if the payload is not an established TLS connection.
+func ParseTLSConnection(payload string) (*TLSConnection, bool) {
+	match := tlsConnectionRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	return &TLSConnection{
+		Trust:    match[1],
+		Outbound: match[2] == "to",
+		Peer:     match[3],
+		Protocol: match[4],
+		Cipher:   match[5],
+	}, true
+}
+
+// TLSFailure is a failed TLS handshake of the SMTP client or server (e.g. `SSL_accept error from unknown[192.0.2.1]: lost connection`).
+type TLSFailure struct {
+	// Outbound is true for SSL_connect of the client, and false for SSL_accept of the server.
+	Outbound bool
+	Peer     string
+	Reason   string
+}
+
+// PeerHost returns the host of the peer without the address and port (e.g. mx.example.com).
+func (f *TLSFailure) PeerHost() string {
+	return hostOf(f.Peer)
+}
+
+// ParseTLSFailure returns the failed TLS handshake of the payload, or false if the payload is not a failed handshake.
+func ParseTLSFailure(payload string) (*TLSFailure, bool) {
+	match := tlsFailureRegex.FindStringSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+	return &TLSFailure{
+		Outbound: match[1] == "connect",
+		Peer:     match[2],
+		Reason:   match[3],
+	}, true
+}
+
+// hostOf returns the host of a peer such as mx.example.com[192.0.2.1]:25.
+func hostOf(peer string) string {
+	if i := strings.IndexByte(peer, '['); i > 0 {
+		return peer[:i]
+	}
+	return peer
+}
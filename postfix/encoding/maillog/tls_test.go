@@ -0,0 +1,56 @@
+package maillog_test
+
+import (
+	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/maillog"
+	"reflect"
+	"testing"
+)
+
+func TestParseTLSConnection(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.TLSConnection
+	}{
+		{
+			payload:  "Verified TLS connection established to mx.example.com[192.0.2.1]:25: TLSv1.3 with cipher TLS_AES_256_GCM_SHA384 (256/256 bits) key-exchange X25519 server-signature RSA-PSS (2048 bits) server-digest SHA256",
+			expected: &maillog.TLSConnection{Trust: "Verified", Outbound: true, Peer: "mx.example.com[192.0.2.1]:25", Protocol: "TLSv1.3", Cipher: "TLS_AES_256_GCM_SHA384"},
+		},
+		{
+			payload:  "Anonymous TLS connection established from unknown[192.0.2.2]: TLSv1.2 with cipher ECDHE-RSA-AES256-GCM-SHA384 (256/256 bits)",
+			expected: &maillog.TLSConnection{Trust: "Anonymous", Peer: "unknown[192.0.2.2]", Protocol: "TLSv1.2", Cipher: "ECDHE-RSA-AES256-GCM-SHA384"},
+		},
+		{payload: "connect from unknown[192.0.2.1]"},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseTLSConnection(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+	if c, _ := maillog.ParseTLSConnection(cases[0].payload); c.PeerHost() != "mx.example.com" {
+		t.Errorf("expected `mx.example.com`, but actual is `%s`", c.PeerHost())
+	}
+}
+
+func TestParseTLSFailure(t *testing.T) {
+	cases := []struct {
+		payload  string
+		expected *maillog.TLSFailure
+	}{
+		{
+			payload:  "SSL_connect error to mx.example.com[192.0.2.1]:25: -1",
+			expected: &maillog.TLSFailure{Outbound: true, Peer: "mx.example.com[192.0.2.1]:25", Reason: "-1"},
+		},
+		{
+			payload:  "SSL_accept error from unknown[192.0.2.2]: lost connection",
+			expected: &maillog.TLSFailure{Peer: "unknown[192.0.2.2]", Reason: "lost connection"},
+		},
+		{payload: "warning: TLS library problem: error:14094410:SSL routines:ssl3_read_bytes:sslv3 alert handshake failure"},
+	}
+	for _, c := range cases {
+		actual, ok := maillog.ParseTLSFailure(c.payload)
+		if ok != (c.expected != nil) || (ok && !reflect.DeepEqual(actual, c.expected)) {
+			t.Errorf("expected `%+v`, but actual is `%+v`", c.expected, actual)
+		}
+	}
+}
@@ -118,6 +118,9 @@ func (r *Reader) readLine() ([]byte, error) {
 		if err == io.EOF {
 			return nil, io.EOF
 		}
+		if err != nil {
+			return nil, err
+		}
 		if len(buf) == 0 && len(line) == 1 && line[0] == 0 {
 			return nil, io.EOF
 		}
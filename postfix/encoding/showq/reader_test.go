@@ -2,6 +2,7 @@ package showq_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/showq"
 	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
@@ -129,6 +130,23 @@ func TestReader_ReadMultipleMessage(t *testing.T) {
 	}
 }
 
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestReader_ReadError(t *testing.T) {
+	expected := errors.New("use of closed network connection")
+	reader := showq.NewReader(&errReader{err: expected})
+	_, err := reader.Read()
+	if err != expected {
+		t.Errorf("expected `%v`, but actual is `%v`", expected, err)
+	}
+}
+
 // BenchmarkReader_Read-8   	  909477	      1236 ns/op
 func BenchmarkReader_Read(b *testing.B) {
 	expected := mock.ShowqMessageGen(b.N)()
@@ -1,10 +1,14 @@
 package postfix
 
 import (
+	"context"
+	"fmt"
 	"github.com/k-kinzal/postfix-prometheus-exporter/postfix/encoding/showq"
 	"io"
 	"net"
+	"net/url"
 	"runtime"
+	"strings"
 	"sync"
 )
 
@@ -12,9 +16,38 @@ import (
 // See: http://www.postfix.org/postqueue.1.html
 type PostQueueOpt struct {
 	// configDir string // FIXME: want to parse main.cf and read the queue_directory.
+	// Network is either unix (default) or tcp.
+	Network string
+	// ShowqPath is the path to the showq socket, or host:port if Network is tcp.
 	ShowqPath string
 }
 
+// ParseShowqURL returns options to connect to showq at the URL.
+// The URL is either unix:///path/to/showq, tcp://host:port, or an absolute path to the socket.
+func ParseShowqURL(s string) (*PostQueueOpt, error) {
+	if strings.HasPrefix(s, "/") {
+		return &PostQueueOpt{Network: "unix", ShowqPath: s}, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("missing path to showq in `%s`", s)
+		}
+		return &PostQueueOpt{Network: "unix", ShowqPath: u.Path}, nil
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("missing port of showq in `%s`", s)
+		}
+		return &PostQueueOpt{Network: "tcp", ShowqPath: u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme `%s` in `%s`: must be one of unix, tcp", u.Scheme, s)
+	}
+}
+
 // PostQueue is postfix user interface for queue management.
 // See: http://www.postfix.org/postqueue.1.html
 type PostQueue struct {
@@ -22,21 +55,54 @@ type PostQueue struct {
 }
 
 // connectShowq returns connection to showq.
-func (q *PostQueue) connectShowq() (net.Conn, error) {
+// The connection is closed when ctx is done, so that a blocked read returns.
+func (q *PostQueue) connectShowq(ctx context.Context) (net.Conn, func(), error) {
 	path := q.opt.ShowqPath
 	if path == "" {
 		path = "/var/spool/postfix/public/showq"
 	}
-	return net.Dial("unix", path)
+	network := q.opt.Network
+	if network == "" {
+		network = "unix"
+	}
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, network, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return conn, func() {
+		close(done)
+		conn.Close()
+	}, nil
 }
 
 // EachProduce is each will produce a traditional sendmail-style queue list of messages per unit.
 func (q *PostQueue) EachProduce(fn func(message *showq.Message)) error {
-	conn, err := q.connectShowq()
+	return q.EachProduceContext(context.Background(), fn)
+}
+
+// EachProduceContext is EachProduce that stops reading from showq when ctx is done.
+func (q *PostQueue) EachProduceContext(ctx context.Context, fn func(message *showq.Message)) error {
+	conn, closer, err := q.connectShowq(ctx)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return err
 	}
-	defer conn.Close()
+	defer closer()
 
 	var er error
 	reader := showq.NewReader(conn)
@@ -57,6 +123,9 @@ func (q *PostQueue) EachProduce(fn func(message *showq.Message)) error {
 	}
 	wg.Wait()
 
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if er != io.EOF {
 		return er
 	}
@@ -67,11 +136,11 @@ func (q *PostQueue) EachProduce(fn func(message *showq.Message)) error {
 func (q *PostQueue) Produce() ([]showq.Message, error) {
 	var messages []showq.Message
 
-	conn, err := q.connectShowq()
+	conn, closer, err := q.connectShowq(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
+	defer closer()
 
 	reader := showq.NewReader(conn)
 	for {
@@ -112,4 +112,67 @@ func BenchmarkPostQueue_EachProduce(b *testing.B) {
 	if err != nil {
 		b.Fatal(err)
 	}
-}
\ No newline at end of file
+}
+
+func TestPostQueue_EachProduceContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	defer cancel()
+
+	showqPath, _ := mock.Serve(ctx, mock.ShowqMessageGen(3))
+
+	canceled, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+
+	queue := postfix.NewPostQueue(&postfix.PostQueueOpt{ShowqPath: showqPath})
+	err := queue.EachProduceContext(canceled, func(message *showq.Message) {})
+	if err != context.Canceled {
+		t.Errorf("expected `%v`, but actual is `%v`", context.Canceled, err)
+	}
+}
+
+func TestPostQueue_ProduceTCP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	addr, expected := mock.ServeTCP(ctx, mock.ShowqMessageGen(2))
+
+	opt, err := postfix.ParseShowqURL("tcp://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := postfix.NewPostQueue(opt).Produce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != len(expected) {
+		t.Errorf("expected `%d`, but actual is `%d`", len(expected), len(messages))
+	}
+}
+
+func TestParseShowqURL(t *testing.T) {
+	cases := []struct {
+		url     string
+		network string
+		path    string
+	}{
+		{"/var/spool/postfix/public/showq", "unix", "/var/spool/postfix/public/showq"},
+		{"unix:///var/spool/postfix/public/showq", "unix", "/var/spool/postfix/public/showq"},
+		{"tcp://mail.example.com:10025", "tcp", "mail.example.com:10025"},
+	}
+	for _, c := range cases {
+		opt, err := postfix.ParseShowqURL(c.url)
+		if err != nil {
+			t.Errorf("%s: %v", c.url, err)
+			continue
+		}
+		if opt.Network != c.network || opt.ShowqPath != c.path {
+			t.Errorf("expected `%s %s`, but actual is `%s %s`", c.network, c.path, opt.Network, opt.ShowqPath)
+		}
+	}
+
+	for _, url := range []string{"http://example.com/showq", "tcp://mail.example.com", "unix://", "showq"} {
+		if _, err := postfix.ParseShowqURL(url); err == nil {
+			t.Errorf("expected error for `%s`, but actual is nil", url)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/k-kinzal/postfix-prometheus-exporter/collector"
+	"github.com/k-kinzal/postfix-prometheus-exporter/config"
+	"github.com/k-kinzal/postfix-prometheus-exporter/logs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// exporter holds the collectors built from the current configuration, and replaces them on reload.
+// Metrics are gathered into a registry per request, because the metrics and labels may change with the configuration.
+type exporter struct {
+	configFile string
+	setByUser  map[string]bool
+	logger     log.Logger
+
+	reloadMu sync.Mutex
+
+	mu         sync.RWMutex
+	cfg        *config.Config
+	collectors *collector.PostfixCollector
+	scheduler  *collector.Scheduler
+	onScrape   *collector.OnScrapeCollector
+
+	// input reads the logs for the log-driven collectors. It is nil if no log input is configured.
+	input     *logs.Input
+	stopInput context.CancelFunc
+	inputDone chan struct{}
+
+	// metrics
+	lastReloadSuccessGauge          prometheus.Gauge
+	lastReloadSuccessTimestampGauge prometheus.Gauge
+}
+
+// Config returns the current configuration.
+func (e *exporter) Config() *config.Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cfg
+}
+
+// ApplyConfig builds the collectors from cfg and replaces the current ones.
+// On reload in background mode, the new collectors are updated once before they replace the current ones,
+// so that scrapes do not see empty statistics. On error, the current collectors are kept.
+func (e *exporter) ApplyConfig(cfg *config.Config) error {
+	opts, err := collector.NewOptions(cfg)
+	if err != nil {
+		return err
+	}
+	e.mu.RLock()
+	opts.Previous = e.collectors
+	opts.LogInput = e.input != nil
+	e.mu.RUnlock()
+	collectors, err := collector.NewPostfixCollector(opts, e.logger)
+	if err != nil {
+		return err
+	}
+
+	e.mu.RLock()
+	reloading := e.collectors != nil
+	e.mu.RUnlock()
+
+	var scheduler *collector.Scheduler
+	var onScrape *collector.OnScrapeCollector
+	switch cfg.Global.CollectMode {
+	case "background":
+		scheduler = collector.NewScheduler(collectors, cfg, e.logger)
+		if reloading {
+			scheduler.Update()
+		} else {
+			go scheduler.Update()
+		}
+	case "scrape":
+		onScrape = collector.NewOnScrapeCollector(collectors, time.Duration(cfg.Global.CacheTTL), time.Duration(cfg.Global.ScrapeTimeoutOffset), e.logger)
+	}
+
+	e.mu.Lock()
+	old := e.scheduler
+	if e.cfg != nil && e.cfg.Web != cfg.Web {
+		level.Warn(e.logger).Log("msg", "Changes to the web configuration require a restart")
+	}
+	if e.cfg != nil && !reflect.DeepEqual(e.cfg.Logs, cfg.Logs) {
+		level.Warn(e.logger).Log("msg", "Changes to the log inputs require a restart")
+	}
+	e.cfg = cfg
+	e.collectors = collectors
+	e.scheduler = scheduler
+	e.onScrape = onScrape
+	e.mu.Unlock()
+
+	if e.input != nil {
+		var handlers []logs.Handler
+		for _, name := range collector.Names() {
+			if h, ok := collectors.Collectors[name].(logs.Handler); ok {
+				handlers = append(handlers, h)
+			}
+		}
+		e.input.SetHandlers(handlers)
+	}
+	if old != nil {
+		old.Stop()
+	}
+	if scheduler != nil {
+		scheduler.Start()
+	}
+
+	level.Info(e.logger).Log("msg", "Enabled collectors")
+	for _, name := range collector.Names() {
+		if _, ok := collectors.Collectors[name]; ok {
+			level.Info(e.logger).Log("collector", name)
+		}
+	}
+	return nil
+}
+
+// startInput starts to read the logs in the background.
+func (e *exporter) startInput() {
+	if e.input == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stopInput = cancel
+	e.inputDone = make(chan struct{})
+	go func() {
+		defer close(e.inputDone)
+		if err := e.input.Run(ctx); err != nil {
+			level.Error(e.logger).Log("msg", "Log input stopped", "err", err)
+		}
+	}()
+}
+
+// Shutdown stops the background updates and the log input,
+// and waits for the running updates to finish until ctx is done.
+func (e *exporter) Shutdown(ctx context.Context) error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	if e.input != nil {
+		e.stopInput()
+		select {
+		case <-e.inputDone:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	e.mu.Lock()
+	scheduler := e.scheduler
+	e.scheduler = nil
+	e.mu.Unlock()
+
+	if scheduler == nil {
+		return nil
+	}
+	return scheduler.Shutdown(ctx)
+}
+
+// Reload re-reads the configuration file and applies it.
+// On error, the current configuration stays active.
+func (e *exporter) Reload() (err error) {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	defer func() {
+		if err != nil {
+			e.lastReloadSuccessGauge.Set(0)
+			return
+		}
+		e.lastReloadSuccessGauge.Set(1)
+		e.lastReloadSuccessTimestampGauge.SetToCurrentTime()
+	}()
+
+	level.Info(e.logger).Log("msg", "Loading configuration file", "filename", e.configFile)
+	cfg, err := loadConfig(e.configFile, e.setByUser)
+	if err != nil {
+		return fmt.Errorf("couldn't load configuration (--config.file=%q): %v", e.configFile, err)
+	}
+	if err := e.ApplyConfig(cfg); err != nil {
+		return fmt.Errorf("couldn't apply configuration (--config.file=%q): %v", e.configFile, err)
+	}
+	level.Info(e.logger).Log("msg", "Completed loading of configuration file", "filename", e.configFile)
+	return nil
+}
+
+// Handler returns a handler of the metrics, with exporterMetrics about the exporter itself.
+// The collect[] query parameters limit the collectors to expose, and to update in scrape mode.
+// Names that are not enabled collectors return 400.
+func (e *exporter) Handler(exporterMetrics prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.mu.RLock()
+		collectors := e.collectors
+		onScrape := e.onScrape
+		e.mu.RUnlock()
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(e.lastReloadSuccessGauge, e.lastReloadSuccessTimestampGauge)
+		var names []string
+		if params := r.URL.Query()["collect[]"]; len(params) > 0 {
+			filtered, err := collectors.Filter(params)
+			if err != nil {
+				level.Warn(e.logger).Log("msg", "Invalid collect[] parameter", "err", err)
+				http.Error(w, fmt.Sprintf("Couldn't create filtered metrics handler: %s", err), http.StatusBadRequest)
+				return
+			}
+			level.Debug(e.logger).Log("msg", "Filtered collectors", "collectors", fmt.Sprintf("%v", filtered.Names()))
+			registry.MustRegister(filtered)
+			names = filtered.Names()
+		} else {
+			registry.MustRegister(collectors)
+		}
+
+		var h http.Handler = promhttp.HandlerFor(prometheus.Gatherers{exporterMetrics, registry}, promhttp.HandlerOpts{})
+		if onScrape != nil {
+			h = onScrape.Handler(h, names...)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ReloadHandler returns a handler of POST /-/reload.
+func (e *exporter) ReloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := e.Reload(); err != nil {
+			level.Error(e.logger).Log("msg", "Error reloading config", "err", err)
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		}
+	})
+}
+
+// newExporter returns new exporter with the configuration applied.
+func newExporter(configFile string, setByUser map[string]bool, cfg *config.Config, logger log.Logger) (*exporter, error) {
+	e := &exporter{
+		configFile: configFile,
+		setByUser:  setByUser,
+		logger:     logger,
+		lastReloadSuccessGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "postfix",
+			Subsystem: "exporter",
+			Name:      "config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful.",
+		}),
+		lastReloadSuccessTimestampGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "postfix",
+			Subsystem: "exporter",
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload.",
+		}),
+	}
+	input, err := logs.NewInputFromConfig(&cfg.Logs, log.With(logger, "component", "logs"))
+	if err != nil {
+		return nil, err
+	}
+	e.input = input
+	if err := e.ApplyConfig(cfg); err != nil {
+		return nil, err
+	}
+	e.startInput()
+	e.lastReloadSuccessGauge.Set(1)
+	e.lastReloadSuccessTimestampGauge.SetToCurrentTime()
+	return e, nil
+}
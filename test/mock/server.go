@@ -9,35 +9,41 @@ import (
 )
 
 func Serve(ctx context.Context, fn ShowqMessageGenFunc) (string, []showq.Message) {
-	childCtx, _ := context.WithCancel(ctx)
-
 	dir, _ := ioutil.TempDir("", "")
 	showqPath := path.Join(dir, "showq")
 
+	listen, _ := net.Listen("unix", showqPath)
+	return showqPath, serve(ctx, listen, fn)
+}
+
+// ServeTCP serves the messages on a TCP port of localhost, and returns its address.
+func ServeTCP(ctx context.Context, fn ShowqMessageGenFunc) (string, []showq.Message) {
+	listen, _ := net.Listen("tcp", "127.0.0.1:0")
+	return listen.Addr().String(), serve(ctx, listen, fn)
+}
+
+func serve(ctx context.Context, listen net.Listener, fn ShowqMessageGenFunc) []showq.Message {
 	messages := fn()
 	var buf []byte
 	for _, message := range messages {
 		buf = append(buf, message.Bytes()...)
 	}
 
-	listen, _ := net.Listen("unix", showqPath)
+	go func() {
+		<-ctx.Done()
+		listen.Close()
+	}()
 	go func() {
 		for {
 			conn, err := listen.Accept()
 			if err != nil {
-				panic(err)
+				return
 			}
 
 			conn.Write(append(buf, 0))
 			conn.Close()
-
-			select {
-			case <-childCtx.Done():
-				listen.Close()
-				return
-			}
 		}
 	}()
 
-	return showqPath, messages
-}
\ No newline at end of file
+	return messages
+}
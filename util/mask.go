@@ -1,6 +1,10 @@
 package util
 
-import "regexp"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
 
 var (
 	r = regexp.MustCompile("[a-zA-Z0-9_.+-]+@([a-zA-Z0-9-]+\\.[a-zA-Z0-9-.])")
@@ -10,3 +14,19 @@ var (
 func EmailMask(s string) string {
 	return r.ReplaceAllString(s, "***@$1")
 }
+
+var (
+	fullRegex = regexp.MustCompile("[a-zA-Z0-9_.+-]+@[a-zA-Z0-9-]+(\\.[a-zA-Z0-9-]+)+")
+)
+
+// EmailRedact masks the whole email address.
+func EmailRedact(s string) string {
+	return fullRegex.ReplaceAllString(s, "***")
+}
+
+// Pseudonym returns a stable pseudonym of s, the first 12 hex digits of its SHA-256,
+// which tells apart the values without exposing them.
+func Pseudonym(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:6])
+}
@@ -39,3 +39,28 @@ func TestEmailMaskUseSubDomain(t *testing.T) {
 		t.Errorf("expected `***@sub.example.com`, but actual is `%s`", masked)
 	}
 }
+
+func ExampleEmailRedact() {
+	masked := util.EmailRedact("to=<foo@sub.example.com>, relay=none")
+	fmt.Println(masked)
+	// Output: to=<***>, relay=none
+}
+
+func TestEmailRedact(t *testing.T) {
+	masked := util.EmailRedact("foo+1234@sub.example.com")
+	if masked != "***" {
+		t.Errorf("expected `***`, but actual is `%s`", masked)
+	}
+}
+
+func ExamplePseudonym() {
+	pseudonym := util.Pseudonym("alice@example.com")
+	fmt.Println(pseudonym)
+	// Output: ff8d9819fc0e
+}
+
+func TestPseudonym(t *testing.T) {
+	if a, b := util.Pseudonym("alice@example.com"), util.Pseudonym("bob@example.com"); a == b {
+		t.Errorf("expected the different pseudonyms, but actual is `%s`", a)
+	}
+}
@@ -0,0 +1,230 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	config_util "github.com/prometheus/common/config"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Config is the web configuration file.
+// The format is compatible with the Prometheus exporter-toolkit.
+type Config struct {
+	TLSConfig TLSConfig                     `yaml:"tls_server_config"`
+	Users     map[string]config_util.Secret `yaml:"basic_auth_users"`
+}
+
+// TLSConfig configures TLS of the HTTP server.
+// TLS is enabled when CertFile and KeyFile are set.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientAuth is one of NoClientCert, RequestClientCert, RequireAnyClientCert, VerifyClientCertIfGiven
+	// or RequireAndVerifyClientCert. If omitted, RequireAndVerifyClientCert is used when ClientCAs is set.
+	ClientAuth string `yaml:"client_auth_type"`
+	ClientCAs  string `yaml:"client_ca_file"`
+	// CipherSuites is the names of the cipher suites for TLS 1.2 and earlier (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256).
+	CipherSuites             []Cipher   `yaml:"cipher_suites"`
+	PreferServerCipherSuites bool       `yaml:"prefer_server_cipher_suites"`
+	MinVersion               TLSVersion `yaml:"min_version"`
+	MaxVersion               TLSVersion `yaml:"max_version"`
+}
+
+// Enabled returns whether TLS is configured.
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.ClientCAs != "" || c.ClientAuth != ""
+}
+
+// setDirectory resolves the relative paths of the files against dir.
+func (c *TLSConfig) setDirectory(dir string) {
+	join := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	c.CertFile = join(c.CertFile)
+	c.KeyFile = join(c.KeyFile)
+	c.ClientCAs = join(c.ClientCAs)
+}
+
+// TLSVersion is a TLS version written as TLS10, TLS11, TLS12 or TLS13.
+type TLSVersion uint16
+
+var tlsVersions = map[string]TLSVersion{
+	"TLS13": tls.VersionTLS13,
+	"TLS12": tls.VersionTLS12,
+	"TLS11": tls.VersionTLS11,
+	"TLS10": tls.VersionTLS10,
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (v *TLSVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	version, ok := tlsVersions[s]
+	if !ok {
+		return fmt.Errorf("unknown TLS version `%s`", s)
+	}
+	*v = version
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (v TLSVersion) MarshalYAML() (interface{}, error) {
+	for s, version := range tlsVersions {
+		if v == version {
+			return s, nil
+		}
+	}
+	return fmt.Sprintf("%v", uint16(v)), nil
+}
+
+// Cipher is a TLS cipher suite written by its name.
+type Cipher uint16
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Cipher) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == s {
+			*c = Cipher(suite.ID)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown or insecure cipher suite `%s`", s)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (c Cipher) MarshalYAML() (interface{}, error) {
+	return tls.CipherSuiteName(uint16(c)), nil
+}
+
+// NewTLSConfig returns the tls.Config built from the configuration.
+// The certificate is read on each handshake, so that a renewed certificate is used without restart.
+func NewTLSConfig(c *TLSConfig) (*tls.Config, error) {
+	if c.CertFile == "" {
+		return nil, fmt.Errorf("missing cert_file")
+	}
+	if c.KeyFile == "" {
+		return nil, fmt.Errorf("missing key_file")
+	}
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return nil, fmt.Errorf("failed to load X509KeyPair: %v", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:               uint16(c.MinVersion),
+		MaxVersion:               uint16(c.MaxVersion),
+		PreferServerCipherSuites: c.PreferServerCipherSuites,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load X509KeyPair: %v", err)
+			}
+			return &cert, nil
+		},
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	if cfg.MaxVersion != 0 && cfg.MaxVersion < cfg.MinVersion {
+		return nil, fmt.Errorf("max_version must be greater than or equal to min_version")
+	}
+	for _, cipher := range c.CipherSuites {
+		cfg.CipherSuites = append(cfg.CipherSuites, uint16(cipher))
+	}
+
+	if c.ClientCAs != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAs)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client_ca_file %s", c.ClientCAs)
+		}
+		cfg.ClientCAs = pool
+	}
+
+	switch c.ClientAuth {
+	case "":
+		if c.ClientCAs != "" {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	case "NoClientCert":
+		cfg.ClientAuth = tls.NoClientCert
+	case "RequestClientCert":
+		cfg.ClientAuth = tls.RequestClientCert
+	case "RequireAnyClientCert", "RequireClientCert":
+		cfg.ClientAuth = tls.RequireAnyClientCert
+	case "VerifyClientCertIfGiven":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "RequireAndVerifyClientCert":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client_auth_type `%s`", c.ClientAuth)
+	}
+	if c.ClientCAs != "" && cfg.ClientAuth == tls.NoClientCert {
+		return nil, fmt.Errorf("client_ca_file is set but client_auth_type is NoClientCert")
+	}
+	if c.ClientCAs == "" && (cfg.ClientAuth == tls.VerifyClientCertIfGiven || cfg.ClientAuth == tls.RequireAndVerifyClientCert) {
+		return nil, fmt.Errorf("client_ca_file is required to verify client certificates")
+	}
+	return cfg, nil
+}
+
+// Load parses the YAML input s into a Config and validates it.
+func Load(s string) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict([]byte(s), cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile parses the given YAML file into a Config and validates it.
+// Relative paths in the file are resolved against the directory of the file.
+func LoadFile(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("parsing YAML file %s: %v", filename, err)
+	}
+	cfg.TLSConfig.setDirectory(filepath.Dir(filename))
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("parsing YAML file %s: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	for user, hash := range c.Users {
+		if user == "" {
+			return fmt.Errorf("basic_auth_users: empty user name")
+		}
+		if hash == "" {
+			return fmt.Errorf("basic_auth_users.%s: empty password hash", user)
+		}
+	}
+	if c.TLSConfig.Enabled() {
+		if _, err := NewTLSConfig(&c.TLSConfig); err != nil {
+			return fmt.Errorf("tls_server_config: %v", err)
+		}
+	}
+	return nil
+}
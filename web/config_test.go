@@ -0,0 +1,70 @@
+package web_test
+
+import (
+	"crypto/tls"
+	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
+	"github.com/k-kinzal/postfix-prometheus-exporter/web"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	if _, err := mock.GenerateCertificates(dir); err != nil {
+		t.Fatal(err)
+	}
+	filename := path.Join(dir, "web.yml")
+	ioutil.WriteFile(filename, []byte(`
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  client_ca_file: ca.crt
+  min_version: TLS13
+basic_auth_users:
+  prometheus: $2y$10$QOauhQNbBCuQDKes6eFzPeMqBSjb7Mr5DUmpZ/VcEd00UAV/LDeSi
+`), 0600)
+
+	cfg, err := web.LoadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLSConfig.CertFile != path.Join(dir, "server.crt") {
+		t.Errorf("expected `%s`, but actual is `%s`", path.Join(dir, "server.crt"), cfg.TLSConfig.CertFile)
+	}
+	tlsConfig, err := web.NewTLSConfig(&cfg.TLSConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("expected `%v`, but actual is `%v`", tls.VersionTLS13, tlsConfig.MinVersion)
+	}
+	if tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("expected `%v`, but actual is `%v`", tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	}
+	if len(cfg.Users) != 1 {
+		t.Errorf("expected 1 user, but actual is `%v`", len(cfg.Users))
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	cases := []struct {
+		yaml     string
+		expected string
+	}{
+		{"tls_server_config: {min_version: SSL30}", "unknown TLS version `SSL30`"},
+		{"tls_server_config: {cipher_suites: [TLS_RSA_WITH_RC4_128_SHA]}", "unknown or insecure cipher suite"},
+		{"tls_server_config: {key_file: server.key}", "tls_server_config: missing cert_file"},
+		{"basic_auth_users: {prometheus: ''}", "basic_auth_users.prometheus: empty password hash"},
+		{"tls_config: {}", "field tls_config not found"},
+	}
+	for _, c := range cases {
+		_, err := web.Load(c.yaml)
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("expected `%s`, but actual is `%v`", c.expected, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"sync"
+)
+
+// maxAuthCacheSize bounds the number of successful authentications kept to skip bcrypt.
+const maxAuthCacheSize = 100
+
+// dummyHash is compared when the user is unknown, so that the response time does not reveal which users exist.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+// Handler requires basic authentication by the users in the web configuration file.
+// The file is read on each request, so that users can be changed without restart.
+type Handler struct {
+	handler    http.Handler
+	configFile string
+	logger     log.Logger
+
+	mu    sync.Mutex
+	cache map[string]bool
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg, err := LoadFile(h.configFile)
+	if err != nil {
+		level.Error(h.logger).Log("msg", "Unable to parse web configuration file", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if len(cfg.Users) == 0 {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if ok && h.authenticate(cfg, user, pass) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="Postfix Exporter"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// authenticate returns whether the password matches the bcrypt hash of the user.
+func (h *Handler) authenticate(cfg *Config, user string, pass string) bool {
+	hashedPassword, ok := cfg.Users[user]
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(pass))
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(user + "\x00" + string(hashedPassword) + "\x00" + pass))
+	key := hex.EncodeToString(sum[:])
+	h.mu.Lock()
+	cached := h.cache[key]
+	h.mu.Unlock()
+	if cached {
+		return true
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(pass)); err != nil {
+		return false
+	}
+	h.mu.Lock()
+	if len(h.cache) >= maxAuthCacheSize {
+		h.cache = make(map[string]bool)
+	}
+	h.cache[key] = true
+	h.mu.Unlock()
+	return true
+}
+
+// NewHandler returns new Handler that serves handler to authenticated requests.
+func NewHandler(handler http.Handler, configFile string, logger log.Logger) *Handler {
+	return &Handler{
+		handler:    handler,
+		configFile: configFile,
+		logger:     logger,
+		cache:      make(map[string]bool),
+	}
+}
+
+// ListenAndServe starts the server with TLS and basic authentication of the web configuration file.
+// All handlers of the server are protected. Without the file, the server is started on plain HTTP.
+// The file is validated before the server starts, and read again on each connection and request afterwards.
+func ListenAndServe(server *http.Server, configFile string, logger log.Logger) error {
+	if configFile == "" {
+		level.Info(logger).Log("msg", "TLS is disabled.")
+		return server.ListenAndServe()
+	}
+
+	cfg, err := LoadFile(configFile)
+	if err != nil {
+		return err
+	}
+	server.Handler = NewHandler(server.Handler, configFile, logger)
+
+	if !cfg.TLSConfig.Enabled() {
+		level.Info(logger).Log("msg", "TLS is disabled.")
+		return server.ListenAndServe()
+	}
+	tlsConfig, err := NewTLSConfig(&cfg.TLSConfig)
+	if err != nil {
+		return err
+	}
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg, err := LoadFile(configFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "Unable to parse web configuration file", "err", err)
+			return nil, err
+		}
+		return NewTLSConfig(&cfg.TLSConfig)
+	}
+	server.TLSConfig = tlsConfig
+	level.Info(logger).Log("msg", "TLS is enabled.")
+	return server.ListenAndServeTLS("", "")
+}
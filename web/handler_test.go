@@ -0,0 +1,134 @@
+package web_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/k-kinzal/postfix-prometheus-exporter/test/mock"
+	"github.com/k-kinzal/postfix-prometheus-exporter/web"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func writeWebConfig(t *testing.T, dir string, content string) string {
+	filename := path.Join(dir, "web.yml")
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestHandler(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	filename := writeWebConfig(t, dir, fmt.Sprintf("basic_auth_users:\n  prometheus: %s\n", hash))
+
+	handler := web.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), filename, log.NewNopLogger())
+
+	cases := []struct {
+		user     string
+		password string
+		expected int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"prometheus", "wrong", http.StatusUnauthorized},
+		{"unknown", "secret", http.StatusUnauthorized},
+		{"prometheus", "secret", http.StatusOK},
+		{"prometheus", "secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if c.user != "" {
+			r.SetBasicAuth(c.user, c.password)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != c.expected {
+			t.Errorf("%s:%s: expected `%d`, but actual is `%d`", c.user, c.password, c.expected, w.Code)
+		}
+	}
+
+	// users are read on each request
+	writeWebConfig(t, dir, "")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected `%d`, but actual is `%d`", http.StatusOK, w.Code)
+	}
+}
+
+func TestListenAndServe_ClientCertificate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	certs, err := mock.GenerateCertificates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := writeWebConfig(t, dir, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  client_ca_file: ca.crt
+`)
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+	server := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+	}
+	defer server.Close()
+	go web.ListenAndServe(server, filename, log.NewNopLogger())
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	pem, _ := ioutil.ReadFile(certs.CAFile)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pem)
+	clientCert, err := tls.LoadX509KeyPair(certs.ClientCertFile, certs.ClientKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(certificates []tls.Certificate) (*http.Response, error) {
+		client := &http.Client{
+			Timeout: time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certificates},
+			},
+		}
+		return client.Get("https://" + addr + "/metrics")
+	}
+
+	resp, err := get([]tls.Certificate{clientCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected `%d`, but actual is `%d`", http.StatusOK, resp.StatusCode)
+	}
+
+	if _, err := get(nil); err == nil {
+		t.Errorf("expected the request without client certificate to fail")
+	}
+}